@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileFilter selects the files ranked from a directory. Globs are matched
+// against paths relative to the directory, with '/' separators; '**' matches
+// any number of directories, and a glob without a '/' matches file names at
+// any depth.
+type fileFilter struct {
+	Pattern   string   // Glob every file must match
+	Include   []string // Globs of which a file must match one (all files if empty)
+	Exclude   []string // Globs of files and directories to skip
+	Recursive bool     // Descend into subdirectories
+	GitIgnore bool     // Skip .git and whatever the directory's .gitignore files ignore
+	MaxSize   int64    // Skip files larger than this many bytes (0 = no limit)
+}
+
+// inputFilter returns the file filter for a directory input set by the flags
+func inputFilter() fileFilter {
+	return fileFilter{
+		Pattern:   filePattern,
+		Include:   includes,
+		Exclude:   excludes,
+		Recursive: recursive,
+		GitIgnore: gitignore,
+		MaxSize:   maxFileSize,
+	}
+}
+
+// inputSourceDir returns the directory input that documents' sources are
+// recorded relative to, or "" if the input is a file
+func inputSourceDir() string {
+	info, err := os.Stat(inputFile)
+	if err != nil || !info.IsDir() {
+		return ""
+	}
+	dir, err := filepath.Abs(inputFile)
+	if err != nil {
+		return ""
+	}
+	return dir
+}
+
+// walkFiles returns the files under dirPath selected by filter, sorted.
+// Symlinked directories are not followed, and MaxFilesPerDirectory applies
+// to every directory visited.
+func walkFiles(dirPath string, filter fileFilter) ([]string, error) {
+	for _, pattern := range append(append([]string{filter.Pattern}, filter.Include...), filter.Exclude...) {
+		if err := validateGlob(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	var matchedFiles []string
+	if err := filter.walk(dirPath, "", nil, &matchedFiles); err != nil {
+		return nil, err
+	}
+
+	// Sort for deterministic ordering
+	sort.Strings(matchedFiles)
+
+	if len(matchedFiles) == 0 {
+		return nil, fmt.Errorf("no files matched pattern %q", filter.Pattern)
+	}
+
+	return matchedFiles, nil
+}
+
+// walk adds the selected files of the directory at relDir (relative to
+// root, "" for root itself) to matched, and descends if recursive
+func (f fileFilter) walk(root, relDir string, ignores []gitignoreRule, matched *[]string) error {
+	dirPath := filepath.Join(root, filepath.FromSlash(relDir))
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return fmt.Errorf("failed to read directory")
+	}
+
+	if f.GitIgnore {
+		rules, err := readGitignore(dirPath, relDir)
+		if err != nil {
+			return err
+		}
+		ignores = append(ignores[:len(ignores):len(ignores)], rules...)
+	}
+
+	var subdirs []string
+	filesInDir := 0
+	for _, entry := range entries {
+		relPath := path.Join(relDir, entry.Name())
+		fullPath := filepath.Join(dirPath, entry.Name())
+
+		// Follow file symlinks (validatePath checks their targets when they
+		// are loaded) but never directory symlinks
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			continue // Broken symlink or vanished entry
+		}
+		if info.IsDir() {
+			if entry.IsDir() && f.Recursive && f.selectsDir(relPath, ignores) {
+				subdirs = append(subdirs, relPath)
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue // Devices, sockets and pipes
+		}
+
+		if !f.selectsFile(relPath, ignores) || (f.MaxSize > 0 && info.Size() > f.MaxSize) {
+			continue
+		}
+		filesInDir++
+		*matched = append(*matched, fullPath)
+	}
+
+	// Check file count limit to prevent resource exhaustion
+	if filesInDir > MaxFilesPerDirectory {
+		return fmt.Errorf("directory contains too many matching files (max %d)", MaxFilesPerDirectory)
+	}
+
+	for _, subdir := range subdirs {
+		if err := f.walk(root, subdir, ignores, matched); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// selectsDir reports whether the walk should descend into relPath
+func (f fileFilter) selectsDir(relPath string, ignores []gitignoreRule) bool {
+	if f.GitIgnore && (path.Base(relPath) == ".git" || ignored(ignores, relPath, true)) {
+		return false
+	}
+	return !matchesAny(f.Exclude, relPath)
+}
+
+// selectsFile reports whether the file at relPath should be ranked
+func (f fileFilter) selectsFile(relPath string, ignores []gitignoreRule) bool {
+	if !matchGlob(f.Pattern, relPath) || matchesAny(f.Exclude, relPath) {
+		return false
+	}
+	if len(f.Include) > 0 && !matchesAny(f.Include, relPath) {
+		return false
+	}
+	return !f.GitIgnore || !ignored(ignores, relPath, false)
+}
+
+// validateGlob rejects malformed globs before any file is matched
+func validateGlob(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchesAny reports whether relPath matches any of patterns
+func matchesAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a validated glob against a slash-separated relative
+// path. A glob without a '/' matches the path's last element.
+func matchGlob(pattern, relPath string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(relPath))
+		return matched
+	}
+	return matchSegments(strings.Split(strings.TrimPrefix(pattern, "/"), "/"), strings.Split(relPath, "/"))
+}
+
+// matchSegments matches glob segments against path elements, '**' matching
+// any number of elements
+func matchSegments(pattern, elements []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elements); i++ {
+				if matchSegments(pattern[1:], elements[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elements) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], elements[0]); !matched {
+			return false
+		}
+		pattern, elements = pattern[1:], elements[1:]
+	}
+	return len(elements) == 0
+}
+
+// gitignoreRule is one pattern line of a .gitignore file
+type gitignoreRule struct {
+	base     string // Directory of the .gitignore file, relative to the root
+	pattern  string
+	negate   bool // "!pattern" re-includes what earlier rules ignored
+	dirOnly  bool // "pattern/" only matches directories
+	anchored bool // Patterns with a '/' before the end are relative to base
+}
+
+// readGitignore parses the .gitignore file in dirPath, if there is one
+func readGitignore(dirPath, relDir string) ([]gitignoreRule, error) {
+	// #nosec G304 - dirPath is a directory being walked under a validated input path
+	content, err := os.ReadFile(filepath.Join(dirPath, ".gitignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitignore")
+	}
+
+	var rules []gitignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := gitignoreRule{base: relDir}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\") // "\#" and "\!" escape a leading character
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimPrefix(line, "/")
+		if rule.pattern == "" || validateGlob(rule.pattern) != nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// ignored reports whether the last rule matching relPath ignores it
+func ignored(rules []gitignoreRule, relPath string, isDir bool) bool {
+	result := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel := relPath
+		if rule.base != "" {
+			rel = strings.TrimPrefix(relPath, rule.base+"/")
+		}
+		var matched bool
+		if rule.anchored {
+			matched = matchSegments(strings.Split(rule.pattern, "/"), strings.Split(rel, "/"))
+		} else {
+			matched, _ = path.Match(rule.pattern, path.Base(rel))
+		}
+		if matched {
+			result = !rule.negate
+		}
+	}
+	return result
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/meganerd/siftrank/pkg/siftrank"
 	"github.com/openai/openai-go"
@@ -16,6 +22,12 @@ import (
 	"github.com/spf13/pflag"
 )
 
+// JSON output formats for --output-format
+const (
+	outputFormatDocuments = "documents"
+	outputFormatEnvelope  = "envelope"
+)
+
 const (
 	// MaxFilesPerDirectory limits the number of files that can be enumerated
 	// from a directory to prevent resource exhaustion attacks
@@ -65,6 +77,79 @@ func validatePath(path string) (string, error) {
 	return realPath, nil
 }
 
+// validateDirPath validates a directory path the same way validatePath
+// validates a file path: no directory traversal, symlinks resolved, and an
+// existing path must be a directory. A missing directory is returned as the
+// clean path so that it can be created.
+func validateDirPath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve path")
+	}
+
+	cleanPath := filepath.Clean(absPath)
+	if strings.Contains(cleanPath, "..") {
+		return "", fmt.Errorf("path contains directory traversal")
+	}
+
+	realPath, err := filepath.EvalSymlinks(cleanPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cleanPath, nil
+		}
+		return "", fmt.Errorf("failed to resolve path")
+	}
+
+	info, err := os.Stat(realPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat path")
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("path is a file, not a directory")
+	}
+
+	return realPath, nil
+}
+
+// inputFromStdin reports whether input is read from stdin: --file is "-", or
+// --file is not set and stdin is a pipe or file rather than a terminal
+func inputFromStdin() (bool, error) {
+	switch inputFile {
+	case "-":
+	case "":
+		info, err := os.Stdin.Stat()
+		if err != nil || info.Mode()&os.ModeCharDevice != 0 {
+			return false, fmt.Errorf("--file is required unless input is piped to stdin")
+		}
+	default:
+		return false, nil
+	}
+
+	if wholeFile {
+		return false, fmt.Errorf("--whole-file needs a file or directory input, not stdin")
+	}
+	return true, nil
+}
+
+// inputFiles returns the --file input, or the files selected from it if it
+// is a directory
+func inputFiles() ([]string, error) {
+	inputFD, isDir, err := validateInputPath(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input path: %w", err)
+	}
+	defer inputFD.Close()
+
+	if !isDir {
+		return []string{inputFD.Name()}, nil
+	}
+	filePaths, err := walkFiles(inputFD.Name(), inputFilter())
+	if err != nil {
+		return nil, fmt.Errorf("failed to enumerate files: %w", err)
+	}
+	return filePaths, nil
+}
+
 // validateInputPath validates a file or directory path and returns an open file descriptor
 // Returns: (file, isDir, error)
 // The caller is responsible for closing the returned file descriptor.
@@ -104,54 +189,24 @@ func validateInputPath(path string) (*os.File, bool, error) {
 	return file, info.IsDir(), nil
 }
 
-// enumerateFiles returns all files in directory matching glob pattern
-// Returns absolute paths of regular files only (skips subdirectories)
-func enumerateFiles(dirPath string, pattern string) ([]string, error) {
-	entries, err := os.ReadDir(dirPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read directory")
-	}
-
-	var matchedFiles []string
-	for _, entry := range entries {
-		// Skip subdirectories
-		if entry.IsDir() {
-			continue
-		}
-
-		// Check if file matches glob pattern
-		matched, err := filepath.Match(pattern, entry.Name())
-		if err != nil {
-			return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
-		}
-
-		if matched {
-			fullPath := filepath.Join(dirPath, entry.Name())
-			matchedFiles = append(matchedFiles, fullPath)
-		}
-	}
-
-	// Check file count limit to prevent resource exhaustion
-	if len(matchedFiles) > MaxFilesPerDirectory {
-		return nil, fmt.Errorf("directory contains too many matching files (max %d)", MaxFilesPerDirectory)
-	}
-
-	// Sort for deterministic ordering
-	sort.Strings(matchedFiles)
-
-	if len(matchedFiles) == 0 {
-		return nil, fmt.Errorf("no files matched pattern %q", pattern)
-	}
-
-	return matchedFiles, nil
-}
-
 var (
 	// Input/Output
-	inputFile   string
-	forceJSON   bool
-	outputFile  string
-	filePattern string
+	inputFile    string
+	forceJSON    bool
+	inputFormat  string
+	recordSep    string
+	wholeFile    bool
+	idField      string
+	idTemplate   string
+	duplicates   string
+	outputFile   string
+	outputFormat string
+	filePattern  string
+	recursive    bool
+	includes     []string
+	excludes     []string
+	gitignore    bool
+	maxFileSize  int64
 
 	// Prompt/Template
 	initialPrompt string
@@ -163,13 +218,25 @@ var (
 	concurrency     int
 	batchTokens     int
 	refinementRatio float64
+	seed            int64
+	scoringModel    string
+	batchSelection  string
+	warmupTrials    int
 
 	// Model params
+	providerName  string
 	oaiModel      string
 	oaiURL        string
 	encoding      string
 	effort        string
 	compareModels string
+	inputPrice    float64
+	outputPrice   float64
+	pricingFile   string
+
+	// Budget params
+	maxCostUSD  float64
+	tokenBudget int
 
 	// Convergence params
 	noConverge     bool
@@ -178,10 +245,39 @@ var (
 	minTrials      int
 	elbowMethod    string
 
+	// Cache params
+	cacheDir      string
+	cacheReadOnly bool
+	cacheRefresh  bool
+	cacheTTL      time.Duration
+
+	// Checkpoint params
+	checkpointDir string
+	resumeDir     string
+
+	// Record/replay params
+	recordFile string
+	replayFile string
+
+	// Pointwise params
+	rubricFile     string
+	samples        int
+	scoreBatchSize int
+	blendWeight    float64
+	minScore       float64
+
+	// Multi-criteria params
+	criteriaFile string
+	aggregation  string
+
+	// Insert params
+	baseFile string
+
 	// Execution params
 	dryRun    bool
 	debug     bool
 	relevance bool
+	rankMode  string
 	traceFile string
 	watch     bool
 	noMinimap bool
@@ -224,7 +320,11 @@ func FilterFlags(cmd *cobra.Command) *pflag.FlagSet {
 }
 
 const usageTemplate = `Usage:
-  {{.UseLine}}
+  {{.UseLine}}{{if .HasAvailableSubCommands}}
+  {{.CommandPath}} [command]
+
+Commands:{{range .Commands}}{{if .IsAvailableCommand}}
+  {{rpad .Name .NamePadding}} {{.Short}}{{end}}{{end}}{{end}}
 
 Options:
 {{FlagsInGroup . "options" | FlagUsages | trimTrailingWhitespaces}}
@@ -248,87 +348,195 @@ var rootCmd = &cobra.Command{
 	RunE:  run,
 }
 
+var estimateCmd = &cobra.Command{
+	Use:   "estimate",
+	Short: "Project LLM calls, tokens and cost of a ranking run without calling the LLM",
+	RunE:  runEstimate,
+}
+
+var insertCmd = &cobra.Command{
+	Use:   "insert",
+	Short: "Rank new documents into an earlier ranking without re-ranking it",
+	RunE:  runInsert,
+}
+
 func init() {
-	// Input/Output flags
-	rootCmd.Flags().StringVarP(&inputFile, "file", "f", "", "input file (required)")
-	rootCmd.Flags().BoolVar(&forceJSON, "json", false, "force JSON parsing regardless of file extension")
-	rootCmd.Flags().StringVarP(&outputFile, "output", "o", "", "JSON output file")
-	rootCmd.Flags().StringVar(&filePattern, "pattern", "*", "glob pattern for filtering files in directory (e.g., \"*.json\", \"data_*.txt\")")
-	if err := rootCmd.MarkFlagRequired("file"); err != nil {
+	// Register template functions for flag grouping
+	cobra.AddTemplateFunc("FlagsInGroup", FlagsInGroup)
+	cobra.AddTemplateFunc("FilterFlags", FilterFlags)
+	cobra.AddTemplateFunc("FlagUsages", func(fs *pflag.FlagSet) string {
+		return fs.FlagUsages()
+	})
+
+	// Set custom usage template (inherited by subcommands)
+	rootCmd.SetUsageTemplate(usageTemplate)
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+
+	// estimate takes the same flags so a run can be projected, then executed
+	addRankFlags(rootCmd)
+	addRankFlags(estimateCmd)
+	rootCmd.AddCommand(estimateCmd)
+
+	// insert ranks with the same flags against the --base ranking
+	addRankFlags(insertCmd)
+	insertCmd.Flags().StringVar(&baseFile, "base", "", "JSON output of an earlier run to insert the documents into (required)")
+	if err := insertCmd.MarkFlagRequired("base"); err != nil {
 		panic(fmt.Sprintf("failed to mark flag as required: %v", err))
 	}
+	setFlagGroup(insertCmd, "options", "base")
+	rootCmd.AddCommand(insertCmd)
+}
+
+// addRankFlags registers the ranking flags on cmd and organizes them into
+// help groups
+func addRankFlags(cmd *cobra.Command) {
+	// Input/Output flags
+	cmd.Flags().StringVarP(&inputFile, "file", "f", "", "input file or directory, or - for stdin (default: stdin when it is piped)")
+	cmd.Flags().BoolVar(&forceJSON, "json", false, "force JSON parsing regardless of file extension")
+	cmd.Flags().StringVar(&inputFormat, "format", "", "input format: text, json, jsonl, csv, tsv (default: by file extension; .ndjson is jsonl)")
+	cmd.Flags().StringVar(&recordSep, "record-separator", "", "regexp matching whole lines that separate multi-line text records (e.g. \"---\", or \"\\s*\" for blank lines)")
+	cmd.Flags().BoolVar(&wholeFile, "whole-file", false, "rank each file as one document (template fields: {{.Path}}, {{.Name}}, {{.Data}})")
+	cmd.Flags().StringVar(&idField, "id-field", "", "take document IDs (result keys) from this JSON path (e.g. \"meta.id\") or CSV/TSV column instead of hashing values")
+	cmd.Flags().StringVar(&idTemplate, "id-template", "", "build document IDs with this template (same fields as --template, or @file.tpl)")
+	cmd.Flags().StringVar(&duplicates, "duplicates", string(siftrank.DuplicatesMerge), "documents with the same ID: merge (rank once, list the others' input indexes and sources), keep-first, error")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "JSON output file")
+	cmd.Flags().StringVar(&outputFormat, "output-format", outputFormatDocuments, "JSON output format: documents (ranked list), envelope (documents plus usage, rounds and run metadata)")
+	cmd.Flags().StringVar(&filePattern, "pattern", "*", "glob pattern for filtering files in directory (e.g., \"*.json\", \"data_*.txt\")")
+	cmd.Flags().BoolVar(&recursive, "recursive", false, "include files in subdirectories of a directory input (symlinked directories are not followed)")
+	cmd.Flags().StringArrayVar(&includes, "include", nil, "only rank directory files matching this glob (repeatable; ** matches any directories, globs without / match file names)")
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "skip directory files and subdirectories matching this glob (repeatable)")
+	cmd.Flags().BoolVar(&gitignore, "gitignore", false, "skip .git and files ignored by .gitignore files in a directory input")
+	cmd.Flags().Int64Var(&maxFileSize, "max-file-size", 0, "skip directory files larger than this many bytes (0 = no limit)")
 
 	// Prompt/Template flags
-	rootCmd.Flags().StringVarP(&initialPrompt, "prompt", "p", "", "initial prompt (prefix with @ to use a file)")
-	rootCmd.Flags().StringVar(&inputTemplate, "template", "{{.Data}}", "template for each object (prefix with @ to use a file)")
+	cmd.Flags().StringVarP(&initialPrompt, "prompt", "p", "", "initial prompt (prefix with @ to use a file)")
+	cmd.Flags().StringVar(&inputTemplate, "template", "{{.Data}}", "template for each object (prefix with @ to use a file)")
 
 	// Algorithm parameter flags
-	rootCmd.Flags().IntVarP(&batchSize, "batch-size", "b", siftrank.DefaultBatchSize, "number of items per batch")
-	rootCmd.Flags().IntVar(&maxTrials, "max-trials", siftrank.DefaultNumTrials, "maximum number of ranking trials")
-	rootCmd.Flags().IntVarP(&concurrency, "concurrency", "c", siftrank.DefaultConcurrency, "max concurrent LLM calls across all trials")
-	rootCmd.Flags().IntVar(&batchTokens, "tokens", siftrank.DefaultBatchTokens, "max tokens per batch")
-	rootCmd.Flags().Float64Var(&refinementRatio, "ratio", siftrank.DefaultRefinementRatio, "refinement ratio (0.0-1.0, e.g. 0.5 = top 50%)")
+	cmd.Flags().IntVarP(&batchSize, "batch-size", "b", siftrank.DefaultBatchSize, "number of items per batch")
+	cmd.Flags().IntVar(&maxTrials, "max-trials", siftrank.DefaultNumTrials, "maximum number of ranking trials")
+	cmd.Flags().IntVarP(&concurrency, "concurrency", "c", siftrank.DefaultConcurrency, "max concurrent LLM calls across all trials")
+	cmd.Flags().IntVar(&batchTokens, "tokens", siftrank.DefaultBatchTokens, "max tokens per batch")
+	cmd.Flags().Float64Var(&refinementRatio, "ratio", siftrank.DefaultRefinementRatio, "refinement ratio (0.0-1.0, e.g. 0.5 = top 50%)")
+	cmd.Flags().Int64Var(&seed, "seed", 0, "random seed for reproducible batches and IDs (0 = random, or 1 with --cache-dir)")
+	cmd.Flags().StringVar(&scoringModel, "scoring", "", "scoring model: mean (mean batch position, default), plackett-luce (fitted strengths with standard errors, default with adaptive batch selection and pairwise mode)")
+	cmd.Flags().StringVar(&batchSelection, "batch-selection", string(siftrank.BatchSelectionRandom), "batch selection: random (shuffle every trial), adaptive (focus later trials on uncertain documents)")
+	cmd.Flags().IntVar(&warmupTrials, "warmup-trials", siftrank.DefaultAdaptiveWarmup, "random trials before adaptive batch selection starts")
 
 	// Model parameter flags
-	rootCmd.Flags().StringVarP(&oaiModel, "model", "m", openai.ChatModelGPT4oMini, "OpenAI model name")
-	rootCmd.Flags().StringVarP(&oaiURL, "base-url", "u", "", "OpenAI API base URL (for compatible APIs like vLLM)")
-	rootCmd.Flags().StringVar(&encoding, "encoding", siftrank.DefaultEncoding, "tokenizer encoding")
-	rootCmd.Flags().StringVarP(&effort, "effort", "e", "", "reasoning effort level: none, minimal, low, medium, high")
-	rootCmd.Flags().StringVar(&compareModels, "compare", "", "compare multiple models (format: \"provider:model,provider:model\")")
+	cmd.Flags().StringVar(&providerName, "provider", string(siftrank.ProviderTypeOpenAI), "LLM provider: openai, anthropic, openrouter, ollama, google")
+	cmd.Flags().StringVarP(&oaiModel, "model", "m", openai.ChatModelGPT4oMini, "model name")
+	cmd.Flags().StringVarP(&oaiURL, "base-url", "u", "", "custom API base URL (for OpenAI-compatible APIs like vLLM)")
+	cmd.Flags().StringVar(&encoding, "encoding", siftrank.DefaultEncoding, "tokenizer encoding")
+	cmd.Flags().StringVarP(&effort, "effort", "e", "", "reasoning effort level: none, minimal, low, medium, high")
+	cmd.Flags().StringVar(&compareModels, "compare", "", "compare multiple models (format: \"provider:model,provider:model\")")
+	cmd.Flags().Float64Var(&inputPrice, "input-price", 0, "input token price in USD per million tokens (overrides the pricing table)")
+	cmd.Flags().Float64Var(&outputPrice, "output-price", 0, "output token price in USD per million tokens (overrides the pricing table)")
+	cmd.Flags().StringVar(&pricingFile, "pricing-file", "", "JSON file of per-model token prices overriding the built-in table")
+
+	// Budget flags
+	cmd.Flags().Float64Var(&maxCostUSD, "budget", 0, "stop scheduling LLM calls before spending more than this many USD (logs a pre-run cost estimate)")
+	cmd.Flags().IntVar(&tokenBudget, "token-budget", 0, "stop scheduling LLM calls before using more than this many tokens")
 
 	// Convergence parameter flags
-	rootCmd.Flags().BoolVar(&noConverge, "no-converge", false, "disable early stopping based on convergence")
-	rootCmd.Flags().Float64Var(&elbowTolerance, "elbow-tolerance", siftrank.DefaultElbowTolerance, "elbow position tolerance (0.05 = 5%)")
-	rootCmd.Flags().IntVar(&stableTrials, "stable-trials", siftrank.DefaultStableTrials, "stable trials required for convergence")
-	rootCmd.Flags().IntVar(&minTrials, "min-trials", siftrank.DefaultMinTrials, "minimum trials before checking convergence")
-	rootCmd.Flags().StringVar(&elbowMethod, "elbow-method", string(siftrank.DefaultElbowMethod), "elbow detection method: curvature (default), perpendicular")
+	cmd.Flags().BoolVar(&noConverge, "no-converge", false, "disable early stopping based on convergence")
+	cmd.Flags().Float64Var(&elbowTolerance, "elbow-tolerance", siftrank.DefaultElbowTolerance, "elbow position tolerance (0.05 = 5%)")
+	cmd.Flags().IntVar(&stableTrials, "stable-trials", siftrank.DefaultStableTrials, "stable trials required for convergence")
+	cmd.Flags().IntVar(&minTrials, "min-trials", siftrank.DefaultMinTrials, "minimum trials before checking convergence")
+	cmd.Flags().StringVar(&elbowMethod, "elbow-method", string(siftrank.DefaultElbowMethod), "elbow detection method: curvature (default), perpendicular")
+
+	// Cache flags
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory for caching LLM responses across runs (seed defaults to 1 so re-runs hit the cache)")
+	cmd.Flags().BoolVar(&cacheReadOnly, "cache-read-only", false, "serve cached responses but never write new ones")
+	cmd.Flags().BoolVar(&cacheRefresh, "cache-refresh", false, "ignore cached responses and overwrite them")
+	cmd.Flags().DurationVar(&cacheTTL, "cache-ttl", 0, "ignore cached responses older than this (e.g. 24h, 0 = never expire)")
+
+	// Checkpoint flags
+	cmd.Flags().StringVar(&checkpointDir, "checkpoint", "", "directory to save progress to after every trial, for --resume (batch mode only)")
+	cmd.Flags().StringVar(&resumeDir, "resume", "", "continue the run checkpointed in this directory without repeating finished trials")
+
+	// Record/replay flags
+	cmd.Flags().StringVar(&recordFile, "record", "", "record every LLM call to a JSONL cassette file")
+	cmd.Flags().StringVar(&replayFile, "replay", "", "replay LLM responses from a cassette file instead of calling the provider")
+
+	// Pointwise flags
+	cmd.Flags().StringVar(&rubricFile, "rubric", "", "rubric file for pointwise mode")
+	cmd.Flags().Float64Var(&minScore, "min-score", 0, "drop documents whose mean pointwise score is below this (1-10, 0 = keep all)")
+	cmd.Flags().IntVar(&samples, "samples", siftrank.DefaultPointwiseSamples, "times each document is scored in pointwise mode (scores are averaged)")
+	cmd.Flags().IntVar(&scoreBatchSize, "score-batch-size", siftrank.DefaultScoreBatchSize, "documents scored per call in pointwise mode")
+	cmd.Flags().Float64Var(&blendWeight, "blend", 0, "weight of a listwise ranking blended into pointwise scores (0-1, 0 = scores only)")
+
+	// Multi-criteria flags
+	cmd.Flags().StringVar(&criteriaFile, "criteria", "", "YAML file of named prompts with weights, ranked separately and combined (e.g. @criteria.yaml)")
+	cmd.Flags().StringVar(&aggregation, "aggregation", string(siftrank.AggregationBorda), "how --criteria rankings are combined: borda (weighted mean position), plackett-luce (weighted fit to every batch)")
 
 	// Execution flags
-	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "log API calls without making them")
-	rootCmd.Flags().BoolVarP(&debug, "debug", "d", false, "enable debug logging")
-	rootCmd.Flags().BoolVarP(&relevance, "relevance", "r", false, "post-process each item by providing relevance justification (skips round 1)")
-	rootCmd.Flags().StringVar(&traceFile, "trace", "", "trace file path for streaming trial execution state (JSON Lines format)")
-	rootCmd.Flags().BoolVar(&watch, "watch", false, "enable live terminal visualization (logs suppressed unless --log is specified)")
-	rootCmd.Flags().BoolVar(&noMinimap, "no-minimap", false, "disable minimap panel in watch mode")
-	rootCmd.Flags().StringVar(&logFile, "log", "", "write logs to file instead of stderr")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "log API calls without making them")
+	cmd.Flags().BoolVarP(&debug, "debug", "d", false, "enable debug logging")
+	cmd.Flags().BoolVarP(&relevance, "relevance", "r", false, "post-process each item by providing relevance justification (skips round 1)")
+	cmd.Flags().StringVar(&rankMode, "mode", string(siftrank.ModeBatch), "ranking mode: batch (rank batches of documents), pairwise (compare pairs of documents in both orders, for small or high-stakes sets), pointwise (score each document from 1 to 10 against --rubric)")
+	cmd.Flags().StringVar(&traceFile, "trace", "", "trace file path for streaming trial execution state (JSON Lines format)")
+	cmd.Flags().BoolVar(&watch, "watch", false, "enable live terminal visualization (logs suppressed unless --log is specified)")
+	cmd.Flags().BoolVar(&noMinimap, "no-minimap", false, "disable minimap panel in watch mode")
+	cmd.Flags().StringVar(&logFile, "log", "", "write logs to file instead of stderr")
 
-	// Register template functions for flag grouping
-	cobra.AddTemplateFunc("FlagsInGroup", FlagsInGroup)
-	cobra.AddTemplateFunc("FilterFlags", FilterFlags)
-	cobra.AddTemplateFunc("FlagUsages", func(fs *pflag.FlagSet) string {
-		return fs.FlagUsages()
-	})
+	// Organize flags into groups
+	setFlagGroup(cmd, "options", "file", "prompt", "output", "output-format", "provider", "model", "mode", "rubric", "min-score", "criteria", "relevance", "compare", "pattern", "recursive", "include", "exclude", "gitignore", "max-file-size")
+	setFlagGroup(cmd, "visualization", "watch", "no-minimap")
+	setFlagGroup(cmd, "debug", "trace", "debug", "dry-run", "log", "record", "replay")
+	setFlagGroup(cmd, "advanced", "template", "json", "format", "record-separator", "whole-file", "id-field", "id-template", "duplicates", "base-url", "encoding", "effort", "input-price", "output-price", "pricing-file", "budget", "token-budget", "tokens", "batch-size", "max-trials", "concurrency", "ratio", "seed", "scoring", "batch-selection", "warmup-trials", "samples", "score-batch-size", "blend", "aggregation", "no-converge", "elbow-tolerance", "stable-trials", "min-trials", "elbow-method", "cache-dir", "cache-read-only", "cache-refresh", "cache-ttl", "checkpoint", "resume")
+}
 
-	// Set custom usage template
-	rootCmd.SetUsageTemplate(usageTemplate)
+// buildProviderConfig resolves the --provider flag into a ProviderConfig,
+// reading that provider's credentials from its environment variables.
+// --model and --base-url override the provider defaults.
+func buildProviderConfig(cmd *cobra.Command) (*siftrank.ProviderConfig, error) {
+	providerType, err := siftrank.ParseProviderType(providerName)
+	if err != nil {
+		return nil, err
+	}
 
-	// Organize flags into groups
-	setFlagGroup(rootCmd, "options", "file", "prompt", "output", "model", "relevance", "compare", "pattern")
-	setFlagGroup(rootCmd, "visualization", "watch", "no-minimap")
-	setFlagGroup(rootCmd, "debug", "trace", "debug", "dry-run", "log")
-	setFlagGroup(rootCmd, "advanced", "template", "json", "base-url", "encoding", "effort", "tokens", "batch-size", "max-trials", "concurrency", "ratio", "no-converge", "elbow-tolerance", "stable-trials", "min-trials", "elbow-method")
+	// The default model is an OpenAI model; other providers need an explicit one
+	if providerType != siftrank.ProviderTypeOpenAI && !cmd.Flags().Changed("model") {
+		return nil, fmt.Errorf("--model is required for provider %s", providerType)
+	}
+
+	providerConfig, err := siftrank.ProviderConfigFromEnv(providerType)
+	if err != nil {
+		return nil, err
+	}
+
+	providerConfig.Model = oaiModel
+	providerConfig.Encoding = encoding
+	providerConfig.Effort = effort
+	if oaiURL != "" {
+		providerConfig.BaseURL = oaiURL
+	}
+
+	return &providerConfig, nil
 }
 
-func run(cmd *cobra.Command, args []string) error {
-	// Set up logging
+// setupLogger creates the CLI logger from --debug, --log and --watch.
+// The returned function closes the log file, if one was opened.
+func setupLogger() (*slog.Logger, slog.Level, func(), error) {
 	logLevel := slog.LevelInfo
 	if debug {
 		logLevel = slog.LevelDebug
 	}
 
-	var logWriter *os.File
+	closeLog := func() {}
 	var logOutput io.Writer = os.Stderr
 	if logFile != "" {
 		validLogPath, err := validatePath(logFile)
 		if err != nil {
-			return fmt.Errorf("invalid log file path: %w", err)
+			return nil, logLevel, nil, fmt.Errorf("invalid log file path: %w", err)
 		}
 		// #nosec G304 - Path validated by validatePath (no traversal, symlinks resolved)
-		logWriter, err = os.OpenFile(validLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		logWriter, err := os.OpenFile(validLogPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
 		if err != nil {
-			return fmt.Errorf("failed to open log file: %w", err)
+			return nil, logLevel, nil, fmt.Errorf("failed to open log file: %w", err)
 		}
-		defer logWriter.Close()
+		closeLog = func() { logWriter.Close() }
 		logOutput = logWriter
 	} else if watch {
 		// Suppress logs when --watch is used without --log
@@ -339,9 +547,33 @@ func run(cmd *cobra.Command, args []string) error {
 		Level: logLevel,
 	})).With("component", "siftrank-cli")
 
+	return logger, logLevel, closeLog, nil
+}
+
+// buildConfig validates the ranking flags and assembles the ranker config
+func buildConfig(cmd *cobra.Command, logger *slog.Logger, logLevel slog.Level) (*siftrank.Config, error) {
 	// Validate refinement ratio
 	if refinementRatio < 0 || refinementRatio >= 1 {
-		return fmt.Errorf("refinement ratio must be >= 0 and < 1")
+		return nil, fmt.Errorf("refinement ratio must be >= 0 and < 1")
+	}
+
+	// Validate pricing
+	if inputPrice < 0 || outputPrice < 0 {
+		return nil, fmt.Errorf("token prices must be >= 0")
+	}
+	var pricing *siftrank.Pricing
+	if inputPrice > 0 || outputPrice > 0 {
+		pricing = &siftrank.Pricing{InputPerMillion: inputPrice, OutputPerMillion: outputPrice}
+	}
+	var pricingTable siftrank.PricingTable
+	if pricingFile != "" {
+		validPricingPath, err := validatePath(pricingFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pricing file path: %w", err)
+		}
+		if pricingTable, err = siftrank.LoadPricingFile(validPricingPath); err != nil {
+			return nil, err
+		}
 	}
 
 	// Load prompt from file if needed
@@ -350,33 +582,146 @@ func run(cmd *cobra.Command, args []string) error {
 		filePath := strings.TrimPrefix(userPrompt, "@")
 		validPromptPath, err := validatePath(filePath)
 		if err != nil {
-			return fmt.Errorf("invalid prompt file path: %w", err)
+			return nil, fmt.Errorf("invalid prompt file path: %w", err)
 		}
 		// #nosec G304 - Path validated by validatePath (no traversal, symlinks resolved)
 		content, err := os.ReadFile(validPromptPath)
 		if err != nil {
-			return fmt.Errorf("could not read initial prompt file: %w", err)
+			return nil, fmt.Errorf("could not read initial prompt file: %w", err)
 		}
 		userPrompt = string(content)
 	}
 
+	// Load rubric for pointwise mode
+	var rubric string
+	if rubricFile != "" {
+		validRubricPath, err := validatePath(rubricFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rubric file path: %w", err)
+		}
+		// #nosec G304 - Path validated by validatePath (no traversal, symlinks resolved)
+		content, err := os.ReadFile(validRubricPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read rubric file: %w", err)
+		}
+		rubric = string(content)
+	}
+
+	// Load criteria for multi-criteria ranking
+	var criteria []siftrank.Criterion
+	if criteriaFile != "" {
+		validCriteriaPath, err := validatePath(strings.TrimPrefix(criteriaFile, "@"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid criteria file path: %w", err)
+		}
+		if criteria, err = siftrank.LoadCriteriaFile(validCriteriaPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if forceJSON && inputFormat != "" {
+		return nil, fmt.Errorf("--json and --format are mutually exclusive")
+	}
+
+	// Validate record/replay paths
+	if recordFile != "" && replayFile != "" {
+		return nil, fmt.Errorf("--record and --replay are mutually exclusive")
+	}
+	var recordPath, replayPath string
+	if recordFile != "" {
+		var err error
+		if recordPath, err = validatePath(recordFile); err != nil {
+			return nil, fmt.Errorf("invalid record file path: %w", err)
+		}
+	}
+	if replayFile != "" {
+		var err error
+		if replayPath, err = validatePath(replayFile); err != nil {
+			return nil, fmt.Errorf("invalid replay file path: %w", err)
+		}
+	}
+
+	// Validate checkpoint directories
+	var checkpointPath, resumePath string
+	if checkpointDir != "" {
+		var err error
+		if checkpointPath, err = validateDirPath(checkpointDir); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint directory: %w", err)
+		}
+	}
+	if resumeDir != "" {
+		var err error
+		if resumePath, err = validateDirPath(resumeDir); err != nil {
+			return nil, fmt.Errorf("invalid resume directory: %w", err)
+		}
+	}
+
+	// Resolve provider and its credentials (--compare builds its own providers,
+	// --replay needs none)
+	var providerConfig *siftrank.ProviderConfig
+	if compareModels == "" && replayPath == "" {
+		var err error
+		providerConfig, err = buildProviderConfig(cmd)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Resolve cache mode
+	cacheMode := siftrank.CacheModeReadWrite
+	if cacheReadOnly && cacheRefresh {
+		return nil, fmt.Errorf("--cache-read-only and --cache-refresh are mutually exclusive")
+	}
+	if cacheReadOnly {
+		cacheMode = siftrank.CacheModeReadOnly
+	} else if cacheRefresh {
+		cacheMode = siftrank.CacheModeRefresh
+	}
+	if cacheDir == "" && (cacheReadOnly || cacheRefresh || cacheTTL != 0) {
+		return nil, fmt.Errorf("cache flags require --cache-dir")
+	}
+
 	// Create config
-	config := &siftrank.Config{
+	return &siftrank.Config{
 		InitialPrompt:   userPrompt,
 		BatchSize:       batchSize,
 		NumTrials:       maxTrials,
 		Concurrency:     concurrency,
-		OpenAIModel:     oaiModel,
+		ProviderConfig:  providerConfig,
 		RefinementRatio: refinementRatio,
-		OpenAIKey:       os.Getenv("OPENAI_API_KEY"),
-		OpenAIAPIURL:    oaiURL,
+		Seed:            seed,
+		ScoringModel:    siftrank.ScoringModel(scoringModel),
+		BatchSelection:  siftrank.BatchSelection(batchSelection),
+		Mode:            siftrank.RankMode(rankMode),
+		Rubric:          rubric,
+		MinScore:        minScore,
+		BlendWeight:     blendWeight,
+		Criteria:        criteria,
+		Pricing:         pricing,
+		PricingTable:    pricingTable,
+		MaxCostUSD:      maxCostUSD,
+		MaxTokens:       tokenBudget,
 		Encoding:        encoding,
 		BatchTokens:     batchTokens,
 		DryRun:          dryRun,
 		TracePath:       traceFile,
+		InputFormat:     siftrank.InputFormat(inputFormat),
+		RecordSeparator: recordSep,
+		WholeFile:       wholeFile,
+		SourceDir:       inputSourceDir(),
+		IDField:         idField,
+		IDTemplate:      idTemplate,
+		Duplicates:      siftrank.DuplicatePolicy(duplicates),
 		Relevance:       relevance,
 		Effort:          effort,
 		CompareModels:   compareModels,
+		CacheDir:        cacheDir,
+		CacheMode:       cacheMode,
+		CacheTTL:        cacheTTL,
+		CheckpointDir:   checkpointPath,
+		ResumeDir:       resumePath,
+		RecordPath:      recordPath,
+		ReplayPath:      replayPath,
 		LogLevel:        logLevel,
 		Logger:          logger,
 		Watch:           watch,
@@ -387,57 +732,99 @@ func run(cmd *cobra.Command, args []string) error {
 		StableTrials:      stableTrials,
 		MinTrials:         minTrials,
 		ElbowMethod:       siftrank.ElbowMethod(elbowMethod),
-	}
 
-	// Create ranker
-	ranker, err := siftrank.NewRanker(config)
+		AdaptiveWarmupTrials: warmupTrials,
+		PointwiseSamples:     samples,
+		ScoreBatchSize:       scoreBatchSize,
+		CriteriaAggregation:  siftrank.CriteriaAggregation(aggregation),
+	}, nil
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	logger, logLevel, closeLog, err := setupLogger()
 	if err != nil {
-		return fmt.Errorf("failed to create ranker: %w", err)
+		return err
 	}
+	defer closeLog()
 
-	var finalResults []*siftrank.RankedDocument
+	// Validate output format
+	if outputFormat != outputFormatDocuments && outputFormat != outputFormatEnvelope {
+		return fmt.Errorf("invalid output format %q (expected %s or %s)", outputFormat, outputFormatDocuments, outputFormatEnvelope)
+	}
 
-	// Validate input path (file or directory) and receive open file descriptor
-	inputFD, isDir, err := validateInputPath(inputFile)
+	fromStdin, err := inputFromStdin()
 	if err != nil {
-		return fmt.Errorf("invalid input path: %w", err)
+		return err
 	}
-	defer inputFD.Close()
-
-	// Get validated path from file descriptor
-	validPath := inputFD.Name()
 
-	if isDir {
-		// Directory input: enumerate files with pattern
-		logger.Info("processing directory", "path", validPath, "pattern", filePattern)
+	config, err := buildConfig(cmd, logger, logLevel)
+	if err != nil {
+		return err
+	}
 
-		filePaths, err := enumerateFiles(validPath, filePattern)
-		if err != nil {
-			return fmt.Errorf("failed to enumerate files: %w", err)
+	// Create ranker
+	ranker, err := siftrank.NewRanker(config)
+	if err != nil {
+		return fmt.Errorf("failed to create ranker: %w", err)
+	}
+	defer func() {
+		if err := ranker.Close(); err != nil {
+			logger.Warn("Failed to close ranker", "error", err)
 		}
+	}()
+	logger.Info("ranker seed", "seed", ranker.Seed())
 
-		logger.Info("files discovered", "count", len(filePaths))
+	// Stop ranking on interrupt and keep the partial results
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-		finalResults, err = ranker.RankFromFiles(filePaths, inputTemplate, forceJSON)
-		if err != nil {
-			return fmt.Errorf("failed to rank from directory: %w", err)
-		}
+	var finalResult *siftrank.RankResult
+	var canceledErr *siftrank.CanceledError
+
+	if fromStdin {
+		// Stdin input: parsed as text, JSON (--json) or --format
+		logger.Info("reading input from stdin")
+		finalResult, err = ranker.RankFromReaderResult(ctx, os.Stdin, inputTemplate, forceJSON)
 	} else {
-		// File input: pass file descriptor to RankFromFile
-		finalResults, err = ranker.RankFromFile(validPath, inputFD, inputTemplate, forceJSON)
-		if err != nil {
-			return fmt.Errorf("failed to rank from file: %w", err)
+		// File or directory input: a directory is enumerated with --pattern
+		var filePaths []string
+		if filePaths, err = inputFiles(); err != nil {
+			return err
 		}
+		logger.Info("files discovered", "count", len(filePaths), "pattern", filePattern, "recursive", recursive)
+		finalResult, err = ranker.RankFromFilesResult(ctx, filePaths, inputTemplate, forceJSON)
+	}
+	if err != nil && !errors.As(err, &canceledErr) {
+		return fmt.Errorf("failed to rank documents: %w", err)
+	}
+
+	if err := writeResult(finalResult, config.DryRun, logger); err != nil {
+		return err
 	}
 
+	// Partial results were written; still report the interruption
+	if canceledErr != nil {
+		return canceledErr
+	}
+
+	return nil
+}
+
+// writeResult prints the ranking in --output-format (unless dry run) and
+// writes it to --output
+func writeResult(finalResult *siftrank.RankResult, dryRun bool, logger *slog.Logger) error {
 	// Marshal results to JSON
-	jsonResults, err := json.MarshalIndent(finalResults, "", "  ")
+	var output any = finalResult.Documents
+	if outputFormat == outputFormatEnvelope {
+		output = finalResult
+	}
+	jsonResults, err := json.MarshalIndent(output, "", "  ")
 	if err != nil {
 		return fmt.Errorf("could not marshal results to JSON: %w", err)
 	}
 
 	// Print results to stdout (unless dry run)
-	if !config.DryRun {
+	if !dryRun {
 		fmt.Println(string(jsonResults))
 	}
 
@@ -453,9 +840,180 @@ func run(cmd *cobra.Command, args []string) error {
 		logger.Info("results written to file", "file", validOutputPath)
 	}
 
+	if finalResult.BudgetExceeded {
+		logger.Warn("budget reached, results reflect the ranking so far", "tokens", finalResult.Usage.TotalTokens())
+	}
+
 	return nil
 }
 
+// runInsert ranks the documents of --file into the --base ranking and writes
+// the merged ranking like run
+func runInsert(cmd *cobra.Command, args []string) error {
+	logger, logLevel, closeLog, err := setupLogger()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	if outputFormat != outputFormatDocuments && outputFormat != outputFormatEnvelope {
+		return fmt.Errorf("invalid output format %q (expected %s or %s)", outputFormat, outputFormatDocuments, outputFormatEnvelope)
+	}
+
+	fromStdin, err := inputFromStdin()
+	if err != nil {
+		return err
+	}
+
+	config, err := buildConfig(cmd, logger, logLevel)
+	if err != nil {
+		return err
+	}
+
+	validBasePath, err := validatePath(baseFile)
+	if err != nil {
+		return fmt.Errorf("invalid base file path: %w", err)
+	}
+	base, err := siftrank.LoadRankedDocuments(validBasePath)
+	if err != nil {
+		return err
+	}
+
+	ranker, err := siftrank.NewRanker(config)
+	if err != nil {
+		return fmt.Errorf("failed to create ranker: %w", err)
+	}
+	defer func() {
+		if err := ranker.Close(); err != nil {
+			logger.Warn("Failed to close ranker", "error", err)
+		}
+	}()
+	logger.Info("ranker seed", "seed", ranker.Seed())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var finalResult *siftrank.RankResult
+	if fromStdin {
+		finalResult, err = ranker.InsertFromReaderResult(ctx, base, os.Stdin, inputTemplate, forceJSON)
+	} else {
+		var filePaths []string
+		if filePaths, err = inputFiles(); err != nil {
+			return err
+		}
+		finalResult, err = ranker.InsertFromFilesResult(ctx, base, filePaths, inputTemplate, forceJSON)
+	}
+
+	var canceledErr *siftrank.CanceledError
+	if err != nil && !errors.As(err, &canceledErr) {
+		return fmt.Errorf("failed to insert documents: %w", err)
+	}
+
+	if err := writeResult(finalResult, config.DryRun, logger); err != nil {
+		return err
+	}
+	if canceledErr != nil {
+		return canceledErr
+	}
+	return nil
+}
+
+// runEstimate projects a ranking run from the same flags without calling the
+// LLM: a table on stderr and the JSON estimate on stdout (and --output)
+func runEstimate(cmd *cobra.Command, args []string) error {
+	logger, logLevel, closeLog, err := setupLogger()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	fromStdin, err := inputFromStdin()
+	if err != nil {
+		return err
+	}
+
+	config, err := buildConfig(cmd, logger, logLevel)
+	if err != nil {
+		return err
+	}
+
+	// The estimator only needs the tokenizer, not the provider or its API key
+	ranker, err := siftrank.NewEstimator(config)
+	if err != nil {
+		return fmt.Errorf("failed to create estimator: %w", err)
+	}
+	defer func() {
+		if err := ranker.Close(); err != nil {
+			logger.Warn("Failed to close ranker", "error", err)
+		}
+	}()
+
+	var estimate *siftrank.Estimate
+	if fromStdin {
+		estimate, err = ranker.EstimateFromReader(os.Stdin, inputTemplate, forceJSON)
+	} else {
+		var filePaths []string
+		if filePaths, err = inputFiles(); err != nil {
+			return err
+		}
+		estimate, err = ranker.EstimateFromFiles(filePaths, inputTemplate, forceJSON)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to estimate: %w", err)
+	}
+
+	printEstimate(os.Stderr, estimate)
+
+	jsonEstimate, err := json.MarshalIndent(estimate, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal estimate to JSON: %w", err)
+	}
+	fmt.Println(string(jsonEstimate))
+
+	if outputFile != "" {
+		validOutputPath, err := validatePath(outputFile)
+		if err != nil {
+			return fmt.Errorf("invalid output file path: %w", err)
+		}
+		if err := os.WriteFile(validOutputPath, jsonEstimate, 0600); err != nil {
+			return fmt.Errorf("failed to write output file: %w", err)
+		}
+		logger.Info("estimate written to file", "file", validOutputPath)
+	}
+
+	return nil
+}
+
+// printEstimate writes a per-round table of expected and worst-case calls
+// and tokens
+func printEstimate(w io.Writer, est *siftrank.Estimate) {
+	fmt.Fprintf(w, "%d documents, batch size %d, %d prompt tokens per batch\n\n", est.NumDocuments, est.BatchSize, est.PromptTokens)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "round\tdocs\tbatches/trial\ttrials\tcalls\tmax calls\ttokens\tmax tokens\t")
+	for _, re := range est.Rounds {
+		round := strconv.Itoa(re.Round)
+		if re.Criterion != "" {
+			round = re.Criterion + " " + round
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d-%d\t%d\t%d\t%d\t%d\t\n",
+			round, re.Documents, re.BatchesPerTrial, re.ExpectedTrials, re.MaxTrials,
+			re.ExpectedCalls, re.WorstCaseCalls, re.ExpectedUsage.TotalTokens(), re.WorstCaseUsage.TotalTokens())
+	}
+	if est.RelevanceCalls > 0 {
+		fmt.Fprintf(tw, "relevance\t%d\t\t\t%d\t%d\t\t\t\n", est.RelevanceCalls, est.RelevanceCalls, est.RelevanceCalls)
+	}
+	fmt.Fprintf(tw, "total\t\t\t\t%d\t%d\t%d\t%d\t\n",
+		est.Expected.Calls, est.WorstCase.Calls, est.Expected.Usage.TotalTokens(), est.WorstCase.Usage.TotalTokens())
+	tw.Flush()
+
+	if est.Expected.CostUSD != nil && est.WorstCase.CostUSD != nil {
+		fmt.Fprintf(w, "\nestimated cost: $%.4f expected, $%.4f worst case\n", *est.Expected.CostUSD, *est.WorstCase.CostUSD)
+	} else {
+		fmt.Fprintln(w, "\nestimated cost: unknown (no pricing for this model; see --input-price, --output-price, --pricing-file)")
+	}
+}
+
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -6,10 +6,12 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/meganerd/siftrank/pkg/siftrank"
 )
 
-// TestEnumerateFiles_GlobPattern tests glob pattern matching
-func TestEnumerateFiles_GlobPattern(t *testing.T) {
+// TestWalkFiles_GlobPattern tests glob pattern matching
+func TestWalkFiles_GlobPattern(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	// Create mixed files
@@ -24,13 +26,13 @@ func TestEnumerateFiles_GlobPattern(t *testing.T) {
 	}
 
 	// Test *.json pattern
-	files, err := enumerateFiles(tmpDir, "*.json")
+	files, err := walkFiles(tmpDir, fileFilter{Pattern: "*.json"})
 	if err != nil {
-		t.Fatalf("enumerateFiles() unexpected error: %v", err)
+		t.Fatalf("walkFiles() unexpected error: %v", err)
 	}
 
 	if len(files) != 2 {
-		t.Errorf("enumerateFiles() expected 2 files, got %d", len(files))
+		t.Errorf("walkFiles() expected 2 files, got %d", len(files))
 	}
 
 	if !strings.Contains(files[0], "data1.json") {
@@ -41,26 +43,26 @@ func TestEnumerateFiles_GlobPattern(t *testing.T) {
 	}
 }
 
-// TestEnumerateFiles_NoMatches tests error when no files match
-func TestEnumerateFiles_NoMatches(t *testing.T) {
+// TestWalkFiles_NoMatches tests error when no files match
+func TestWalkFiles_NoMatches(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	if err := os.WriteFile(filepath.Join(tmpDir, "file.txt"), []byte("text"), 0600); err != nil {
 		t.Fatalf("Failed to create file.txt: %v", err)
 	}
 
-	_, err := enumerateFiles(tmpDir, "*.json")
+	_, err := walkFiles(tmpDir, fileFilter{Pattern: "*.json"})
 	if err == nil {
-		t.Error("enumerateFiles() expected error for no matches, got nil")
+		t.Error("walkFiles() expected error for no matches, got nil")
 	}
 
 	if err != nil && !strings.Contains(err.Error(), "no files matched pattern") {
-		t.Errorf("enumerateFiles() error should contain 'no files matched pattern', got: %v", err)
+		t.Errorf("walkFiles() error should contain 'no files matched pattern', got: %v", err)
 	}
 }
 
-// TestEnumerateFiles_AllFiles tests matching all files with "*" pattern
-func TestEnumerateFiles_AllFiles(t *testing.T) {
+// TestWalkFiles_AllFiles tests matching all files with "*" pattern
+func TestWalkFiles_AllFiles(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	if err := os.WriteFile(filepath.Join(tmpDir, "a.txt"), []byte("a"), 0600); err != nil {
@@ -73,18 +75,18 @@ func TestEnumerateFiles_AllFiles(t *testing.T) {
 		t.Fatalf("Failed to create c.md: %v", err)
 	}
 
-	files, err := enumerateFiles(tmpDir, "*")
+	files, err := walkFiles(tmpDir, fileFilter{Pattern: "*"})
 	if err != nil {
-		t.Fatalf("enumerateFiles() unexpected error: %v", err)
+		t.Fatalf("walkFiles() unexpected error: %v", err)
 	}
 
 	if len(files) != 3 {
-		t.Errorf("enumerateFiles() expected 3 files, got %d", len(files))
+		t.Errorf("walkFiles() expected 3 files, got %d", len(files))
 	}
 }
 
-// TestEnumerateFiles_SkipsSubdirectories tests that subdirectories are skipped
-func TestEnumerateFiles_SkipsSubdirectories(t *testing.T) {
+// TestWalkFiles_SkipsSubdirectories tests that subdirectories are skipped
+func TestWalkFiles_SkipsSubdirectories(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	// Create a subdirectory
@@ -101,13 +103,13 @@ func TestEnumerateFiles_SkipsSubdirectories(t *testing.T) {
 		t.Fatalf("Failed to create nested.txt: %v", err)
 	}
 
-	files, err := enumerateFiles(tmpDir, "*.txt")
+	files, err := walkFiles(tmpDir, fileFilter{Pattern: "*.txt"})
 	if err != nil {
-		t.Fatalf("enumerateFiles() unexpected error: %v", err)
+		t.Fatalf("walkFiles() unexpected error: %v", err)
 	}
 
 	if len(files) != 1 {
-		t.Errorf("enumerateFiles() expected 1 file, got %d", len(files))
+		t.Errorf("walkFiles() expected 1 file, got %d", len(files))
 	}
 
 	if !strings.Contains(files[0], "file.txt") {
@@ -239,6 +241,34 @@ func TestValidatePath_Directory(t *testing.T) {
 	}
 }
 
+// TestValidateDirPath tests validateDirPath accepts existing and missing
+// directories and rejects files
+func TestValidateDirPath(t *testing.T) {
+	tmpDir := t.TempDir()
+	tmpFile := filepath.Join(tmpDir, "checkpoint.json")
+	if err := os.WriteFile(tmpFile, []byte("{}"), 0600); err != nil {
+		t.Fatalf("Failed to create checkpoint.json: %v", err)
+	}
+
+	if _, err := validateDirPath(tmpDir); err != nil {
+		t.Errorf("validateDirPath() unexpected error for directory: %v", err)
+	}
+
+	newDir := filepath.Join(tmpDir, "run")
+	path, err := validateDirPath(newDir)
+	if err != nil {
+		t.Fatalf("validateDirPath() unexpected error for missing directory: %v", err)
+	}
+	if path != newDir {
+		t.Errorf("validateDirPath() = %q, want %q", path, newDir)
+	}
+
+	_, err = validateDirPath(tmpFile)
+	if err == nil || !strings.Contains(err.Error(), "is a file") {
+		t.Errorf("validateDirPath() expected 'is a file' error, got: %v", err)
+	}
+}
+
 // TestValidatePath_NonExistent tests validatePath with non-existent file (for output)
 func TestValidatePath_NonExistent(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -259,8 +289,8 @@ func TestValidatePath_NonExistent(t *testing.T) {
 	}
 }
 
-// TestEnumerateFiles_InvalidGlobPattern tests error handling for invalid glob patterns
-func TestEnumerateFiles_InvalidGlobPattern(t *testing.T) {
+// TestWalkFiles_InvalidGlobPattern tests error handling for invalid glob patterns
+func TestWalkFiles_InvalidGlobPattern(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	// Create a file so the directory isn't empty
@@ -269,33 +299,33 @@ func TestEnumerateFiles_InvalidGlobPattern(t *testing.T) {
 	}
 
 	// Invalid glob pattern (unmatched bracket)
-	_, err := enumerateFiles(tmpDir, "[invalid")
+	_, err := walkFiles(tmpDir, fileFilter{Pattern: "[invalid"})
 	if err == nil {
-		t.Error("enumerateFiles() expected error for invalid glob pattern, got nil")
+		t.Error("walkFiles() expected error for invalid glob pattern, got nil")
 	}
 
 	if err != nil && !strings.Contains(err.Error(), "invalid glob pattern") {
-		t.Errorf("enumerateFiles() error should contain 'invalid glob pattern', got: %v", err)
+		t.Errorf("walkFiles() error should contain 'invalid glob pattern', got: %v", err)
 	}
 }
 
-// TestEnumerateFiles_EmptyDirectory tests error when directory has no files
-func TestEnumerateFiles_EmptyDirectory(t *testing.T) {
+// TestWalkFiles_EmptyDirectory tests error when directory has no files
+func TestWalkFiles_EmptyDirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	// Directory exists but has no files
-	_, err := enumerateFiles(tmpDir, "*")
+	_, err := walkFiles(tmpDir, fileFilter{Pattern: "*"})
 	if err == nil {
-		t.Error("enumerateFiles() expected error for empty directory, got nil")
+		t.Error("walkFiles() expected error for empty directory, got nil")
 	}
 
 	if err != nil && !strings.Contains(err.Error(), "no files matched pattern") {
-		t.Errorf("enumerateFiles() error should contain 'no files matched pattern', got: %v", err)
+		t.Errorf("walkFiles() error should contain 'no files matched pattern', got: %v", err)
 	}
 }
 
-// TestEnumerateFiles_SortedOutput tests that output is deterministically sorted
-func TestEnumerateFiles_SortedOutput(t *testing.T) {
+// TestWalkFiles_SortedOutput tests that output is deterministically sorted
+func TestWalkFiles_SortedOutput(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	// Create files in non-alphabetical order
@@ -309,13 +339,13 @@ func TestEnumerateFiles_SortedOutput(t *testing.T) {
 		t.Fatalf("Failed to create mango.txt: %v", err)
 	}
 
-	files, err := enumerateFiles(tmpDir, "*.txt")
+	files, err := walkFiles(tmpDir, fileFilter{Pattern: "*.txt"})
 	if err != nil {
-		t.Fatalf("enumerateFiles() unexpected error: %v", err)
+		t.Fatalf("walkFiles() unexpected error: %v", err)
 	}
 
 	if len(files) != 3 {
-		t.Fatalf("enumerateFiles() expected 3 files, got %d", len(files))
+		t.Fatalf("walkFiles() expected 3 files, got %d", len(files))
 	}
 
 	// Verify sorted order: apple, mango, zebra
@@ -330,8 +360,8 @@ func TestEnumerateFiles_SortedOutput(t *testing.T) {
 	}
 }
 
-// TestEnumerateFiles_ExceedsLimit tests error when file count exceeds limit
-func TestEnumerateFiles_ExceedsLimit(t *testing.T) {
+// TestWalkFiles_ExceedsLimit tests error when file count exceeds limit
+func TestWalkFiles_ExceedsLimit(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	// Create 1001 files (exceeds limit of 1000)
@@ -342,7 +372,7 @@ func TestEnumerateFiles_ExceedsLimit(t *testing.T) {
 		}
 	}
 
-	_, err := enumerateFiles(tmpDir, "*.txt")
+	_, err := walkFiles(tmpDir, fileFilter{Pattern: "*.txt"})
 
 	if err == nil {
 		t.Fatal("Expected error for directory exceeding file limit, got nil")
@@ -354,8 +384,8 @@ func TestEnumerateFiles_ExceedsLimit(t *testing.T) {
 	}
 }
 
-// TestEnumerateFiles_AtLimit tests success when file count equals limit
-func TestEnumerateFiles_AtLimit(t *testing.T) {
+// TestWalkFiles_AtLimit tests success when file count equals limit
+func TestWalkFiles_AtLimit(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	// Create exactly 1000 files (at the limit)
@@ -366,7 +396,7 @@ func TestEnumerateFiles_AtLimit(t *testing.T) {
 		}
 	}
 
-	files, err := enumerateFiles(tmpDir, "*.txt")
+	files, err := walkFiles(tmpDir, fileFilter{Pattern: "*.txt"})
 
 	if err != nil {
 		t.Fatalf("Expected success for directory at file limit, got error: %v", err)
@@ -394,7 +424,7 @@ func TestErrorMessages_NoPathDisclosure(t *testing.T) {
 	if err := os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("data"), 0600); err != nil {
 		t.Fatalf("Failed to create test.txt: %v", err)
 	}
-	_, err = enumerateFiles(tmpDir, "*.json")
+	_, err = walkFiles(tmpDir, fileFilter{Pattern: "*.json"})
 	if err == nil {
 		t.Fatal("Expected error for no matches")
 	}
@@ -480,9 +510,9 @@ func TestLargeDirectory_Integration_AtLimit(t *testing.T) {
 	}
 
 	// Enumerate files with glob pattern
-	files, err := enumerateFiles(dirFD.Name(), "*.txt")
+	files, err := walkFiles(dirFD.Name(), fileFilter{Pattern: "*.txt"})
 	if err != nil {
-		t.Fatalf("enumerateFiles() failed: %v", err)
+		t.Fatalf("walkFiles() failed: %v", err)
 	}
 
 	if len(files) != 1000 {
@@ -526,7 +556,7 @@ func TestLargeDirectory_Integration_ExceedsLimit(t *testing.T) {
 	}
 
 	// Enumerate files should fail due to file count limit
-	_, err = enumerateFiles(dirFD.Name(), "*.txt")
+	_, err = walkFiles(dirFD.Name(), fileFilter{Pattern: "*.txt"})
 	if err == nil {
 		t.Fatal("Expected error for directory exceeding file limit, got nil")
 	}
@@ -572,36 +602,36 @@ func TestLargeDirectory_Integration_GlobFiltering(t *testing.T) {
 	}
 
 	// Test 1: Filter only .txt files
-	txtFiles, err := enumerateFiles(dirFD.Name(), "*.txt")
+	txtFiles, err := walkFiles(dirFD.Name(), fileFilter{Pattern: "*.txt"})
 	if err != nil {
-		t.Fatalf("enumerateFiles(*.txt) failed: %v", err)
+		t.Fatalf("walkFiles(*.txt) failed: %v", err)
 	}
 	if len(txtFiles) != 500 {
 		t.Errorf("Expected 500 .txt files, got %d", len(txtFiles))
 	}
 
 	// Test 2: Filter only .json files
-	jsonFiles, err := enumerateFiles(dirFD.Name(), "*.json")
+	jsonFiles, err := walkFiles(dirFD.Name(), fileFilter{Pattern: "*.json"})
 	if err != nil {
-		t.Fatalf("enumerateFiles(*.json) failed: %v", err)
+		t.Fatalf("walkFiles(*.json) failed: %v", err)
 	}
 	if len(jsonFiles) != 500 {
 		t.Errorf("Expected 500 .json files, got %d", len(jsonFiles))
 	}
 
 	// Test 3: Match all files with "*" pattern
-	allFiles, err := enumerateFiles(dirFD.Name(), "*")
+	allFiles, err := walkFiles(dirFD.Name(), fileFilter{Pattern: "*"})
 	if err != nil {
-		t.Fatalf("enumerateFiles(*) failed: %v", err)
+		t.Fatalf("walkFiles(*) failed: %v", err)
 	}
 	if len(allFiles) != 1000 {
 		t.Errorf("Expected 1000 total files, got %d", len(allFiles))
 	}
 
 	// Test 4: Specific pattern (doc*.txt should match all txt files starting with "doc")
-	docFiles, err := enumerateFiles(dirFD.Name(), "doc*.txt")
+	docFiles, err := walkFiles(dirFD.Name(), fileFilter{Pattern: "doc*.txt"})
 	if err != nil {
-		t.Fatalf("enumerateFiles(doc*.txt) failed: %v", err)
+		t.Fatalf("walkFiles(doc*.txt) failed: %v", err)
 	}
 	if len(docFiles) != 500 {
 		t.Errorf("Expected 500 doc*.txt files, got %d", len(docFiles))
@@ -647,9 +677,9 @@ func TestLargeDirectory_Integration_MixedSizes(t *testing.T) {
 	}
 
 	// Enumerate all files
-	files, err := enumerateFiles(dirFD.Name(), "*.txt")
+	files, err := walkFiles(dirFD.Name(), fileFilter{Pattern: "*.txt"})
 	if err != nil {
-		t.Fatalf("enumerateFiles() failed: %v", err)
+		t.Fatalf("walkFiles() failed: %v", err)
 	}
 
 	if len(files) != 100 {
@@ -664,3 +694,242 @@ func TestLargeDirectory_Integration_MixedSizes(t *testing.T) {
 		t.Errorf("Expected last file to be doc099.txt, got %s", files[99])
 	}
 }
+
+// writeTree creates files (slash-separated paths) under dir
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+}
+
+// relFiles returns files relative to dir, with '/' separators
+func relFiles(t *testing.T, dir string, files []string) []string {
+	t.Helper()
+	var rel []string
+	for _, file := range files {
+		r, err := filepath.Rel(dir, file)
+		if err != nil {
+			t.Fatalf("filepath.Rel failed: %v", err)
+		}
+		rel = append(rel, filepath.ToSlash(r))
+	}
+	return rel
+}
+
+func TestWalkFiles_Recursive(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTree(t, tmpDir, map[string]string{
+		"main.go":               "package main",
+		"README.md":             "# readme",
+		"pkg/a/a.go":            "package a",
+		"pkg/a/a_test.go":       "package a",
+		"pkg/b/b.go":            "package b",
+		"vendor/dep/dep.go":     "package dep",
+		"pkg/a/testdata/big.go": strings.Repeat("x", 100),
+	})
+
+	files, err := walkFiles(tmpDir, fileFilter{Pattern: "*.go"})
+	if err != nil {
+		t.Fatalf("walkFiles() unexpected error: %v", err)
+	}
+	if got := relFiles(t, tmpDir, files); strings.Join(got, ",") != "main.go" {
+		t.Errorf("expected only the top-level file without --recursive, got %v", got)
+	}
+
+	files, err = walkFiles(tmpDir, fileFilter{
+		Pattern:   "*.go",
+		Exclude:   []string{"vendor", "**/*_test.go"},
+		Recursive: true,
+		MaxSize:   50,
+	})
+	if err != nil {
+		t.Fatalf("walkFiles() unexpected error: %v", err)
+	}
+	want := "main.go,pkg/a/a.go,pkg/b/b.go"
+	if got := relFiles(t, tmpDir, files); strings.Join(got, ",") != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+
+	files, err = walkFiles(tmpDir, fileFilter{Pattern: "*", Include: []string{"pkg/**/a*.go", "*.md"}, Recursive: true})
+	if err != nil {
+		t.Fatalf("walkFiles() unexpected error: %v", err)
+	}
+	want = "README.md,pkg/a/a.go,pkg/a/a_test.go"
+	if got := relFiles(t, tmpDir, files); strings.Join(got, ",") != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+
+	if _, err := walkFiles(tmpDir, fileFilter{Pattern: "*", Exclude: []string{"[bad"}}); err == nil || !strings.Contains(err.Error(), "invalid glob pattern") {
+		t.Errorf("expected an invalid glob error, got %v", err)
+	}
+}
+
+func TestWalkFiles_GitIgnore(t *testing.T) {
+	tmpDir := t.TempDir()
+	writeTree(t, tmpDir, map[string]string{
+		".gitignore":          "*.log\n/build/\n!keep.log\n",
+		".git/config":         "[core]",
+		"app.go":              "package app",
+		"debug.log":           "noise",
+		"keep.log":            "signal",
+		"build/out.go":        "package out",
+		"src/build/gen.go":    "package gen",
+		"src/.gitignore":      "gen.go\n",
+		"src/lib/gen.go":      "package lib",
+		"src/lib/handler.log": "noise",
+	})
+
+	files, err := walkFiles(tmpDir, fileFilter{Pattern: "*", Recursive: true, GitIgnore: true})
+	if err != nil {
+		t.Fatalf("walkFiles() unexpected error: %v", err)
+	}
+	want := ".gitignore,app.go,keep.log,src/.gitignore"
+	if got := relFiles(t, tmpDir, files); strings.Join(got, ",") != want {
+		t.Errorf("expected %s, got %v", want, got)
+	}
+
+	files, err = walkFiles(tmpDir, fileFilter{Pattern: "*.go", Recursive: true})
+	if err != nil {
+		t.Fatalf("walkFiles() unexpected error: %v", err)
+	}
+	if len(files) != 4 {
+		t.Errorf("expected .gitignore files to be ignored without --gitignore, got %v", relFiles(t, tmpDir, files))
+	}
+}
+
+func TestWalkFiles_SymlinkedDirectoryNotFollowed(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := t.TempDir()
+	writeTree(t, tmpDir, map[string]string{"inside.txt": "in"})
+	writeTree(t, outside, map[string]string{"secret.txt": "out"})
+	if err := os.Symlink(outside, filepath.Join(tmpDir, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	files, err := walkFiles(tmpDir, fileFilter{Pattern: "*", Recursive: true})
+	if err != nil {
+		t.Fatalf("walkFiles() unexpected error: %v", err)
+	}
+	if got := relFiles(t, tmpDir, files); strings.Join(got, ",") != "inside.txt" {
+		t.Errorf("expected the symlinked directory to be skipped, got %v", got)
+	}
+}
+
+func TestWalkFiles_LimitPerDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i <= MaxFilesPerDirectory; i++ {
+		files[fmt.Sprintf("nested/file%04d.txt", i)] = "data"
+	}
+	writeTree(t, tmpDir, files)
+
+	_, err := walkFiles(tmpDir, fileFilter{Pattern: "*.txt", Recursive: true})
+	if err == nil || !strings.Contains(err.Error(), "too many matching files") {
+		t.Errorf("expected the limit to apply to subdirectories, got %v", err)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.go", "a/b/c.go", true},
+		{"*.go", "c.txt", false},
+		{"a/*.go", "a/c.go", true},
+		{"a/*.go", "a/b/c.go", false},
+		{"a/**/*.go", "a/c.go", true},
+		{"a/**/*.go", "a/b/c/d.go", true},
+		{"**/testdata", "x/testdata", true},
+		{"/top.go", "top.go", true},
+		{"/top.go", "sub/top.go", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestInputFromStdin(t *testing.T) {
+	defer func(file string, whole bool, stdin *os.File) {
+		inputFile, wholeFile, os.Stdin = file, whole, stdin
+	}(inputFile, wholeFile, os.Stdin)
+
+	inputFile, wholeFile = "data.txt", false
+	if fromStdin, err := inputFromStdin(); err != nil || fromStdin {
+		t.Errorf("expected --file to be read as a path, got %v (%v)", fromStdin, err)
+	}
+
+	inputFile = "-"
+	if fromStdin, err := inputFromStdin(); err != nil || !fromStdin {
+		t.Errorf("expected - to read stdin, got %v (%v)", fromStdin, err)
+	}
+
+	wholeFile = true
+	if _, err := inputFromStdin(); err == nil {
+		t.Error("expected --whole-file to be rejected for stdin")
+	}
+	wholeFile = false
+
+	// Without --file, stdin is read only if something is piped to it
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe failed: %v", err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+	inputFile, os.Stdin = "", reader
+	if fromStdin, err := inputFromStdin(); err != nil || !fromStdin {
+		t.Errorf("expected piped stdin to be read, got %v (%v)", fromStdin, err)
+	}
+
+	// Character devices (terminals, /dev/null) have nothing piped
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", os.DevNull, err)
+	}
+	defer devNull.Close()
+	os.Stdin = devNull
+	if _, err := inputFromStdin(); err == nil {
+		t.Error("expected an error without --file when nothing is piped to stdin")
+	}
+}
+
+func TestPrintEstimate(t *testing.T) {
+	cost := 0.25
+	est := &siftrank.Estimate{
+		NumDocuments: 20,
+		BatchSize:    5,
+		PromptTokens: 100,
+		Rounds: []siftrank.RoundEstimate{
+			{Round: 1, Documents: 20, BatchesPerTrial: 4, ExpectedTrials: 9, MaxTrials: 50, ExpectedCalls: 36, WorstCaseCalls: 200},
+		},
+		Expected:  siftrank.EstimateTotals{Calls: 36, Usage: siftrank.Usage{InputTokens: 3600}, CostUSD: &cost},
+		WorstCase: siftrank.EstimateTotals{Calls: 200, Usage: siftrank.Usage{InputTokens: 20000}, CostUSD: &cost},
+	}
+
+	var buf strings.Builder
+	printEstimate(&buf, est)
+	out := buf.String()
+
+	for _, want := range []string{"20 documents, batch size 5", "9-50", "200", "20000", "$0.2500 expected"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	est.Expected.CostUSD = nil
+	buf.Reset()
+	printEstimate(&buf, est)
+	if !strings.Contains(buf.String(), "estimated cost: unknown") {
+		t.Errorf("expected unknown cost without pricing, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,183 @@
+package siftrank
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// BatchSelection controls how the batches of each trial are built
+type BatchSelection string
+
+const (
+	// BatchSelectionRandom shuffles every document into each trial (default)
+	BatchSelectionRandom BatchSelection = "random"
+	// BatchSelectionAdaptive runs AdaptiveWarmupTrials random trials, then
+	// builds each trial from the documents whose rank interval straddles the
+	// refinement cutoff, batching neighbours that may still swap places
+	BatchSelectionAdaptive BatchSelection = "adaptive"
+)
+
+// rngDomainAdaptive separates adaptive batching random sources from others
+const rngDomainAdaptive = -2
+
+// strengthIntervalZ is the normal quantile for 95% strength intervals
+const strengthIntervalZ = 1.96
+
+// validate reports whether the selection is one of the known modes
+func (s BatchSelection) validate() error {
+	switch s {
+	case BatchSelectionRandom, BatchSelectionAdaptive:
+		return nil
+	}
+	return fmt.Errorf("unknown batch selection %q (expected %s or %s)", s, BatchSelectionRandom, BatchSelectionAdaptive)
+}
+
+// adaptiveBatches builds the batches of an adaptive trial from the round's
+// results so far. It returns nil once no document's rank is uncertain.
+func (r *Ranker) adaptiveBatches(documents []document, scores map[string][]float64, trialNum int) [][]document {
+	rng := r.derivedRNG(rngDomainAdaptive, int64(r.round), int64(trialNum))
+	return selectAdaptiveBatches(documents, r.rankIntervals(scores, rng), r.adaptiveCutoff(len(documents)), r.cfg.BatchSize, rng)
+}
+
+// rankIntervals estimates a rank interval for every scored document from the
+// round's orderings so far
+func (r *Ranker) rankIntervals(scores map[string][]float64, rng *rand.Rand) map[string]scoreStats {
+	r.mu.Lock()
+	orderings := r.orderings
+	r.mu.Unlock()
+
+	return fittedIntervals(r.scorer.Score(orderings, r.round), scores, rng)
+}
+
+// fittedIntervals estimates a rank interval for every scored document: from
+// the scorer's standard errors when it reports them (Plackett-Luce),
+// otherwise from bootstrapped batch positions
+func fittedIntervals(fitted map[string]DocumentScore, scores map[string][]float64, rng *rand.Rand) map[string]scoreStats {
+	for _, score := range fitted {
+		if score.StdErr > 0 {
+			intervals := strengthIntervals(fitted)
+			for id, stats := range intervals {
+				stats.variance = sampleVariance(scores[id])
+				stats.observations = len(scores[id])
+				intervals[id] = stats
+			}
+			return intervals
+		}
+	}
+	return scoreUncertainty(scores, rng)
+}
+
+// strengthIntervals turns 95% intervals on log-strength into rank intervals:
+// a document ranks no better than one plus the number of documents that are
+// surely stronger, and no worse than the number that are not surely weaker
+func strengthIntervals(fitted map[string]DocumentScore) map[string]scoreStats {
+	lowerBounds := make([]float64, 0, len(fitted))
+	upperBounds := make([]float64, 0, len(fitted))
+	for _, score := range fitted {
+		logStrength := math.Log(score.Strength)
+		lowerBounds = append(lowerBounds, logStrength-strengthIntervalZ*score.StdErr)
+		upperBounds = append(upperBounds, logStrength+strengthIntervalZ*score.StdErr)
+	}
+	sort.Float64s(lowerBounds)
+	sort.Float64s(upperBounds)
+
+	intervals := make(map[string]scoreStats, len(fitted))
+	for id, score := range fitted {
+		logStrength := math.Log(score.Strength)
+		lower := logStrength - strengthIntervalZ*score.StdErr
+		upper := logStrength + strengthIntervalZ*score.StdErr
+
+		// Lower bounds above our upper bound, upper bounds below our lower bound
+		surelyStronger := len(lowerBounds) - sort.SearchFloat64s(lowerBounds, math.Nextafter(upper, math.Inf(1)))
+		surelyWeaker := sort.SearchFloat64s(upperBounds, lower)
+		intervals[id] = scoreStats{
+			rankLow:  1 + surelyStronger,
+			rankHigh: len(fitted) - surelyWeaker,
+		}
+	}
+	return intervals
+}
+
+// adaptiveCutoff is the rank boundary adaptive batching resolves: the latest
+// elbow if one was detected, else the refinement ratio's cutoff
+func (r *Ranker) adaptiveCutoff(numDocuments int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if n := len(r.elbowPositions); n > 0 && r.elbowPositions[n-1] > 0 {
+		return r.elbowPositions[n-1]
+	}
+	if cutoff := int(float64(numDocuments) * r.cfg.RefinementRatio); cutoff > 0 {
+		return cutoff
+	}
+	return max(numDocuments/2, 1)
+}
+
+// selectAdaptiveBatches batches the documents whose rank interval straddles
+// cutoff (or that have no interval yet). They are ordered by a rank drawn from
+// each interval, so documents that may swap places share batches, with fresh
+// draws every trial. A short last batch is filled with the settled documents
+// nearest the cutoff as anchors.
+func selectAdaptiveBatches(documents []document, intervals map[string]scoreStats, cutoff, batchSize int, rng *rand.Rand) [][]document {
+	var focus, settled []document
+	drawn := make(map[string]float64)
+	for _, doc := range documents {
+		iv, ok := intervals[doc.ID]
+		switch {
+		case !ok:
+			focus = append(focus, doc)
+			drawn[doc.ID] = float64(cutoff)
+		case iv.rankLow <= cutoff && iv.rankHigh > cutoff:
+			focus = append(focus, doc)
+			drawn[doc.ID] = float64(iv.rankLow) + rng.Float64()*float64(iv.rankHigh-iv.rankLow)
+		default:
+			settled = append(settled, doc)
+		}
+	}
+	if len(focus) == 0 {
+		return nil
+	}
+
+	sort.Slice(focus, func(i, j int) bool {
+		if drawn[focus[i].ID] != drawn[focus[j].ID] {
+			return drawn[focus[i].ID] < drawn[focus[j].ID]
+		}
+		return focus[i].ID < focus[j].ID
+	})
+
+	distance := func(doc document) float64 {
+		iv := intervals[doc.ID]
+		return math.Abs(float64(iv.rankLow+iv.rankHigh)/2 - float64(cutoff))
+	}
+	sort.Slice(settled, func(i, j int) bool {
+		if di, dj := distance(settled[i]), distance(settled[j]); di != dj {
+			return di < dj
+		}
+		return settled[i].ID < settled[j].ID
+	})
+
+	// Anchors first, then focus documents from other batches
+	fill := append(append([]document(nil), settled...), focus...)
+
+	var batches [][]document
+	for start := 0; start < len(focus); start += batchSize {
+		batch := append([]document(nil), focus[start:min(start+batchSize, len(focus))]...)
+		inBatch := make(map[string]bool, batchSize)
+		for _, doc := range batch {
+			inBatch[doc.ID] = true
+		}
+		for _, doc := range fill {
+			if len(batch) == batchSize {
+				break
+			}
+			if !inBatch[doc.ID] {
+				batch = append(batch, doc)
+				inBatch[doc.ID] = true
+			}
+		}
+		batches = append(batches, batch)
+	}
+	return batches
+}
@@ -0,0 +1,148 @@
+package siftrank
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSelectAdaptiveBatches(t *testing.T) {
+	var documents []document
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		documents = append(documents, document{ID: id})
+	}
+	intervals := map[string]scoreStats{
+		"a": {rankLow: 1, rankHigh: 1},
+		"b": {rankLow: 2, rankHigh: 4},
+		"c": {rankLow: 2, rankHigh: 3},
+		"d": {rankLow: 3, rankHigh: 5},
+		"e": {rankLow: 5, rankHigh: 6},
+		// "f" has no interval yet
+	}
+
+	batches := selectAdaptiveBatches(documents, intervals, 3, 2, rand.New(rand.NewSource(1)))
+	if len(batches) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(batches))
+	}
+
+	focus := make(map[string]bool)
+	for _, doc := range batches[0] {
+		focus[doc.ID] = true
+	}
+	for _, doc := range batches[1][:1] {
+		focus[doc.ID] = true
+	}
+	for _, id := range []string{"b", "d", "f"} {
+		if !focus[id] {
+			t.Errorf("expected %s to be batched as uncertain", id)
+		}
+	}
+	for _, id := range []string{"a", "c", "e"} {
+		if focus[id] {
+			t.Errorf("expected settled %s not to be batched as uncertain", id)
+		}
+	}
+
+	// The short batch is padded with the settled document nearest the cutoff
+	if len(batches[1]) != 2 || batches[1][1].ID != "c" {
+		t.Errorf("expected last batch padded with c, got %v", batches[1])
+	}
+
+	settled := map[string]scoreStats{
+		"a": {rankLow: 1, rankHigh: 1},
+		"b": {rankLow: 2, rankHigh: 2},
+	}
+	if batches := selectAdaptiveBatches(documents[:2], settled, 1, 3, rand.New(rand.NewSource(1))); batches != nil {
+		t.Errorf("expected no batches once every rank is settled, got %v", batches)
+	}
+}
+
+func TestStrengthIntervals(t *testing.T) {
+	intervals := strengthIntervals(map[string]DocumentScore{
+		"a": {Strength: 100, StdErr: 0.1},
+		"b": {Strength: 10, StdErr: 1},
+		"c": {Strength: 5, StdErr: 1},
+		"d": {Strength: 0.01, StdErr: 0.1},
+	})
+
+	want := map[string]scoreStats{
+		"a": {rankLow: 1, rankHigh: 1},
+		"b": {rankLow: 2, rankHigh: 3},
+		"c": {rankLow: 2, rankHigh: 3},
+		"d": {rankLow: 4, rankHigh: 4},
+	}
+	for id, w := range want {
+		if got := intervals[id]; got.rankLow != w.rankLow || got.rankHigh != w.rankHigh {
+			t.Errorf("%s: expected [%d, %d], got [%d, %d]", id, w.rankLow, w.rankHigh, got.rankLow, got.rankHigh)
+		}
+	}
+}
+
+func TestConfigValidate_BatchSelection(t *testing.T) {
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.LLMProvider = echoRankProvider{}
+	config.BatchSelection = "greedy"
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to reject unknown batch selection")
+	}
+
+	config.BatchSelection = BatchSelectionAdaptive
+	config.AdaptiveWarmupTrials = 0
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to reject adaptive selection without warm-up trials")
+	}
+}
+
+func TestRanker_AdaptiveBatchSelection(t *testing.T) {
+	sentencesFile := filepath.Join("..", "..", "testdata", "sentences.txt")
+	data, err := os.ReadFile(sentencesFile)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", sentencesFile, err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	// The oracle ranks values highest first
+	want := append([]string(nil), lines...)
+	sort.Sort(sort.Reverse(sort.StringSlice(want)))
+	want = want[:10]
+
+	run := func(selection BatchSelection) ([]string, int) {
+		provider := &oracleProvider{}
+		config := testConfig(provider)
+		config.BatchSize = 10
+		config.NumTrials = 10
+		config.BatchSelection = selection
+
+		ranker, err := NewRanker(config)
+		if err != nil {
+			t.Fatalf("NewRanker failed: %v", err)
+		}
+		results, err := ranker.RankFromFile(sentencesFile, nil, "{{.Data}}", false)
+		if err != nil {
+			t.Fatalf("RankFromFile failed: %v", err)
+		}
+
+		var top []string
+		for _, doc := range results[:10] {
+			top = append(top, doc.Value)
+		}
+		return top, provider.calls
+	}
+
+	randomTop, randomCalls := run(BatchSelectionRandom)
+	adaptiveTop, adaptiveCalls := run(BatchSelectionAdaptive)
+
+	if strings.Join(randomTop, ",") != strings.Join(want, ",") {
+		t.Errorf("random: expected top 10 %v, got %v", want, randomTop)
+	}
+	if strings.Join(adaptiveTop, ",") != strings.Join(want, ",") {
+		t.Errorf("adaptive: expected top 10 %v, got %v", want, adaptiveTop)
+	}
+	if adaptiveCalls >= randomCalls {
+		t.Errorf("expected adaptive selection to use fewer calls than random (%d), got %d", randomCalls, adaptiveCalls)
+	}
+}
@@ -3,6 +3,7 @@ package siftrank
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
@@ -58,11 +59,14 @@ type anthropicAuthTransport struct {
 }
 
 func (t *anthropicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Apply authentication before forwarding to next transport
-	t.Auth.ApplyAuth(req)
-	return t.Transport.RoundTrip(req)
+	// Apply authentication to a copy before forwarding to next transport
+	return roundTripAuthenticated(t.Transport, t.Auth, req)
 }
 
+// anthropicStructuredToolName is the tool Claude is forced to call when a
+// schema is requested; its input is returned as the structured response
+const anthropicStructuredToolName = "structured_response"
+
 // AnthropicProvider implements LLMProvider using Anthropic API
 type AnthropicProvider struct {
 	client    *anthropic.Client
@@ -135,6 +139,23 @@ func (p *AnthropicProvider) Complete(ctx context.Context, prompt string, opts *C
 
 	var totalUsage Usage
 
+	// Anthropic has no response_format; a schema is enforced by forcing a
+	// call to a single tool whose input schema is the requested schema
+	var tools []anthropic.ToolUnionParam
+	if opts.Schema != nil {
+		inputSchema, err := toAnthropicInputSchema(opts.Schema)
+		if err != nil {
+			return "", err
+		}
+		tools = []anthropic.ToolUnionParam{{
+			OfTool: &anthropic.ToolParam{
+				Name:        anthropicStructuredToolName,
+				Description: anthropic.String("Structured JSON response"),
+				InputSchema: inputSchema,
+			},
+		}}
+	}
+
 	for {
 		// Check if context cancelled
 		if ctx.Err() != nil {
@@ -153,6 +174,12 @@ func (p *AnthropicProvider) Complete(ctx context.Context, prompt string, opts *C
 			MaxTokens: 4096, // Default max tokens for Anthropic
 		}
 
+		// Add structured output if schema provided
+		if tools != nil {
+			params.Tools = tools
+			params.ToolChoice = anthropic.ToolChoiceParamOfTool(anthropicStructuredToolName)
+		}
+
 		// Add temperature if provided
 		if opts.Temperature != nil {
 			params.Temperature = anthropic.Float(*opts.Temperature)
@@ -183,15 +210,24 @@ func (p *AnthropicProvider) Complete(ctx context.Context, prompt string, opts *C
 			opts.RequestID = message.ID
 
 			// Extract text content from response
-			// Anthropic returns an array of content blocks, we concatenate all text blocks
+			// Anthropic returns an array of content blocks, we concatenate all text blocks.
+			// A structured tool call takes precedence, its input is the JSON response.
 			var contentBuilder strings.Builder
+			var toolInput string
 			for _, block := range message.Content {
 				switch b := block.AsAny().(type) {
 				case anthropic.TextBlock:
 					contentBuilder.WriteString(b.Text)
+				case anthropic.ToolUseBlock:
+					if b.Name == anthropicStructuredToolName {
+						toolInput = string(b.Input)
+					}
 				}
 			}
 			content := contentBuilder.String()
+			if toolInput != "" {
+				content = toolInput
+			}
 
 			p.logger.Debug("Anthropic call successful",
 				"input_tokens", callUsage.InputTokens,
@@ -210,7 +246,9 @@ func (p *AnthropicProvider) Complete(ctx context.Context, prompt string, opts *C
 		// Handle timeout
 		if err == context.DeadlineExceeded {
 			p.logger.Debug("Request timeout, retrying", "backoff", backoff)
-			time.Sleep(backoff)
+			if err := sleepContext(ctx, backoff); err != nil {
+				return "", err
+			}
 			backoff = minDuration(backoff*2, maxBackoff)
 			continue
 		}
@@ -222,7 +260,9 @@ func (p *AnthropicProvider) Complete(ctx context.Context, prompt string, opts *C
 
 		// Handle rate limits (429)
 		if statusCode == http.StatusTooManyRequests {
-			p.handleRateLimit(&backoff, maxBackoff)
+			if err := p.handleRateLimit(ctx, &backoff, maxBackoff); err != nil {
+				return "", err
+			}
 			continue
 		}
 
@@ -231,7 +271,9 @@ func (p *AnthropicProvider) Complete(ctx context.Context, prompt string, opts *C
 			p.logger.Debug("Server error, retrying",
 				"status", statusCode,
 				"backoff", backoff)
-			time.Sleep(backoff)
+			if err := sleepContext(ctx, backoff); err != nil {
+				return "", err
+			}
 			backoff = minDuration(backoff*2, maxBackoff)
 			continue
 		}
@@ -247,13 +289,15 @@ func (p *AnthropicProvider) Complete(ctx context.Context, prompt string, opts *C
 
 		// Other errors - retry with backoff
 		p.logger.Debug("Request failed, retrying", "error", err, "backoff", backoff)
-		time.Sleep(backoff)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return "", err
+		}
 		backoff = minDuration(backoff*2, maxBackoff)
 	}
 }
 
 // handleRateLimit handles rate limit errors with intelligent backoff
-func (p *AnthropicProvider) handleRateLimit(backoff *time.Duration, maxBackoff time.Duration) {
+func (p *AnthropicProvider) handleRateLimit(ctx context.Context, backoff *time.Duration, maxBackoff time.Duration) error {
 	// Get headers and body under lock
 	p.transport.mu.Lock()
 	headers := p.transport.Headers
@@ -298,12 +342,55 @@ func (p *AnthropicProvider) handleRateLimit(backoff *time.Duration, maxBackoff t
 	// Use suggested wait time if available, otherwise exponential backoff
 	if retryAfter > 0 {
 		p.logger.Debug("Waiting for rate limit reset", "duration", retryAfter)
-		time.Sleep(retryAfter)
+		if err := sleepContext(ctx, retryAfter); err != nil {
+			return err
+		}
 	} else {
 		p.logger.Debug("Waiting with exponential backoff", "duration", *backoff)
-		time.Sleep(*backoff)
+		if err := sleepContext(ctx, *backoff); err != nil {
+			return err
+		}
 		*backoff = minDuration(*backoff*2, maxBackoff)
 	}
+	return nil
+}
+
+// toAnthropicInputSchema converts a JSON schema (as produced by generateSchema)
+// into a tool input schema
+func toAnthropicInputSchema(schema interface{}) (anthropic.ToolInputSchemaParam, error) {
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return anthropic.ToolInputSchemaParam{}, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return anthropic.ToolInputSchemaParam{}, fmt.Errorf("failed to convert schema: %w", err)
+	}
+
+	if t, ok := fields["type"]; ok && t != "object" {
+		return anthropic.ToolInputSchemaParam{}, fmt.Errorf("anthropic tool schema must be an object, got %v", t)
+	}
+
+	inputSchema := anthropic.ToolInputSchemaParam{Properties: fields["properties"]}
+	if required, ok := fields["required"].([]interface{}); ok {
+		for _, name := range required {
+			if s, ok := name.(string); ok {
+				inputSchema.Required = append(inputSchema.Required, s)
+			}
+		}
+	}
+
+	// Keep remaining keywords (e.g. additionalProperties) so the schema stays intact
+	delete(fields, "$schema")
+	delete(fields, "type")
+	delete(fields, "properties")
+	delete(fields, "required")
+	if len(fields) > 0 {
+		inputSchema.ExtraFields = fields
+	}
+
+	return inputSchema, nil
 }
 
 // EstimateTokens implements TokenEstimator.EstimateTokens
@@ -520,6 +520,96 @@ func TestAnthropicProviderMultipleTextBlocks(t *testing.T) {
 	}
 }
 
+// TestAnthropicProviderStructuredOutput verifies a schema is sent as a forced
+// tool call and the tool input is returned as the response
+func TestAnthropicProviderStructuredOutput(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var reqBody map[string]interface{}
+		json.Unmarshal(body, &reqBody)
+
+		tools, ok := reqBody["tools"].([]interface{})
+		if !ok || len(tools) != 1 {
+			t.Fatalf("Expected exactly one tool, got %v", reqBody["tools"])
+		}
+		tool := tools[0].(map[string]interface{})
+		if tool["name"] != anthropicStructuredToolName {
+			t.Errorf("Expected tool name %q, got %v", anthropicStructuredToolName, tool["name"])
+		}
+
+		inputSchema := tool["input_schema"].(map[string]interface{})
+		if inputSchema["type"] != "object" {
+			t.Errorf("Expected object input schema, got %v", inputSchema["type"])
+		}
+		if _, ok := inputSchema["properties"].(map[string]interface{})["docs"]; !ok {
+			t.Errorf("Expected docs property in input schema, got %v", inputSchema["properties"])
+		}
+		if inputSchema["additionalProperties"] != false {
+			t.Errorf("Expected additionalProperties false, got %v", inputSchema["additionalProperties"])
+		}
+		if _, found := inputSchema["$schema"]; found {
+			t.Error("Input schema should not contain $schema")
+		}
+
+		toolChoice := reqBody["tool_choice"].(map[string]interface{})
+		if toolChoice["type"] != "tool" || toolChoice["name"] != anthropicStructuredToolName {
+			t.Errorf("Expected forced tool choice, got %v", toolChoice)
+		}
+
+		response := map[string]interface{}{
+			"id":    "msg_123",
+			"type":  "message",
+			"role":  "assistant",
+			"model": "claude-3-5-sonnet-20241022",
+			"content": []map[string]interface{}{
+				{"type": "text", "text": "Here is the ranking."},
+				{
+					"type":  "tool_use",
+					"id":    "toolu_123",
+					"name":  anthropicStructuredToolName,
+					"input": map[string]interface{}{"docs": []string{"a", "b"}},
+				},
+			},
+			"stop_reason": "tool_use",
+			"usage":       map[string]interface{}{"input_tokens": 20, "output_tokens": 10},
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	cfg := AnthropicConfig{
+		Auth:     NewHeaderAuth("x-api-key", "test-key"),
+		Model:    "claude-3-5-sonnet-20241022",
+		BaseURL:  server.URL,
+		Encoding: "cl100k_base",
+		Logger:   slog.Default(),
+	}
+
+	provider, err := NewAnthropicProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewAnthropicProvider failed: %v", err)
+	}
+
+	opts := &CompletionOptions{Schema: generateSchema[rankedDocumentResponseNoRelevance]()}
+	result, err := provider.Complete(context.Background(), "Rank these", opts)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	var parsed rankedDocumentResponseNoRelevance
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		t.Fatalf("Expected tool input JSON, got '%s': %v", result, err)
+	}
+	if len(parsed.Documents) != 2 || parsed.Documents[0] != "a" || parsed.Documents[1] != "b" {
+		t.Errorf("Expected docs [a b], got %v", parsed.Documents)
+	}
+	if opts.FinishReason != "tool_use" {
+		t.Errorf("Expected finish reason 'tool_use', got '%s'", opts.FinishReason)
+	}
+}
+
 // TestAnthropicProviderEstimateTokens tests token estimation
 func TestAnthropicProviderEstimateTokens(t *testing.T) {
 	cfg := AnthropicConfig{
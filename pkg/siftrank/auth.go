@@ -1,15 +1,19 @@
 package siftrank
 
-import "net/http"
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
 
 // AuthStrategy defines how a provider authenticates HTTP requests.
 // Different LLM providers use different authentication methods:
 //   - OpenAI, OpenRouter: Bearer token in Authorization header
 //   - Anthropic: Custom X-API-Key header
-//   - Google: API key in query parameters (not yet supported via headers)
+//   - Google: API key in the "key" query parameter
 //   - Ollama: Optional authentication (NoAuth when not configured)
 type AuthStrategy interface {
-	// ApplyAuth adds authentication headers to an HTTP request.
+	// ApplyAuth adds authentication (headers or query parameters) to an HTTP request.
 	// This method is safe for concurrent use.
 	ApplyAuth(req *http.Request)
 }
@@ -52,6 +56,38 @@ func NewHeaderAuth(name, value string) *HeaderAuth {
 	}
 }
 
+// QueryAuth implements AuthStrategy for API keys passed as a URL query parameter.
+// Used by: Google Gemini (?key=...)
+type QueryAuth struct {
+	ParamName  string
+	ParamValue string
+}
+
+// ApplyAuth sets the query parameter on the request URL.
+func (q *QueryAuth) ApplyAuth(req *http.Request) {
+	query := req.URL.Query()
+	query.Set(q.ParamName, q.ParamValue)
+	req.URL.RawQuery = query.Encode()
+}
+
+// redact replaces the key in s, raw or query-escaped
+func (q *QueryAuth) redact(s string) string {
+	if q.ParamValue == "" {
+		return s
+	}
+	s = strings.ReplaceAll(s, url.QueryEscape(q.ParamValue), "REDACTED")
+	return strings.ReplaceAll(s, q.ParamValue, "REDACTED")
+}
+
+// NewQueryAuth creates a query parameter auth strategy.
+// Example: NewQueryAuth("key", "AIza...")
+func NewQueryAuth(name, value string) *QueryAuth {
+	return &QueryAuth{
+		ParamName:  name,
+		ParamValue: value,
+	}
+}
+
 // NoAuth implements AuthStrategy for providers that don't require authentication.
 // Used by: Ollama (when running locally without auth), custom endpoints
 type NoAuth struct{}
@@ -66,3 +102,43 @@ func (n *NoAuth) ApplyAuth(req *http.Request) {
 func NewNoAuth() *NoAuth {
 	return &NoAuth{}
 }
+
+// roundTripAuthenticated sends an authenticated copy of req through transport.
+// A RoundTripper must not modify the request it is given, and a query-parameter
+// key added to the caller's URL would leak into its errors and logs, so the key
+// is also redacted from transport errors.
+func roundTripAuthenticated(transport http.RoundTripper, auth AuthStrategy, req *http.Request) (*http.Response, error) {
+	authed := req.Clone(req.Context())
+	auth.ApplyAuth(authed)
+
+	resp, err := transport.RoundTrip(authed)
+	if err != nil {
+		return nil, redactAuthError(err, auth)
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+// redactAuthError removes a query-parameter key from a transport error
+func redactAuthError(err error, auth AuthStrategy) error {
+	q, ok := auth.(*QueryAuth)
+	if !ok || q.redact(err.Error()) == err.Error() {
+		return err
+	}
+	if urlErr, ok := err.(*url.Error); ok && q.redact(urlErr.Err.Error()) == urlErr.Err.Error() {
+		// Keep the error's type (and Timeout) for callers that inspect it
+		return &url.Error{Op: urlErr.Op, URL: q.redact(urlErr.URL), Err: urlErr.Err}
+	}
+	return &redactedError{msg: q.redact(err.Error()), err: err}
+}
+
+// redactedError is an error whose message has had a key removed. It still
+// unwraps to the original so errors.Is keeps working.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
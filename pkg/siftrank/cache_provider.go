@@ -0,0 +1,275 @@
+package siftrank
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// CacheMode controls how CachingProvider uses its on-disk cache
+type CacheMode string
+
+const (
+	// CacheModeReadWrite serves hits from the cache and stores new responses (default)
+	CacheModeReadWrite CacheMode = "readwrite"
+	// CacheModeReadOnly serves hits from the cache but never writes to it
+	CacheModeReadOnly CacheMode = "readonly"
+	// CacheModeRefresh ignores existing entries and overwrites them with new responses
+	CacheModeRefresh CacheMode = "refresh"
+)
+
+// CacheConfig configures the caching provider
+type CacheConfig struct {
+	Dir      string        // Directory holding cache entries (created if missing)
+	Mode     CacheMode     // Cache mode (default: CacheModeReadWrite)
+	TTL      time.Duration // Entries older than this are ignored (0 = never expire)
+	Model    string        // Model identifier included in the cache key (required)
+	Endpoint string        // Provider base URL included in the cache key ("" = provider default)
+	Effort   string        // Reasoning effort included in the cache key
+	Logger   *slog.Logger
+}
+
+// CachingProvider is a decorator that stores successful completions on disk
+// and replays them for identical requests. Entries are keyed by a hash of the
+// model, endpoint, reasoning effort, prompt, schema and temperature.
+type CachingProvider struct {
+	provider LLMProvider
+	dir      string
+	mode     CacheMode
+	ttl      time.Duration
+	model    string
+	endpoint string
+	effort   string
+	logger   *slog.Logger
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// cacheKey holds the request fields that identify a cache entry
+type cacheKey struct {
+	Model       string          `json:"model"`
+	Endpoint    string          `json:"endpoint,omitempty"`
+	Effort      string          `json:"effort,omitempty"`
+	Prompt      string          `json:"prompt"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+}
+
+// cacheEntry is the on-disk record for a cached completion
+type cacheEntry struct {
+	Response     string    `json:"response"`
+	Usage        Usage     `json:"usage"`
+	ModelUsed    string    `json:"model_used,omitempty"`
+	FinishReason string    `json:"finish_reason,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NewCachingProvider wraps provider with an on-disk response cache
+func NewCachingProvider(provider LLMProvider, cfg CacheConfig) (*CachingProvider, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("cache directory cannot be empty")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("cache model cannot be empty (entries of different models would mix)")
+	}
+
+	mode := cfg.Mode
+	if mode == "" {
+		mode = CacheModeReadWrite
+	}
+	if err := mode.validate(); err != nil {
+		return nil, err
+	}
+
+	if cfg.TTL < 0 {
+		return nil, fmt.Errorf("cache TTL must be >= 0")
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &CachingProvider{
+		provider: provider,
+		dir:      cfg.Dir,
+		mode:     mode,
+		ttl:      cfg.TTL,
+		model:    cfg.Model,
+		endpoint: cfg.Endpoint,
+		effort:   cfg.Effort,
+		logger:   logger,
+	}, nil
+}
+
+// validate reports whether the mode is one of the known cache modes
+func (m CacheMode) validate() error {
+	switch m {
+	case CacheModeReadWrite, CacheModeReadOnly, CacheModeRefresh:
+		return nil
+	}
+	return fmt.Errorf("unknown cache mode %q (expected %s, %s or %s)",
+		m, CacheModeReadWrite, CacheModeReadOnly, CacheModeRefresh)
+}
+
+// Complete implements LLMProvider.Complete
+// Returns the cached response when available, otherwise calls the wrapped provider.
+func (c *CachingProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	if opts == nil {
+		opts = &CompletionOptions{}
+	}
+
+	key, err := c.key(prompt, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if c.mode != CacheModeRefresh {
+		if entry, ok := c.load(key); ok {
+			c.hits.Add(1)
+			opts.Usage = entry.Usage
+			opts.ModelUsed = entry.ModelUsed
+			opts.FinishReason = entry.FinishReason
+			opts.RequestID = entry.RequestID
+			opts.Cached = true
+			return entry.Response, nil
+		}
+	}
+
+	c.misses.Add(1)
+	response, err := c.provider.Complete(ctx, prompt, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if c.mode != CacheModeReadOnly {
+		entry := cacheEntry{
+			Response:     response,
+			Usage:        opts.Usage,
+			ModelUsed:    opts.ModelUsed,
+			FinishReason: opts.FinishReason,
+			RequestID:    opts.RequestID,
+			CreatedAt:    time.Now().UTC(),
+		}
+		// A failed write only costs a future cache hit, so don't fail the call
+		if err := c.store(key, entry); err != nil {
+			c.logger.Warn("Failed to write cache entry", "key", key, "error", err)
+		}
+	}
+
+	return response, nil
+}
+
+// EstimateTokens implements TokenEstimator by delegating to the wrapped provider
+func (c *CachingProvider) EstimateTokens(text string) int {
+	if estimator, ok := c.provider.(TokenEstimator); ok {
+		return estimator.EstimateTokens(text)
+	}
+	return len(text) / 4
+}
+
+// Stats returns the number of cache hits and misses so far
+func (c *CachingProvider) Stats() (hits, misses int64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// key hashes the request fields that determine the response
+func (c *CachingProvider) key(prompt string, opts *CompletionOptions) (string, error) {
+	k := cacheKey{
+		Model:       c.model,
+		Endpoint:    c.endpoint,
+		Effort:      c.effort,
+		Prompt:      prompt,
+		Temperature: opts.Temperature,
+	}
+	if opts.Schema != nil {
+		schema, err := json.Marshal(opts.Schema)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal schema for cache key: %w", err)
+		}
+		k.Schema = schema
+	}
+
+	data, err := json.Marshal(k)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cache key: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// path returns the entry file for a key, sharded by the first two hex digits
+func (c *CachingProvider) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// load reads a cache entry, treating unreadable or expired entries as misses
+func (c *CachingProvider) load(key string) (cacheEntry, bool) {
+	var entry cacheEntry
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			c.logger.Warn("Failed to read cache entry", "key", key, "error", err)
+		}
+		return entry, false
+	}
+
+	if err := json.Unmarshal(data, &entry); err != nil {
+		c.logger.Warn("Ignoring corrupt cache entry", "key", key, "error", err)
+		return entry, false
+	}
+
+	if c.ttl > 0 && time.Since(entry.CreatedAt) > c.ttl {
+		c.logger.Debug("Cache entry expired", "key", key, "created_at", entry.CreatedAt)
+		return entry, false
+	}
+
+	return entry, true
+}
+
+// store writes a cache entry atomically (temp file + rename)
+func (c *CachingProvider) store(key string, entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create cache shard: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename cache entry: %w", err)
+	}
+	return nil
+}
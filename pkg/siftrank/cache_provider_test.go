@@ -0,0 +1,393 @@
+package siftrank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingProvider returns a numbered response and fixed usage for each call
+type countingProvider struct {
+	calls atomic.Int32
+	err   error
+}
+
+func (p *countingProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	n := p.calls.Add(1)
+	if p.err != nil {
+		return "", p.err
+	}
+	if opts != nil {
+		opts.Usage = Usage{InputTokens: 10, OutputTokens: 5}
+		opts.ModelUsed = "test-model"
+		opts.FinishReason = "stop"
+		opts.RequestID = fmt.Sprintf("req_%d", n)
+	}
+	return fmt.Sprintf("response %d", n), nil
+}
+
+func newTestCachingProvider(t *testing.T, inner LLMProvider, dir string, mode CacheMode, ttl time.Duration) *CachingProvider {
+	t.Helper()
+	cache, err := NewCachingProvider(inner, CacheConfig{Dir: dir, Mode: mode, TTL: ttl, Model: "openai:test-model"})
+	if err != nil {
+		t.Fatalf("NewCachingProvider failed: %v", err)
+	}
+	return cache
+}
+
+func TestCachingProvider_HitAndMiss(t *testing.T) {
+	inner := &countingProvider{}
+	cache := newTestCachingProvider(t, inner, t.TempDir(), "", 0)
+
+	opts := &CompletionOptions{}
+	first, err := cache.Complete(context.Background(), "rank these", opts)
+	if err != nil {
+		t.Fatalf("first Complete failed: %v", err)
+	}
+	if opts.Cached {
+		t.Error("first call should not be marked cached")
+	}
+
+	opts = &CompletionOptions{}
+	second, err := cache.Complete(context.Background(), "rank these", opts)
+	if err != nil {
+		t.Fatalf("second Complete failed: %v", err)
+	}
+
+	if first != second {
+		t.Errorf("expected cached response %q, got %q", first, second)
+	}
+	if inner.calls.Load() != 1 {
+		t.Errorf("expected 1 provider call, got %d", inner.calls.Load())
+	}
+	if !opts.Cached {
+		t.Error("second call should be marked cached")
+	}
+	if opts.Usage.InputTokens != 10 || opts.Usage.OutputTokens != 5 {
+		t.Errorf("expected cached usage 10/5, got %d/%d", opts.Usage.InputTokens, opts.Usage.OutputTokens)
+	}
+	if opts.ModelUsed != "test-model" || opts.RequestID != "req_1" {
+		t.Errorf("expected cached metadata, got model=%q request=%q", opts.ModelUsed, opts.RequestID)
+	}
+
+	hits, misses := cache.Stats()
+	if hits != 1 || misses != 1 {
+		t.Errorf("expected 1 hit and 1 miss, got %d hits and %d misses", hits, misses)
+	}
+}
+
+func TestCachingProvider_KeyFields(t *testing.T) {
+	inner := &countingProvider{}
+	dir := t.TempDir()
+	cache := newTestCachingProvider(t, inner, dir, "", 0)
+
+	temp := 0.5
+	requests := []struct {
+		name   string
+		prompt string
+		opts   *CompletionOptions
+	}{
+		{"plain", "prompt", &CompletionOptions{}},
+		{"different prompt", "other prompt", &CompletionOptions{}},
+		{"with schema", "prompt", &CompletionOptions{Schema: generateSchema[rankedDocumentResponseNoRelevance]()}},
+		{"with temperature", "prompt", &CompletionOptions{Temperature: &temp}},
+	}
+	for _, req := range requests {
+		if _, err := cache.Complete(context.Background(), req.prompt, req.opts); err != nil {
+			t.Fatalf("%s: Complete failed: %v", req.name, err)
+		}
+		if req.opts.Cached {
+			t.Errorf("%s: expected a distinct cache key", req.name)
+		}
+	}
+
+	// Same request against a different model must miss
+	other := newTestCachingProvider(t, inner, dir, "", 0)
+	other.model = "anthropic:test-model"
+	opts := &CompletionOptions{}
+	if _, err := other.Complete(context.Background(), "prompt", opts); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if opts.Cached {
+		t.Error("expected model to be part of the cache key")
+	}
+
+	// So must the same request to another endpoint or with another effort
+	for name, cfg := range map[string]CacheConfig{
+		"endpoint": {Dir: dir, Model: "openai:test-model", Endpoint: "http://localhost:8000/v1"},
+		"effort":   {Dir: dir, Model: "openai:test-model", Effort: "high"},
+	} {
+		other, err := NewCachingProvider(inner, cfg)
+		if err != nil {
+			t.Fatalf("NewCachingProvider failed: %v", err)
+		}
+		opts := &CompletionOptions{}
+		if _, err := other.Complete(context.Background(), "prompt", opts); err != nil {
+			t.Fatalf("Complete failed: %v", err)
+		}
+		if opts.Cached {
+			t.Errorf("expected %s to be part of the cache key", name)
+		}
+	}
+}
+
+func TestCachingProvider_Persists(t *testing.T) {
+	dir := t.TempDir()
+	inner := &countingProvider{}
+
+	if _, err := newTestCachingProvider(t, inner, dir, "", 0).Complete(context.Background(), "prompt", nil); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	// A fresh provider over the same directory serves the stored entry
+	opts := &CompletionOptions{}
+	response, err := newTestCachingProvider(t, inner, dir, "", 0).Complete(context.Background(), "prompt", opts)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if response != "response 1" || !opts.Cached {
+		t.Errorf("expected cached 'response 1', got %q (cached=%v)", response, opts.Cached)
+	}
+}
+
+func TestCachingProvider_ReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	inner := &countingProvider{}
+	cache := newTestCachingProvider(t, inner, dir, CacheModeReadOnly, 0)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Complete(context.Background(), "prompt", nil); err != nil {
+			t.Fatalf("Complete failed: %v", err)
+		}
+	}
+
+	if inner.calls.Load() != 2 {
+		t.Errorf("read-only cache should not store responses, got %d provider calls", inner.calls.Load())
+	}
+
+	entries, _ := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if len(entries) != 0 {
+		t.Errorf("read-only cache wrote %d entries", len(entries))
+	}
+}
+
+func TestCachingProvider_Refresh(t *testing.T) {
+	dir := t.TempDir()
+	inner := &countingProvider{}
+
+	if _, err := newTestCachingProvider(t, inner, dir, "", 0).Complete(context.Background(), "prompt", nil); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	refresh := newTestCachingProvider(t, inner, dir, CacheModeRefresh, 0)
+	response, err := refresh.Complete(context.Background(), "prompt", nil)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if response != "response 2" {
+		t.Errorf("refresh should bypass the cache, got %q", response)
+	}
+
+	// The refreshed response replaces the old entry
+	opts := &CompletionOptions{}
+	response, err = newTestCachingProvider(t, inner, dir, "", 0).Complete(context.Background(), "prompt", opts)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if response != "response 2" || !opts.Cached {
+		t.Errorf("expected refreshed entry 'response 2', got %q (cached=%v)", response, opts.Cached)
+	}
+}
+
+func TestCachingProvider_TTL(t *testing.T) {
+	dir := t.TempDir()
+	inner := &countingProvider{}
+	cache := newTestCachingProvider(t, inner, dir, "", time.Hour)
+
+	if _, err := cache.Complete(context.Background(), "prompt", nil); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	// Backdate the stored entry past the TTL
+	key, err := cache.key("prompt", &CompletionOptions{})
+	if err != nil {
+		t.Fatalf("key failed: %v", err)
+	}
+	entry, ok := cache.load(key)
+	if !ok {
+		t.Fatal("expected stored entry")
+	}
+	entry.CreatedAt = time.Now().Add(-2 * time.Hour)
+	if err := cache.store(key, entry); err != nil {
+		t.Fatalf("store failed: %v", err)
+	}
+
+	opts := &CompletionOptions{}
+	if _, err := cache.Complete(context.Background(), "prompt", opts); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if opts.Cached || inner.calls.Load() != 2 {
+		t.Errorf("expired entry should be a miss (cached=%v, calls=%d)", opts.Cached, inner.calls.Load())
+	}
+}
+
+func TestCachingProvider_ErrorsNotCached(t *testing.T) {
+	dir := t.TempDir()
+	inner := &countingProvider{err: errors.New("boom")}
+	cache := newTestCachingProvider(t, inner, dir, "", 0)
+
+	if _, err := cache.Complete(context.Background(), "prompt", nil); err == nil {
+		t.Fatal("expected provider error")
+	}
+
+	entries, _ := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if len(entries) != 0 {
+		t.Errorf("failed calls should not be cached, found %d entries", len(entries))
+	}
+}
+
+func TestCachingProvider_CorruptEntry(t *testing.T) {
+	dir := t.TempDir()
+	inner := &countingProvider{}
+	cache := newTestCachingProvider(t, inner, dir, "", 0)
+
+	key, err := cache.key("prompt", &CompletionOptions{})
+	if err != nil {
+		t.Fatalf("key failed: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(cache.path(key)), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cache.path(key), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := cache.Complete(context.Background(), "prompt", nil)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if response != "response 1" {
+		t.Errorf("corrupt entry should be treated as a miss, got %q", response)
+	}
+
+	// The corrupt entry is overwritten with a valid one
+	data, err := os.ReadFile(cache.path(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Errorf("expected valid entry after rewrite: %v", err)
+	}
+}
+
+func TestNewCachingProvider_Errors(t *testing.T) {
+	inner := &countingProvider{}
+
+	if _, err := NewCachingProvider(inner, CacheConfig{}); err == nil {
+		t.Error("expected error for empty directory")
+	}
+	if _, err := NewCachingProvider(inner, CacheConfig{Dir: t.TempDir()}); err == nil {
+		t.Error("expected error for empty model")
+	}
+	if _, err := NewCachingProvider(inner, CacheConfig{Dir: t.TempDir(), Model: "openai:test-model", Mode: "bogus"}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+	if _, err := NewCachingProvider(inner, CacheConfig{Dir: t.TempDir(), Model: "openai:test-model", TTL: -time.Second}); err == nil {
+		t.Error("expected error for negative TTL")
+	}
+}
+
+func TestNewRanker_CacheDir(t *testing.T) {
+	config := NewConfig()
+	config.InitialPrompt = "test"
+	config.LLMProvider = &countingProvider{}
+	config.CacheDir = t.TempDir()
+
+	// A custom provider's model is unknown, so its entries need a namespace
+	if _, err := NewRanker(config); err == nil {
+		t.Error("expected error for a custom provider without a cache namespace")
+	}
+	config.CacheNamespace = "counting"
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	if ranker.cache == nil {
+		t.Fatal("expected response cache to be enabled")
+	}
+	if _, ok := ranker.provider.(*CachingProvider); !ok {
+		t.Errorf("expected provider to be wrapped by CachingProvider, got %T", ranker.provider)
+	}
+
+	// Re-runs must repeat their prompts to hit the cache, so the seed is fixed
+	if ranker.Seed() != cacheSeed {
+		t.Errorf("expected cached runs to default to seed %d, got %d", cacheSeed, ranker.Seed())
+	}
+	config.Seed = 42
+	if ranker, err := NewRanker(config); err != nil || ranker.Seed() != 42 {
+		t.Errorf("expected the configured seed to be kept, got %v", err)
+	}
+	config.Seed = 0
+
+	config.CacheMode = "bogus"
+	if _, err := NewRanker(config); err == nil {
+		t.Error("expected error for unknown cache mode")
+	}
+}
+
+func TestRanker_CacheStatsPerRun(t *testing.T) {
+	var logs bytes.Buffer
+	config := testConfig(&oracleProvider{})
+	config.BatchSize = 10
+	config.NumTrials = 3
+	config.CacheDir = t.TempDir()
+	config.CacheNamespace = "oracle"
+	config.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	// completed returns the cache counts logged by the last finished run
+	completed := func() (hits, misses int) {
+		var last struct {
+			Hits   int `json:"cache_hits"`
+			Misses int `json:"cache_misses"`
+		}
+		for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+			if bytes.Contains(line, []byte(`"msg":"Ranking completed"`)) {
+				if err := json.Unmarshal(line, &last); err != nil {
+					t.Fatalf("invalid log line %s: %v", line, err)
+				}
+			}
+		}
+		return last.Hits, last.Misses
+	}
+
+	if _, err := ranker.RankFromReader(strings.NewReader(itemsInput(30)), "{{.Data}}", false); err != nil {
+		t.Fatalf("RankFromReader failed: %v", err)
+	}
+	hits, misses := completed()
+	if hits != 0 || misses == 0 {
+		t.Fatalf("expected only misses on the first run, got %d hits and %d misses", hits, misses)
+	}
+
+	// The re-run repeats every prompt, and counts only its own lookups
+	if _, err := ranker.RankFromReader(strings.NewReader(itemsInput(30)), "{{.Data}}", false); err != nil {
+		t.Fatalf("RankFromReader failed: %v", err)
+	}
+	if rerunHits, rerunMisses := completed(); rerunHits != misses || rerunMisses != 0 {
+		t.Errorf("expected %d hits and no misses on the re-run, got %d hits and %d misses", misses, rerunHits, rerunMisses)
+	}
+}
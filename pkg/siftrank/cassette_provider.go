@@ -0,0 +1,377 @@
+package siftrank
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Cassettes are JSONL files: one header record followed by one record per
+// Complete call, in the order the calls finished, interleaved with one record
+// per distinct text whose tokens were counted.
+const (
+	cassetteKindHeader = "header"
+	cassetteKindCall   = "call"
+	cassetteKindTokens = "tokens"
+)
+
+// ReplayMode selects how ReplayProvider matches calls to recorded responses
+type ReplayMode string
+
+const (
+	// ReplayByPrompt serves the next unused response recorded for the same prompt (default).
+	// Tolerates the nondeterministic call order of concurrent trials.
+	ReplayByPrompt ReplayMode = "prompt"
+	// ReplayInOrder serves responses in recorded order and fails if a prompt differs.
+	ReplayInOrder ReplayMode = "order"
+)
+
+// cassetteOptions is the recorded subset of CompletionOptions inputs
+type cassetteOptions struct {
+	Schema      json.RawMessage `json:"schema,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	MaxTokens   *int            `json:"max_tokens,omitempty"`
+}
+
+// cassetteRecord is one line of a cassette file
+type cassetteRecord struct {
+	Kind string `json:"kind"`
+
+	// Header fields
+	Seed      int64     `json:"seed,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitzero"`
+
+	// Call fields
+	Seq          int              `json:"seq,omitempty"`
+	PromptHash   string           `json:"prompt_hash,omitempty"`
+	Prompt       string           `json:"prompt,omitempty"`
+	Options      *cassetteOptions `json:"options,omitempty"`
+	Response     string           `json:"response,omitempty"`
+	Error        string           `json:"error,omitempty"`
+	Usage        *Usage           `json:"usage,omitempty"`
+	ModelUsed    string           `json:"model_used,omitempty"`
+	FinishReason string           `json:"finish_reason,omitempty"`
+	RequestID    string           `json:"request_id,omitempty"`
+	LatencyMs    int64            `json:"latency_ms,omitempty"`
+
+	// Token count fields (PromptHash is the hash of the counted text)
+	Tokens int `json:"tokens,omitempty"`
+}
+
+// hashPrompt returns the hex SHA-256 of a prompt
+func hashPrompt(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordingProvider is a decorator that writes every Complete call to a
+// JSONL cassette for later replay with ReplayProvider.
+type RecordingProvider struct {
+	provider LLMProvider
+	mu       sync.Mutex // Protects file, seq and counted
+	file     *os.File
+	seq      int
+	counted  map[string]bool // Hashes of texts whose token counts are recorded
+}
+
+// RecordConfig configures the recording provider
+type RecordConfig struct {
+	Path string // Cassette file to create (truncated if it exists)
+	Seed int64  // Ranker seed, stored in the header so replays shuffle identically
+}
+
+// NewRecordingProvider wraps provider and records its calls to cfg.Path
+func NewRecordingProvider(provider LLMProvider, cfg RecordConfig) (*RecordingProvider, error) {
+	file, err := os.Create(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cassette file: %w", err)
+	}
+
+	rp := &RecordingProvider{provider: provider, file: file, counted: make(map[string]bool)}
+	header := cassetteRecord{
+		Kind:      cassetteKindHeader,
+		Seed:      cfg.Seed,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := rp.write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return rp, nil
+}
+
+// Complete implements LLMProvider.Complete
+// Delegates to the wrapped provider and records the call, including failures.
+func (rp *RecordingProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	if opts == nil {
+		opts = &CompletionOptions{}
+	}
+
+	record := cassetteRecord{
+		Kind:       cassetteKindCall,
+		PromptHash: hashPrompt(prompt),
+		Prompt:     prompt,
+		Options: &cassetteOptions{
+			Temperature: opts.Temperature,
+			MaxTokens:   opts.MaxTokens,
+		},
+	}
+	if opts.Schema != nil {
+		schema, err := json.Marshal(opts.Schema)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal schema for cassette: %w", err)
+		}
+		record.Options.Schema = schema
+	}
+
+	startTime := time.Now()
+	response, callErr := rp.provider.Complete(ctx, prompt, opts)
+
+	usage := opts.Usage
+	record.Response = response
+	record.Usage = &usage
+	record.ModelUsed = opts.ModelUsed
+	record.FinishReason = opts.FinishReason
+	record.RequestID = opts.RequestID
+	record.LatencyMs = time.Since(startTime).Milliseconds()
+	if callErr != nil {
+		record.Error = callErr.Error()
+	}
+
+	if err := rp.write(record); err != nil {
+		return "", err
+	}
+
+	return response, callErr
+}
+
+// EstimateTokens implements TokenEstimator by delegating to the wrapped provider
+// Each distinct count is recorded so replays size batches identically without
+// loading the tokenizer.
+func (rp *RecordingProvider) EstimateTokens(text string) int {
+	tokens := len(text) / 4
+	if estimator, ok := rp.provider.(TokenEstimator); ok {
+		tokens = estimator.EstimateTokens(text)
+	}
+
+	hash := hashPrompt(text)
+	rp.mu.Lock()
+	seen := rp.counted[hash]
+	rp.counted[hash] = true
+	rp.mu.Unlock()
+	if !seen {
+		// A failed write also fails the next Complete call, which reports it
+		_ = rp.write(cassetteRecord{Kind: cassetteKindTokens, PromptHash: hash, Tokens: tokens})
+	}
+	return tokens
+}
+
+// Close closes the cassette file
+func (rp *RecordingProvider) Close() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return rp.file.Close()
+}
+
+// write appends a record to the cassette, assigning call sequence numbers
+func (rp *RecordingProvider) write(record cassetteRecord) error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if record.Kind == cassetteKindCall {
+		rp.seq++
+		record.Seq = rp.seq
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette record: %w", err)
+	}
+	if _, err := rp.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write cassette record: %w", err)
+	}
+	return nil
+}
+
+// ReplayProvider serves responses from a cassette written by RecordingProvider
+// without calling any LLM.
+type ReplayProvider struct {
+	mode   ReplayMode
+	seed   int64
+	tokens map[string]int // Recorded token counts by text hash
+	logger *slog.Logger
+
+	encodingName string
+	encodingOnce sync.Once
+	encoding     *tiktoken.Tiktoken // Loaded on first use; nil if unavailable
+
+	mu       sync.Mutex                  // Protects the cursors below
+	calls    []cassetteRecord            // All call records in recorded order
+	next     int                         // Next record for ReplayInOrder
+	byPrompt map[string][]cassetteRecord // Unused records per prompt hash for ReplayByPrompt
+}
+
+// ReplayConfig configures the replay provider
+type ReplayConfig struct {
+	Path     string     // Cassette file to read
+	Mode     ReplayMode // Matching mode (default: ReplayByPrompt)
+	Encoding string     // Tokenizer encoding for texts the cassette has no token count for
+	Logger   *slog.Logger
+}
+
+// NewReplayProvider loads a cassette for replay
+func NewReplayProvider(cfg ReplayConfig) (*ReplayProvider, error) {
+	mode := cfg.Mode
+	if mode == "" {
+		mode = ReplayByPrompt
+	}
+	if mode != ReplayByPrompt && mode != ReplayInOrder {
+		return nil, fmt.Errorf("unknown replay mode %q (expected %s or %s)", mode, ReplayByPrompt, ReplayInOrder)
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	file, err := os.Open(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette file: %w", err)
+	}
+	defer file.Close()
+
+	rp := &ReplayProvider{
+		mode:         mode,
+		tokens:       make(map[string]int),
+		logger:       logger,
+		encodingName: cfg.Encoding,
+		byPrompt:     make(map[string][]cassetteRecord),
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024) // Prompts can be large
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record cassetteRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid cassette record on line %d: %w", line, err)
+		}
+
+		switch record.Kind {
+		case cassetteKindHeader:
+			rp.seed = record.Seed
+		case cassetteKindCall:
+			rp.calls = append(rp.calls, record)
+			rp.byPrompt[record.PromptHash] = append(rp.byPrompt[record.PromptHash], record)
+		case cassetteKindTokens:
+			rp.tokens[record.PromptHash] = record.Tokens
+		default:
+			return nil, fmt.Errorf("unknown cassette record kind %q on line %d", record.Kind, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette file: %w", err)
+	}
+
+	return rp, nil
+}
+
+// Seed returns the ranker seed stored in the cassette header (0 if none)
+func (rp *ReplayProvider) Seed() int64 {
+	return rp.seed
+}
+
+// Complete implements LLMProvider.Complete
+// Returns the recorded response (or error) matching this call.
+func (rp *ReplayProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	if opts == nil {
+		opts = &CompletionOptions{}
+	}
+
+	record, err := rp.match(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	if record.Usage != nil {
+		opts.Usage = *record.Usage
+	}
+	opts.ModelUsed = record.ModelUsed
+	opts.FinishReason = record.FinishReason
+	opts.RequestID = record.RequestID
+
+	if record.Error != "" {
+		return record.Response, errors.New(record.Error)
+	}
+	return record.Response, nil
+}
+
+// match finds the recorded call for a prompt according to the replay mode
+func (rp *ReplayProvider) match(prompt string) (cassetteRecord, error) {
+	hash := hashPrompt(prompt)
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.mode == ReplayInOrder {
+		if rp.next >= len(rp.calls) {
+			return cassetteRecord{}, fmt.Errorf("cassette exhausted after %d calls", len(rp.calls))
+		}
+		record := rp.calls[rp.next]
+		if record.PromptHash != hash {
+			return cassetteRecord{}, fmt.Errorf("replay mismatch at call %d: prompt differs from recording", record.Seq)
+		}
+		rp.next++
+		return record, nil
+	}
+
+	queue := rp.byPrompt[hash]
+	if len(queue) == 0 {
+		return cassetteRecord{}, fmt.Errorf("no recorded response for prompt %s", hash[:12])
+	}
+	rp.byPrompt[hash] = queue[1:]
+	return queue[0], nil
+}
+
+// EstimateTokens implements TokenEstimator.EstimateTokens
+// Returns the recorded count, so replay works offline. Texts the cassette has
+// no count for (e.g. from cassettes written before counts were recorded) fall
+// back to the tokenizer, loaded on first use.
+func (rp *ReplayProvider) EstimateTokens(text string) int {
+	if tokens, ok := rp.tokens[hashPrompt(text)]; ok {
+		return tokens
+	}
+
+	rp.encodingOnce.Do(func() {
+		encoding, err := tiktoken.GetEncoding(rp.encodingName)
+		if err != nil {
+			rp.logger.Warn("Failed to load tokenizer for replay; approximating token counts, so batches may not match the recording", "error", err)
+			return
+		}
+		rp.encoding = encoding
+	})
+	if rp.encoding == nil {
+		return len(text) / 4
+	}
+	return len(rp.encoding.Encode(text, nil, nil))
+}
@@ -0,0 +1,294 @@
+package siftrank
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// promptIDPattern matches document IDs rendered with promptFmt
+var promptIDPattern = regexp.MustCompile("id: `([^`]+)`")
+
+// echoRankProvider ranks documents in the order they appear in the prompt
+type echoRankProvider struct{}
+
+func (echoRankProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	var ids []string
+	for _, m := range promptIDPattern.FindAllStringSubmatch(prompt, -1) {
+		ids = append(ids, m[1])
+	}
+	if opts != nil {
+		opts.Usage = Usage{InputTokens: len(prompt) / 4, OutputTokens: len(ids)}
+		opts.ModelUsed = "echo"
+	}
+	data, err := json.Marshal(map[string][]string{"docs": ids})
+	return string(data), err
+}
+
+// scriptedProvider returns canned responses or errors per prompt
+type scriptedProvider struct {
+	responses map[string]string
+}
+
+func (p *scriptedProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	response, ok := p.responses[prompt]
+	if !ok {
+		return "", errors.New("scripted failure")
+	}
+	if opts != nil {
+		opts.Usage = Usage{InputTokens: 3, OutputTokens: 2}
+		opts.RequestID = "req_" + prompt
+	}
+	return response, nil
+}
+
+func recordCassette(t *testing.T, path string, seed int64, prompts ...string) {
+	t.Helper()
+
+	inner := &scriptedProvider{responses: map[string]string{"a": "A", "b": "B"}}
+	recorder, err := NewRecordingProvider(inner, RecordConfig{Path: path, Seed: seed})
+	if err != nil {
+		t.Fatalf("NewRecordingProvider failed: %v", err)
+	}
+	for _, prompt := range prompts {
+		recorder.Complete(context.Background(), prompt, nil)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}
+
+func TestRecordingProvider_WritesCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	recordCassette(t, path, 42, "a", "missing")
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var records []cassetteRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record cassetteRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid cassette line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("expected header + 2 calls, got %d records", len(records))
+	}
+	if records[0].Kind != cassetteKindHeader || records[0].Seed != 42 {
+		t.Errorf("expected header with seed 42, got %+v", records[0])
+	}
+
+	call := records[1]
+	if call.Kind != cassetteKindCall || call.Seq != 1 || call.Prompt != "a" || call.Response != "A" {
+		t.Errorf("unexpected first call record %+v", call)
+	}
+	if call.PromptHash != hashPrompt("a") {
+		t.Errorf("expected prompt hash %s, got %s", hashPrompt("a"), call.PromptHash)
+	}
+	if call.Usage == nil || call.Usage.InputTokens != 3 || call.RequestID != "req_a" {
+		t.Errorf("expected usage and request ID to be recorded, got %+v", call)
+	}
+
+	if records[2].Error != "scripted failure" {
+		t.Errorf("expected failed call to record its error, got %q", records[2].Error)
+	}
+}
+
+func TestReplayProvider_ByPrompt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	recordCassette(t, path, 7, "a", "b", "missing")
+
+	replay, err := NewReplayProvider(ReplayConfig{Path: path, Encoding: "o200k_base"})
+	if err != nil {
+		t.Fatalf("NewReplayProvider failed: %v", err)
+	}
+	if replay.Seed() != 7 {
+		t.Errorf("expected seed 7, got %d", replay.Seed())
+	}
+
+	// Out of recorded order is fine when matching by prompt
+	opts := &CompletionOptions{}
+	response, err := replay.Complete(context.Background(), "b", opts)
+	if err != nil || response != "B" {
+		t.Errorf("expected B, got %q (err=%v)", response, err)
+	}
+	if opts.Usage.InputTokens != 3 || opts.RequestID != "req_b" {
+		t.Errorf("expected recorded usage and request ID, got %+v", opts)
+	}
+
+	if response, err := replay.Complete(context.Background(), "a", nil); err != nil || response != "A" {
+		t.Errorf("expected A, got %q (err=%v)", response, err)
+	}
+
+	// Recorded errors are replayed as errors
+	if _, err := replay.Complete(context.Background(), "missing", nil); err == nil || err.Error() != "scripted failure" {
+		t.Errorf("expected recorded error, got %v", err)
+	}
+
+	// Each recorded response is served once
+	if _, err := replay.Complete(context.Background(), "a", nil); err == nil {
+		t.Error("expected error once recorded responses are used up")
+	}
+}
+
+func TestReplayProvider_InOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	recordCassette(t, path, 0, "a", "b")
+
+	replay, err := NewReplayProvider(ReplayConfig{Path: path, Mode: ReplayInOrder, Encoding: "o200k_base"})
+	if err != nil {
+		t.Fatalf("NewReplayProvider failed: %v", err)
+	}
+
+	if _, err := replay.Complete(context.Background(), "b", nil); err == nil || !strings.Contains(err.Error(), "mismatch") {
+		t.Errorf("expected mismatch error, got %v", err)
+	}
+	if response, err := replay.Complete(context.Background(), "a", nil); err != nil || response != "A" {
+		t.Errorf("expected A, got %q (err=%v)", response, err)
+	}
+	if response, err := replay.Complete(context.Background(), "b", nil); err != nil || response != "B" {
+		t.Errorf("expected B, got %q (err=%v)", response, err)
+	}
+	if _, err := replay.Complete(context.Background(), "a", nil); err == nil || !strings.Contains(err.Error(), "exhausted") {
+		t.Errorf("expected exhausted error, got %v", err)
+	}
+}
+
+func TestNewReplayProvider_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := NewReplayProvider(ReplayConfig{Path: filepath.Join(dir, "missing.jsonl"), Encoding: "o200k_base"}); err == nil {
+		t.Error("expected error for missing cassette")
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.jsonl")
+	if err := os.WriteFile(corrupt, []byte("{\"kind\":\"header\"}\nnot json\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReplayProvider(ReplayConfig{Path: corrupt, Encoding: "o200k_base"}); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected error for corrupt line 2, got %v", err)
+	}
+
+	valid := filepath.Join(dir, "valid.jsonl")
+	recordCassette(t, valid, 0, "a")
+	if _, err := NewReplayProvider(ReplayConfig{Path: valid, Mode: "random", Encoding: "o200k_base"}); err == nil {
+		t.Error("expected error for unknown replay mode")
+	}
+}
+
+func TestReplayProvider_RecordedTokenCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.jsonl")
+	recorder, err := NewRecordingProvider(echoRankProvider{}, RecordConfig{Path: path})
+	if err != nil {
+		t.Fatalf("NewRecordingProvider failed: %v", err)
+	}
+	counted := recorder.EstimateTokens("some text to count")
+	recorder.EstimateTokens("some text to count")
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), `"kind":"tokens"`); n != 1 {
+		t.Errorf("expected one token count record per distinct text, got %d", n)
+	}
+
+	// An unknown encoding proves the count comes from the cassette
+	replay, err := NewReplayProvider(ReplayConfig{Path: path, Encoding: "no-such-encoding"})
+	if err != nil {
+		t.Fatalf("NewReplayProvider failed: %v", err)
+	}
+	if got := replay.EstimateTokens("some text to count"); got != counted {
+		t.Errorf("expected the recorded count %d, got %d", counted, got)
+	}
+}
+
+func TestRanker_RecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	cassette := filepath.Join(dir, "run.jsonl")
+
+	var lines []string
+	for i := 0; i < 30; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+	input := strings.Join(lines, "\n")
+
+	newConfig := func() *Config {
+		config := NewConfig()
+		config.InitialPrompt = "rank"
+		config.BatchSize = 5
+		config.NumTrials = 3
+		config.Concurrency = 1
+		config.EnableConvergence = false
+		return config
+	}
+
+	// Record a run against a live (fake) provider
+	config := newConfig()
+	config.LLMProvider = echoRankProvider{}
+	config.RecordPath = cassette
+	config.Seed = 1234
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	recorded, err := ranker.RankFromReader(strings.NewReader(input), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("recorded run failed: %v", err)
+	}
+	if err := ranker.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Replay with no provider; the seed comes from the cassette
+	config = newConfig()
+	config.ReplayPath = cassette
+	ranker, err = NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker (replay) failed: %v", err)
+	}
+	if ranker.Seed() != 1234 {
+		t.Errorf("expected replay to reuse cassette seed 1234, got %d", ranker.Seed())
+	}
+	replayed, err := ranker.RankFromReader(strings.NewReader(input), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("replayed run failed: %v", err)
+	}
+
+	if len(recorded) != len(replayed) {
+		t.Fatalf("expected %d results, got %d", len(recorded), len(replayed))
+	}
+	for i := range recorded {
+		if recorded[i].Value != replayed[i].Value || recorded[i].Score != replayed[i].Score {
+			t.Errorf("result %d differs: recorded %q (%v), replayed %q (%v)",
+				i, recorded[i].Value, recorded[i].Score, replayed[i].Value, replayed[i].Score)
+		}
+	}
+}
+
+func TestConfig_RecordReplayExclusive(t *testing.T) {
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.RecordPath = "a.jsonl"
+	config.ReplayPath = "b.jsonl"
+	if err := config.Validate(); err == nil {
+		t.Error("expected error when both record and replay are set")
+	}
+}
@@ -0,0 +1,368 @@
+package siftrank
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	checkpointFile    = "checkpoint.json"
+	checkpointVersion = 1
+)
+
+// trialRef identifies one trial of one round
+type trialRef struct {
+	Round int `json:"round"`
+	Trial int `json:"trial"`
+}
+
+// relevanceSnippet is one relevance explanation with the trial it came from
+type relevanceSnippet struct {
+	Trial trialRef `json:"trial"`
+	Text  string   `json:"text"`
+}
+
+// countingSource is a rand.Source64 that counts its draws, so a resumed run
+// can bring a freshly seeded source to the same state
+type countingSource struct {
+	rand.Source64
+	draws uint64
+}
+
+func newCountingSource(seed int64) *countingSource {
+	return &countingSource{Source64: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (s *countingSource) Int63() int64 {
+	s.draws++
+	return s.Source64.Int63()
+}
+
+func (s *countingSource) Uint64() uint64 {
+	s.draws++
+	return s.Source64.Uint64()
+}
+
+// restore reseeds the source and advances it by draws
+func (s *countingSource) restore(seed int64, draws uint64) {
+	s.Seed(seed)
+	s.draws = 0
+	for s.draws < draws {
+		s.Int63()
+	}
+}
+
+// checkpoint is the state of a batch-mode run after its last completed
+// trial, as written to checkpointFile
+type checkpoint struct {
+	Version      int                           `json:"version"`
+	Seed         int64                         `json:"seed"`
+	Fingerprint  string                        `json:"fingerprint"`
+	Rounds       []finishedRound               `json:"rounds,omitempty"`
+	Current      *roundProgress                `json:"current,omitempty"`
+	Orderings    []BatchOrdering               `json:"orderings,omitempty"`
+	Relevance    map[string][]relevanceSnippet `json:"relevance,omitempty"`
+	Usage        Usage                         `json:"usage"`
+	Calls        int                           `json:"calls"`
+	Batches      int                           `json:"batches"`
+	Trials       int                           `json:"trials"`
+	NumRounds    int                           `json:"num_rounds"`
+	RoundStats   []RoundStats                  `json:"round_stats,omitempty"`
+	UsageByModel map[string]Usage              `json:"usage_by_model,omitempty"`
+	ModelsUsed   []string                      `json:"models_used,omitempty"`
+}
+
+// finishedRound is a round whose ranking is final, with the state the next
+// round starts from
+type finishedRound struct {
+	Round       int               `json:"round"`
+	Results     []*RankedDocument `json:"results"`
+	ElbowCutoff int               `json:"elbow_cutoff"`
+	RNGDraws    uint64            `json:"rng_draws"`
+}
+
+// roundProgress is the completed trials of the round in progress
+type roundProgress struct {
+	Round             int                          `json:"round"`
+	Completed         []int                        `json:"completed"`
+	TrialScores       map[int]map[string][]float64 `json:"trial_scores"`
+	TrialStats        map[int]*trialStats          `json:"trial_stats"`
+	ElbowPositions    []int                        `json:"elbow_positions,omitempty"`
+	RankingOrders     [][]string                   `json:"ranking_orders,omitempty"`
+	Converged         bool                         `json:"converged,omitempty"`
+	ConvergenceReason ConvergenceReason            `json:"convergence_reason,omitempty"`
+}
+
+// loadCheckpoint reads the checkpoint in dir
+func loadCheckpoint(dir string) (*checkpoint, error) {
+	// #nosec G304 - dir is the configured ResumeDir, which the CLI validates
+	data, err := os.ReadFile(filepath.Join(dir, checkpointFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint: %w", err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("unsupported checkpoint version %d (expected %d)", cp.Version, checkpointVersion)
+	}
+	return &cp, nil
+}
+
+// checkpointFingerprint hashes the documents and the settings that decide
+// which calls a run makes, so a checkpoint is only resumed by the same run
+func (r *Ranker) checkpointFingerprint(documents []document) string {
+	ids := make([]string, len(documents))
+	for i, doc := range documents {
+		ids[i] = doc.ID
+	}
+
+	// Marshaling plain values cannot fail
+	data, _ := json.Marshal(struct {
+		Prompt               string
+		Documents            []string
+		BatchSize            int
+		NumTrials            int
+		RefinementRatio      float64
+		EnableConvergence    bool
+		ElbowTolerance       float64
+		StableTrials         int
+		MinTrials            int
+		ElbowMethod          ElbowMethod
+		ScoringModel         ScoringModel
+		BatchSelection       BatchSelection
+		AdaptiveWarmupTrials int
+		Relevance            bool
+	}{
+		Prompt:               r.prompt(),
+		Documents:            ids,
+		BatchSize:            r.cfg.BatchSize,
+		NumTrials:            r.cfg.NumTrials,
+		RefinementRatio:      r.cfg.RefinementRatio,
+		EnableConvergence:    r.cfg.EnableConvergence,
+		ElbowTolerance:       r.cfg.ElbowTolerance,
+		StableTrials:         r.cfg.StableTrials,
+		MinTrials:            r.cfg.MinTrials,
+		ElbowMethod:          r.cfg.ElbowMethod,
+		ScoringModel:         r.cfg.ScoringModel,
+		BatchSelection:       r.cfg.BatchSelection,
+		AdaptiveWarmupTrials: r.cfg.AdaptiveWarmupTrials,
+		Relevance:            r.cfg.Relevance,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// restoreCheckpoint brings the ranker to the state saved in the checkpoint
+// being resumed. Rounds and trials are restored as rank reaches them.
+func (r *Ranker) restoreCheckpoint() error {
+	cp := r.resume
+	if cp == nil {
+		return nil
+	}
+	if cp.Fingerprint != r.fingerprint {
+		return fmt.Errorf("checkpoint in %s does not match this run (documents, prompt or ranking settings differ)", r.cfg.ResumeDir)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.finishedRounds = cp.Rounds
+	r.orderings = cp.Orderings
+
+	// Every comparison of a batch-mode run is a batch ordering, so the saved
+	// orderings (of completed trials only) give the documents compared
+	for _, ordering := range cp.Orderings {
+		for _, id := range ordering.IDs {
+			if r.comparedAgainst[id] == nil {
+				r.comparedAgainst[id] = make(map[string]bool)
+			}
+			for _, other := range ordering.IDs {
+				if other != id {
+					r.comparedAgainst[id][other] = true
+				}
+			}
+		}
+	}
+	for id, snippets := range cp.Relevance {
+		stats, ok := r.allDocStats[id]
+		if !ok {
+			continue
+		}
+		for _, snippet := range snippets {
+			stats.relevanceSnippets = append(stats.relevanceSnippets, snippet.Text)
+			stats.snippetTrials = append(stats.snippetTrials, snippet.Trial)
+		}
+	}
+
+	r.totalUsage = cp.Usage
+	r.totalCalls = cp.Calls
+	r.totalBatches = cp.Batches
+	r.totalTrials = cp.Trials
+	r.totalRounds = cp.NumRounds
+	r.roundStats = cp.RoundStats
+	r.usageByModel = cp.UsageByModel
+	if len(cp.ModelsUsed) > 0 {
+		r.modelsUsed = make(map[string]bool, len(cp.ModelsUsed))
+		for _, model := range cp.ModelsUsed {
+			r.modelsUsed[model] = true
+		}
+	}
+	return nil
+}
+
+// resumedRound returns the final ranking of round from the checkpoint being
+// resumed, with the state the next round starts from restored, or nil if the
+// round has to be ranked
+func (r *Ranker) resumedRound(round int) []*RankedDocument {
+	if r.resume == nil {
+		return nil
+	}
+	for _, finished := range r.resume.Rounds {
+		if finished.Round != round {
+			continue
+		}
+		r.elbowCutoff = finished.ElbowCutoff
+		r.rngSource.restore(r.seed, finished.RNGDraws)
+
+		r.cfg.Logger.Info("Restored round from checkpoint",
+			"round", round,
+			"num_documents", len(finished.Results))
+		return finished.Results
+	}
+	return nil
+}
+
+// resumedProgress returns the completed trials of round from the checkpoint
+// being resumed, if it stopped during that round. It is called once per
+// ranked round, so the first call ends the resume.
+func (r *Ranker) resumedProgress(round int) *roundProgress {
+	cp := r.resume
+	r.resume = nil
+	if cp == nil || cp.Current == nil || cp.Current.Round != round {
+		return nil
+	}
+
+	r.cfg.Logger.Info("Resuming round from checkpoint",
+		"round", round,
+		"completed_trials", len(cp.Current.Completed))
+	return cp.Current
+}
+
+// saveProgress writes a checkpoint after a trial of the current round
+// completes. completed holds the stats of every completed trial.
+func (r *Ranker) saveProgress(completed map[int]*trialStats, trialScores map[int]map[string][]float64) error {
+	progress := &roundProgress{
+		Round:       r.round,
+		TrialScores: make(map[int]map[string][]float64, len(completed)),
+		TrialStats:  completed,
+	}
+	for trialNum := range completed {
+		progress.Completed = append(progress.Completed, trialNum)
+		progress.TrialScores[trialNum] = trialScores[trialNum]
+	}
+	sort.Ints(progress.Completed)
+
+	r.mu.Lock()
+	progress.ElbowPositions = append([]int(nil), r.elbowPositions...)
+	progress.RankingOrders = append([][]string(nil), r.rankingOrders...)
+	progress.Converged = r.converged
+	progress.ConvergenceReason = r.convergenceReason
+	r.mu.Unlock()
+
+	return r.writeCheckpoint(progress)
+}
+
+// saveFinishedRound writes a checkpoint once the current round's ranking is
+// final
+func (r *Ranker) saveFinishedRound(results []*RankedDocument) error {
+	// Later rounds rescale the results in place
+	saved := make([]*RankedDocument, len(results))
+	for i, doc := range results {
+		copied := *doc
+		saved[i] = &copied
+	}
+	r.finishedRounds = append(r.finishedRounds, finishedRound{
+		Round:       r.round,
+		Results:     saved,
+		ElbowCutoff: r.elbowCutoff,
+		RNGDraws:    r.rngSource.draws,
+	})
+	return r.writeCheckpoint(nil)
+}
+
+// writeCheckpoint atomically replaces the checkpoint file. Orderings and
+// relevance from trials of the current round that have not completed are left
+// out, since a resume repeats those trials; the documents compared are rebuilt
+// from the orderings kept.
+func (r *Ranker) writeCheckpoint(current *roundProgress) error {
+	cp := checkpoint{
+		Version:     checkpointVersion,
+		Seed:        r.seed,
+		Fingerprint: r.fingerprint,
+		Rounds:      r.finishedRounds,
+		Current:     current,
+	}
+
+	completed := make(map[trialRef]bool)
+	if current != nil {
+		for _, trialNum := range current.Completed {
+			completed[trialRef{Round: current.Round, Trial: trialNum}] = true
+		}
+	}
+	keep := func(ref trialRef) bool {
+		return current == nil || ref.Round < current.Round || completed[ref]
+	}
+
+	r.mu.Lock()
+	for _, ordering := range r.orderings {
+		if keep(trialRef{Round: ordering.Round, Trial: ordering.Trial}) {
+			cp.Orderings = append(cp.Orderings, ordering)
+		}
+	}
+	cp.Relevance = make(map[string][]relevanceSnippet)
+	for id, stats := range r.allDocStats {
+		for i, text := range stats.relevanceSnippets {
+			if keep(stats.snippetTrials[i]) {
+				cp.Relevance[id] = append(cp.Relevance[id], relevanceSnippet{Trial: stats.snippetTrials[i], Text: text})
+			}
+		}
+	}
+	cp.Usage = r.totalUsage
+	cp.Calls = r.totalCalls
+	cp.Batches = r.totalBatches
+	cp.Trials = r.totalTrials
+	cp.NumRounds = r.totalRounds
+	cp.RoundStats = append([]RoundStats(nil), r.roundStats...)
+	cp.UsageByModel = make(map[string]Usage, len(r.usageByModel))
+	for model, usage := range r.usageByModel {
+		cp.UsageByModel[model] = usage
+	}
+	for model := range r.modelsUsed {
+		cp.ModelsUsed = append(cp.ModelsUsed, model)
+	}
+	r.mu.Unlock()
+	sort.Strings(cp.ModelsUsed)
+
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	path := filepath.Join(r.checkpointDir, checkpointFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package siftrank
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// cancelingProvider cancels a run after its first limit calls
+type cancelingProvider struct {
+	oracleProvider
+	limit  int
+	cancel context.CancelFunc
+	once   sync.Once
+}
+
+func (p *cancelingProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	response, err := p.oracleProvider.Complete(ctx, prompt, opts)
+	p.mu.Lock()
+	calls := p.calls
+	p.mu.Unlock()
+	if calls >= p.limit {
+		p.once.Do(p.cancel)
+	}
+	return response, err
+}
+
+func checkpointTestConfig(provider LLMProvider) *Config {
+	config := testConfig(provider)
+	config.BatchSize = 10
+	config.NumTrials = 6
+	config.Concurrency = 1
+	return config
+}
+
+func rankWithCheckpoint(t *testing.T, ctx context.Context, config *Config) (*RankResult, error) {
+	t.Helper()
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	return ranker.RankFromReaderResult(ctx, strings.NewReader(itemsInput(50)), "{{.Data}}", false)
+}
+
+func assertSameRanking(t *testing.T, want, got *RankResult) {
+	t.Helper()
+	if len(got.Documents) != len(want.Documents) {
+		t.Fatalf("expected %d documents, got %d", len(want.Documents), len(got.Documents))
+	}
+	for i, doc := range want.Documents {
+		if got.Documents[i].Key != doc.Key || got.Documents[i].Score != doc.Score {
+			t.Errorf("rank %d: expected %s (%v), got %s (%v)",
+				i+1, doc.Value, doc.Score, got.Documents[i].Value, got.Documents[i].Score)
+		}
+		if got.Documents[i].Exposure != doc.Exposure {
+			t.Errorf("rank %d: expected exposure %v, got %v", i+1, doc.Exposure, got.Documents[i].Exposure)
+		}
+	}
+}
+
+func TestRanker_CheckpointResumeFinished(t *testing.T) {
+	dir := t.TempDir()
+
+	provider := &oracleProvider{}
+	config := checkpointTestConfig(provider)
+	config.CheckpointDir = dir
+	full, err := rankWithCheckpoint(t, context.Background(), config)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, checkpointFile)); err != nil {
+		t.Fatalf("expected a checkpoint file: %v", err)
+	}
+
+	// Every round is finished, so resuming makes no calls
+	resumed := &oracleProvider{}
+	config = checkpointTestConfig(resumed)
+	config.Seed = 0
+	config.ResumeDir = dir
+	result, err := rankWithCheckpoint(t, context.Background(), config)
+	if err != nil {
+		t.Fatalf("resumed RankFromReaderResult failed: %v", err)
+	}
+	if resumed.calls != 0 {
+		t.Errorf("expected no calls when resuming a finished run, got %d", resumed.calls)
+	}
+	if result.Seed != full.Seed || result.NumCalls != full.NumCalls || len(result.Rounds) != len(full.Rounds) {
+		t.Errorf("expected seed %d, %d calls and %d rounds, got %d, %d and %d",
+			full.Seed, full.NumCalls, len(full.Rounds), result.Seed, result.NumCalls, len(result.Rounds))
+	}
+	assertSameRanking(t, full, result)
+}
+
+func TestRanker_CheckpointResumeInterrupted(t *testing.T) {
+	full, err := rankWithCheckpoint(t, context.Background(), checkpointTestConfig(&oracleProvider{}))
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+
+	// Stop partway through the first round (5 batches per trial)
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupted := &cancelingProvider{limit: 12, cancel: cancel}
+	config := checkpointTestConfig(interrupted)
+	config.CheckpointDir = dir
+	_, err = rankWithCheckpoint(t, ctx, config)
+	var canceledErr *CanceledError
+	if !errors.As(err, &canceledErr) {
+		t.Fatalf("expected a CanceledError, got %v", err)
+	}
+
+	cp, err := loadCheckpoint(dir)
+	if err != nil {
+		t.Fatalf("loadCheckpoint failed: %v", err)
+	}
+	if cp.Current == nil || len(cp.Current.Completed) != 2 {
+		t.Fatalf("expected 2 completed trials in the checkpoint, got %+v", cp.Current)
+	}
+
+	// Completed trials are not asked again
+	resumed := &oracleProvider{}
+	config = checkpointTestConfig(resumed)
+	config.ResumeDir = dir
+	result, err := rankWithCheckpoint(t, context.Background(), config)
+	if err != nil {
+		t.Fatalf("resumed RankFromReaderResult failed: %v", err)
+	}
+	if resumed.calls != full.NumCalls-10 {
+		t.Errorf("expected %d calls, got %d", full.NumCalls-10, resumed.calls)
+	}
+	if result.NumCalls != full.NumCalls {
+		t.Errorf("expected the run to total %d calls, got %d", full.NumCalls, result.NumCalls)
+	}
+	assertSameRanking(t, full, result)
+}
+
+func TestRanker_CheckpointMismatch(t *testing.T) {
+	dir := t.TempDir()
+	config := checkpointTestConfig(&oracleProvider{})
+	config.CheckpointDir = dir
+	if _, err := rankWithCheckpoint(t, context.Background(), config); err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+
+	config = checkpointTestConfig(&oracleProvider{})
+	config.InitialPrompt = "rank differently"
+	config.ResumeDir = dir
+	if _, err := rankWithCheckpoint(t, context.Background(), config); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected a mismatch error for a different prompt, got %v", err)
+	}
+
+	config = checkpointTestConfig(&oracleProvider{})
+	config.Seed = 6
+	config.ResumeDir = dir
+	if _, err := NewRanker(config); err == nil {
+		t.Error("expected an error for a different seed")
+	}
+
+	config = checkpointTestConfig(&oracleProvider{})
+	config.ResumeDir = t.TempDir()
+	if _, err := NewRanker(config); err == nil {
+		t.Error("expected an error for a directory without a checkpoint")
+	}
+}
+
+func TestConfig_ValidateCheckpoint(t *testing.T) {
+	config := checkpointTestConfig(&oracleProvider{})
+	config.CheckpointDir = t.TempDir()
+	config.Mode = ModePairwise
+	if err := config.Validate(); err == nil {
+		t.Error("expected checkpoints to be rejected in pairwise mode")
+	}
+}
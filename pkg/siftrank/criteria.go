@@ -0,0 +1,362 @@
+package siftrank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Criterion is one named ranking instruction of a multi-criteria run
+type Criterion struct {
+	Name   string  `json:"name" yaml:"name"`
+	Prompt string  `json:"prompt" yaml:"prompt"`
+	Weight float64 `json:"weight" yaml:"weight"` // Relative weight in the combined ranking (> 0)
+}
+
+// CriteriaAggregation selects how per-criterion rankings are combined
+type CriteriaAggregation string
+
+const (
+	// AggregationBorda orders documents by their weighted mean position
+	// across the criteria, each position scaled to 0 (first) to 1 (last)
+	AggregationBorda CriteriaAggregation = "borda"
+	// AggregationPlackettLuce fits one set of strengths to the batch
+	// orderings of every criterion, each weighted by its criterion's weight
+	AggregationPlackettLuce CriteriaAggregation = "plackett-luce"
+)
+
+// validate reports whether the aggregation is one of the known methods
+func (a CriteriaAggregation) validate() error {
+	switch a {
+	case AggregationBorda, AggregationPlackettLuce:
+		return nil
+	}
+	return fmt.Errorf("unknown criteria aggregation %q (expected %s or %s)", a, AggregationBorda, AggregationPlackettLuce)
+}
+
+// CriterionRank is a document's place under one criterion
+type CriterionRank struct {
+	Name  string  `json:"name"`
+	Rank  int     `json:"rank"`  // 1-based rank under this criterion (0 if unranked)
+	Score float64 `json:"score"` // Score under this criterion (lower is better)
+}
+
+// LoadCriteriaFile reads criteria from a YAML (or JSON) list, e.g.
+//
+//   - name: severity
+//     prompt: Rank by how severe the finding is
+//     weight: 2
+//   - name: exploitability
+//     prompt: Rank by how easy the finding is to exploit
+//
+// Weights default to 1.
+func LoadCriteriaFile(path string) ([]Criterion, error) {
+	// #nosec G304 - Caller supplies a validated path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read criteria file: %w", err)
+	}
+
+	var entries []struct {
+		Name   string   `yaml:"name"`
+		Prompt string   `yaml:"prompt"`
+		Weight *float64 `yaml:"weight"`
+	}
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid criteria file: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("criteria file lists no criteria")
+	}
+
+	criteria := make([]Criterion, len(entries))
+	for i, entry := range entries {
+		criteria[i] = Criterion{Name: entry.Name, Prompt: strings.TrimSpace(entry.Prompt), Weight: 1}
+		if entry.Weight != nil {
+			criteria[i].Weight = *entry.Weight
+		}
+	}
+	return criteria, validateCriteria(criteria)
+}
+
+// validateCriteria checks that criteria are named uniquely, have prompts and
+// carry positive weights
+func validateCriteria(criteria []Criterion) error {
+	names := make(map[string]bool, len(criteria))
+	for i, criterion := range criteria {
+		if criterion.Name == "" {
+			return fmt.Errorf("criterion %d has no name", i+1)
+		}
+		if names[criterion.Name] {
+			return fmt.Errorf("criterion %q is listed twice", criterion.Name)
+		}
+		names[criterion.Name] = true
+		if strings.TrimSpace(criterion.Prompt) == "" {
+			return fmt.Errorf("criterion %q has no prompt", criterion.Name)
+		}
+		if criterion.Weight <= 0 {
+			return fmt.Errorf("criterion %q must have a weight greater than 0", criterion.Name)
+		}
+	}
+	return nil
+}
+
+// prompt returns the ranking instruction of the calls being made: the current
+// criterion's prompt, after InitialPrompt if both are set
+func (r *Ranker) prompt() string {
+	switch {
+	case r.criterion == nil:
+		return r.cfg.InitialPrompt
+	case r.cfg.InitialPrompt == "":
+		return r.criterion.Prompt
+	}
+	return r.cfg.InitialPrompt + "\n\n" + r.criterion.Prompt
+}
+
+// criterionName returns the name of the criterion being ranked, if any
+func (r *Ranker) criterionName() string {
+	if r.criterion == nil {
+		return ""
+	}
+	return r.criterion.Name
+}
+
+// longestCriterion returns the criterion with the longest prompt, which
+// batches are sized for so that every criterion can share them
+func longestCriterion(criteria []Criterion) *Criterion {
+	longest := &criteria[0]
+	for i := range criteria {
+		if len(criteria[i].Prompt) > len(longest.Prompt) {
+			longest = &criteria[i]
+		}
+	}
+	return longest
+}
+
+// rankCriteria runs the listwise ranking once per criterion, with the batch
+// size calibrated once for all of them, and combines the rankings. A run cut
+// short by cancellation or the budget combines the criteria ranked so far.
+func (r *Ranker) rankCriteria(ctx context.Context, documents []document) ([]*RankedDocument, error) {
+	// rank shrinks the batch size for small refinement rounds
+	batchSize := r.cfg.BatchSize
+
+	var rankings [][]*RankedDocument
+	var orderings [][]BatchOrdering
+	var err error
+	for i := range r.cfg.Criteria {
+		r.criterion = &r.cfg.Criteria[i]
+		r.cfg.BatchSize = batchSize
+		r.orderings = nil
+
+		r.cfg.Logger.Info("Ranking criterion",
+			"criterion", r.criterion.Name,
+			"weight", r.criterion.Weight,
+			"index", i+1,
+			"of", len(r.cfg.Criteria))
+
+		var results []*RankedDocument
+		results, err = r.rank(ctx, documents, 1)
+		var canceledErr *CanceledError
+		if err != nil && !errors.As(err, &canceledErr) {
+			return nil, err
+		}
+		rankings = append(rankings, results)
+		orderings = append(orderings, r.orderings)
+
+		if err != nil || r.isBudgetExceeded() {
+			break
+		}
+	}
+	r.criterion = nil
+
+	criteria := r.cfg.Criteria[:len(rankings)]
+	if r.cfg.CriteriaAggregation == AggregationPlackettLuce {
+		return aggregateCriteriaPlackettLuce(documents, criteria, rankings, orderings), err
+	}
+	return aggregateCriteriaBorda(documents, criteria, rankings), err
+}
+
+// criteriaBreakdown indexes each criterion's ranking by document key
+func criteriaBreakdown(criteria []Criterion, rankings [][]*RankedDocument) map[string][]CriterionRank {
+	breakdown := make(map[string][]CriterionRank)
+	for c, ranking := range rankings {
+		for i, doc := range ranking {
+			breakdown[doc.Key] = append(breakdown[doc.Key], CriterionRank{
+				Name:  criteria[c].Name,
+				Rank:  i + 1,
+				Score: doc.Score,
+			})
+		}
+	}
+	return breakdown
+}
+
+// combinedDocument builds the combined result for doc from its per-criterion
+// results, or returns nil if no criterion ranked it
+func combinedDocument(doc document, criteria []Criterion, breakdown map[string][]CriterionRank, rankings [][]*RankedDocument) *RankedDocument {
+	if len(breakdown[doc.ID]) == 0 {
+		return nil
+	}
+
+	combined := &RankedDocument{
+		Key:        doc.ID,
+		Value:      doc.Value,
+		Document:   doc.Document,
+		InputIndex: doc.InputIndex,
+	}
+	// Every criterion appears in the breakdown, unranked ones with rank 0
+	for c, criterion := range criteria {
+		entry := CriterionRank{Name: criterion.Name}
+		for _, ranked := range breakdown[doc.ID] {
+			if ranked.Name == criterion.Name {
+				entry = ranked
+			}
+		}
+		combined.Criteria = append(combined.Criteria, entry)
+
+		for _, result := range rankings[c] {
+			if result.Key == doc.ID {
+				combined.Observations += result.Observations
+				combined.Rounds = max(combined.Rounds, result.Rounds)
+			}
+		}
+	}
+	return combined
+}
+
+// aggregateCriteriaBorda orders documents by their weighted mean position
+// across the criteria, each scaled to 0 (first) to 1 (last). A document a
+// criterion did not rank shares its last place. Rank intervals come from
+// combining each criterion's rank interval the same way.
+func aggregateCriteriaBorda(documents []document, criteria []Criterion, rankings [][]*RankedDocument) []*RankedDocument {
+	breakdown := criteriaBreakdown(criteria, rankings)
+	n := len(documents)
+	scale := func(rank int) float64 {
+		if n < 2 {
+			return 0
+		}
+		return float64(rank-1) / float64(n-1)
+	}
+
+	var totalWeight float64
+	for _, criterion := range criteria {
+		totalWeight += criterion.Weight
+	}
+
+	lower := make(map[string]float64)
+	upper := make(map[string]float64)
+	var results []*RankedDocument
+	for _, doc := range documents {
+		combined := combinedDocument(doc, criteria, breakdown, rankings)
+		if combined == nil {
+			continue
+		}
+
+		for c, criterion := range criteria {
+			rank, low, high := n, n, n
+			for _, result := range rankings[c] {
+				if result.Key == doc.ID {
+					rank = combined.Criteria[c].Rank
+					low, high = result.RankCILow, result.RankCIHigh
+				}
+			}
+			share := criterion.Weight / totalWeight
+			combined.Score += share * scale(rank)
+			lower[doc.ID] += share * scale(low)
+			upper[doc.ID] += share * scale(high)
+		}
+		results = append(results, combined)
+	}
+
+	// Break ties by input order so seeded runs are reproducible
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score < results[j].Score
+		}
+		return results[i].InputIndex < results[j].InputIndex
+	})
+
+	intervals := scoreIntervalRanks(lower, upper)
+	for _, result := range results {
+		result.RankCILow = intervals[result.Key].rankLow
+		result.RankCIHigh = intervals[result.Key].rankHigh
+	}
+	return results
+}
+
+// aggregateCriteriaPlackettLuce fits one set of strengths to the batch
+// orderings of every criterion, each ordering weighted by its criterion's
+// share of the total weight (scaled so that equal weights count once)
+func aggregateCriteriaPlackettLuce(documents []document, criteria []Criterion, rankings [][]*RankedDocument, orderings [][]BatchOrdering) []*RankedDocument {
+	breakdown := criteriaBreakdown(criteria, rankings)
+
+	var totalWeight float64
+	for _, criterion := range criteria {
+		totalWeight += criterion.Weight
+	}
+
+	// Every criterion's first round covers all of its documents
+	var weighted []BatchOrdering
+	for c, criterion := range criteria {
+		for _, ordering := range orderings[c] {
+			ordering.Round = 1
+			ordering.Weight = criterion.Weight * float64(len(criteria)) / totalWeight
+			weighted = append(weighted, ordering)
+		}
+	}
+	fitted := PlackettLuceScorer{}.Score(weighted, 1)
+	intervals := strengthIntervals(fitted)
+
+	var results []*RankedDocument
+	for _, doc := range documents {
+		score, ok := fitted[doc.ID]
+		if !ok {
+			continue
+		}
+		combined := combinedDocument(doc, criteria, breakdown, rankings)
+		if combined == nil {
+			continue
+		}
+		combined.Score = score.Score
+		combined.Strength = score.Strength
+		combined.StdErr = score.StdErr
+		combined.RankCILow = intervals[doc.ID].rankLow
+		combined.RankCIHigh = intervals[doc.ID].rankHigh
+		results = append(results, combined)
+	}
+
+	// Break ties by input order so seeded runs are reproducible
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score < results[j].Score
+		}
+		return results[i].InputIndex < results[j].InputIndex
+	})
+	return results
+}
+
+// scoreIntervalRanks turns score intervals (lower is better) into rank
+// intervals: a document ranks no better than one plus the number of documents
+// whose interval lies entirely below its own, and no worse than the number of
+// documents whose interval does not lie entirely above it
+func scoreIntervalRanks(lower, upper map[string]float64) map[string]scoreStats {
+	intervals := make(map[string]scoreStats, len(lower))
+	for id := range lower {
+		stats := scoreStats{rankLow: 1, rankHigh: len(lower)}
+		for other := range lower {
+			if upper[other] < lower[id] {
+				stats.rankLow++
+			}
+			if lower[other] > upper[id] {
+				stats.rankHigh--
+			}
+		}
+		intervals[id] = stats
+	}
+	return intervals
+}
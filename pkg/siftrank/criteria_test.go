@@ -0,0 +1,188 @@
+package siftrank
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func criteriaTestConfig(provider LLMProvider) *Config {
+	config := testConfig(provider)
+	config.Criteria = []Criterion{
+		{Name: "high", Prompt: "Rank the items, highest first", Weight: 3},
+		{Name: "low", Prompt: "Rank the items, lowest first", Weight: 1},
+	}
+	config.BatchSize = 5
+	config.NumTrials = 2
+	config.Seed = 9
+	return config
+}
+
+func criteriaTestInput() string {
+	var lines []string
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", (i*7)%10))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestRanker_Criteria(t *testing.T) {
+	provider := &oracleProvider{}
+	ranker, err := NewRanker(criteriaTestConfig(provider))
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(criteriaTestInput()), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+
+	// Per criterion: 2 trials of 2 batches, then of 5 and of 2 documents. The
+	// second criterion starts again from batches of 5.
+	if provider.calls != 16 || result.NumCalls != 16 {
+		t.Errorf("expected 16 calls, got %d (reported %d)", provider.calls, result.NumCalls)
+	}
+	var criteria []string
+	for _, round := range result.Rounds {
+		criteria = append(criteria, fmt.Sprintf("%s%d", round.Criterion, round.Round))
+	}
+	if got := strings.Join(criteria, ","); got != "high1,high2,high3,low1,low2,low3" {
+		t.Errorf("unexpected rounds %s", got)
+	}
+
+	if len(result.Documents) != 10 {
+		t.Fatalf("expected 10 results, got %d", len(result.Documents))
+	}
+	// The heavier criterion wins, with the lighter one only breaking ties
+	if result.Documents[0].Value != "item 9" || result.Documents[9].Value != "item 0" {
+		t.Errorf("expected item 9 first and item 0 last, got %s and %s", result.Documents[0].Value, result.Documents[9].Value)
+	}
+	for _, doc := range result.Documents {
+		if len(doc.Criteria) != 2 || doc.Criteria[0].Name != "high" || doc.Criteria[1].Name != "low" {
+			t.Fatalf("expected a breakdown per criterion for %s, got %+v", doc.Value, doc.Criteria)
+		}
+		for _, ranked := range doc.Criteria {
+			if ranked.Rank < 1 || ranked.Rank > 10 {
+				t.Errorf("expected %s ranked under %s, got %+v", doc.Value, ranked.Name, ranked)
+			}
+		}
+		if doc.RankCILow < 1 || doc.RankCIHigh < doc.RankCILow {
+			t.Errorf("expected a rank interval for %s, got %d-%d", doc.Value, doc.RankCILow, doc.RankCIHigh)
+		}
+	}
+}
+
+func TestRanker_CriteriaPlackettLuce(t *testing.T) {
+	config := criteriaTestConfig(&oracleProvider{})
+	config.CriteriaAggregation = AggregationPlackettLuce
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	results, err := ranker.RankFromReader(strings.NewReader(criteriaTestInput()), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReader failed: %v", err)
+	}
+
+	if len(results) != 10 || results[0].Value != "item 9" {
+		t.Fatalf("expected item 9 first of 10, got %+v", results)
+	}
+	for _, doc := range results {
+		if doc.Strength <= 0 || doc.StdErr <= 0 {
+			t.Errorf("expected strength and std err for %s, got %v and %v", doc.Value, doc.Strength, doc.StdErr)
+		}
+	}
+}
+
+func TestAggregateCriteriaBorda(t *testing.T) {
+	documents := []document{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	criteria := []Criterion{{Name: "x", Weight: 1}, {Name: "y", Weight: 3}}
+	ranked := func(keys ...string) []*RankedDocument {
+		var docs []*RankedDocument
+		for i, key := range keys {
+			docs = append(docs, &RankedDocument{Key: key, Score: float64(i + 1), RankCILow: i + 1, RankCIHigh: i + 1})
+		}
+		return docs
+	}
+
+	// y puts c first; a was not ranked under y and shares its last place
+	results := aggregateCriteriaBorda(documents, criteria, [][]*RankedDocument{ranked("a", "b", "c"), ranked("c", "b")})
+
+	var order []string
+	for _, doc := range results {
+		order = append(order, doc.Key)
+	}
+	if got := strings.Join(order, ""); got != "cba" {
+		t.Errorf("expected order cba, got %s", got)
+	}
+	if want := 0.25*1 + 0.75*0; results[0].Score != want {
+		t.Errorf("expected c to score %v, got %v", want, results[0].Score)
+	}
+	if a := results[2]; a.Criteria[1].Rank != 0 || a.Score != 0.75 {
+		t.Errorf("expected a unranked under y and last overall, got %+v", a)
+	}
+}
+
+func TestLoadCriteriaFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "criteria.yaml")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	criteria, err := LoadCriteriaFile(write(`
+- name: severity
+  prompt: |
+    Rank by severity
+  weight: 2
+- name: exploitability
+  prompt: Rank by exploitability
+`))
+	if err != nil {
+		t.Fatalf("LoadCriteriaFile failed: %v", err)
+	}
+	want := []Criterion{
+		{Name: "severity", Prompt: "Rank by severity", Weight: 2},
+		{Name: "exploitability", Prompt: "Rank by exploitability", Weight: 1},
+	}
+	if len(criteria) != len(want) || criteria[0] != want[0] || criteria[1] != want[1] {
+		t.Errorf("expected %+v, got %+v", want, criteria)
+	}
+
+	for content, problem := range map[string]string{
+		"[]": "no criteria",
+		"- name: a\n  prompt: x\n- name: a\n  prompt: y": "twice",
+		"- name: a":                           "no prompt",
+		"- name: a\n  prompt: x\n  weight: 0": "weight",
+	} {
+		if _, err := LoadCriteriaFile(write(content)); err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("expected error about %q for %q, got %v", problem, content, err)
+		}
+	}
+}
+
+func TestConfigValidate_Criteria(t *testing.T) {
+	config := criteriaTestConfig(echoRankProvider{})
+	if err := config.Validate(); err != nil {
+		t.Errorf("expected criteria to stand in for the prompt, got %v", err)
+	}
+
+	config.Mode = ModePairwise
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to reject criteria in pairwise mode")
+	}
+
+	config.Mode = ModeBatch
+	config.CriteriaAggregation = "median"
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to reject unknown aggregation")
+	}
+}
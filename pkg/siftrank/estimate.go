@@ -0,0 +1,282 @@
+package siftrank
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Estimate is a pre-flight projection of a ranking run's LLM calls and token
+// usage, computed from the loaded documents without calling the provider.
+//
+// Refinement rounds are projected with RefinementRatio; when convergence is
+// enabled the real cutoff is the elbow, which is only known at run time.
+// Retries for malformed responses are not included. In pairwise mode the
+// single round's trials are Swiss rounds; in pointwise mode the last round's
+// trials are scoring samples. With Criteria every criterion runs its own
+// rounds, and PromptTokens is that of the longest criterion prompt.
+type Estimate struct {
+	NumDocuments int             `json:"num_documents"`
+	BatchSize    int             `json:"batch_size"`    // After adjusting for BatchTokens
+	PromptTokens int             `json:"prompt_tokens"` // Prompt and instructions sent with every batch
+	Rounds       []RoundEstimate `json:"rounds"`
+
+	// Relevance summaries (one call per document reaching round 2)
+	RelevanceCalls int `json:"relevance_calls,omitempty"`
+
+	Expected  EstimateTotals `json:"expected"`   // Convergence after MinTrials+StableTrials-1 trials
+	WorstCase EstimateTotals `json:"worst_case"` // Every round runs NumTrials on the largest documents
+	Pricing   *Pricing       `json:"pricing,omitempty"`
+}
+
+// RoundEstimate projects one round of shuffled batch ranking
+type RoundEstimate struct {
+	Criterion       string `json:"criterion,omitempty"` // Multi-criteria runs only
+	Round           int    `json:"round"`
+	Documents       int    `json:"documents"`
+	BatchesPerTrial int    `json:"batches_per_trial"`
+	ExpectedTrials  int    `json:"expected_trials"`
+	MaxTrials       int    `json:"max_trials"`
+	ExpectedCalls   int    `json:"expected_calls"`
+	WorstCaseCalls  int    `json:"worst_case_calls"`
+	ExpectedUsage   Usage  `json:"expected_usage"`
+	WorstCaseUsage  Usage  `json:"worst_case_usage"`
+}
+
+// EstimateTotals sums the projected calls, usage and cost of a run
+type EstimateTotals struct {
+	Calls   int      `json:"calls"`
+	Usage   Usage    `json:"usage"`
+	CostUSD *float64 `json:"cost_usd,omitempty"` // Only if pricing is known
+}
+
+// NewEstimator creates a Ranker for EstimateFromFiles and EstimateFromReader.
+// Unless config sets LLMProvider or ReplayPath, it counts tokens with the
+// configured encoding instead of creating the provider, so estimating needs no
+// API key; ranking with it fails. RecordPath is ignored, since no calls are made.
+func NewEstimator(config *Config) (*Ranker, error) {
+	configCopy := *config
+	configCopy.RecordPath = ""
+	if configCopy.LLMProvider == nil && configCopy.ReplayPath == "" {
+		encodingName := configCopy.Encoding
+		if configCopy.ProviderConfig != nil && configCopy.ProviderConfig.Encoding != "" {
+			encodingName = configCopy.ProviderConfig.Encoding
+		}
+		if encodingName == "" {
+			encodingName = DefaultEncoding
+		}
+		encoding, err := tiktoken.GetEncoding(encodingName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get tiktoken encoding: %w", err)
+		}
+		configCopy.LLMProvider = &tokenizerProvider{encoding: encoding}
+	}
+	return NewRanker(&configCopy)
+}
+
+// tokenizerProvider stands in for the provider of an estimator: it counts
+// tokens but cannot complete prompts
+type tokenizerProvider struct {
+	encoding *tiktoken.Tiktoken
+}
+
+// Complete implements LLMProvider.Complete by refusing the call
+func (p *tokenizerProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	return "", errors.New("an estimator cannot make LLM calls")
+}
+
+// EstimateTokens implements TokenEstimator.EstimateTokens
+func (p *tokenizerProvider) EstimateTokens(text string) int {
+	return len(p.encoding.Encode(text, nil, nil))
+}
+
+// EstimateFromFiles loads documents like RankFromFiles and projects the run
+// without making any LLM calls
+func (r *Ranker) EstimateFromFiles(filePaths []string, templateData string, forceJSON bool) (*Estimate, error) {
+	allDocuments, err := r.loadDocumentsFromFiles(filePaths, templateData, forceJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(allDocuments) > MaxDocuments {
+		return nil, fmt.Errorf("too many documents to rank (max %d)", MaxDocuments)
+	}
+	if len(allDocuments) == 0 {
+		return nil, fmt.Errorf("no documents loaded from %d files", len(filePaths))
+	}
+
+	return r.newRun().estimate(allDocuments)
+}
+
+// EstimateFromReader loads documents like RankFromReader and projects the
+// run without making any LLM calls
+func (r *Ranker) EstimateFromReader(reader io.Reader, templateData string, isJSON bool) (*Estimate, error) {
+	documents, err := r.loadDocumentsFromReader(reader, templateData, r.inputFormat(isJSON, FormatText))
+	if err != nil {
+		return nil, err
+	}
+
+	return r.newRun().estimate(documents)
+}
+
+// estimate walks the rounds rankDocuments would run, using the provider's
+// tokenizer for input sizes and the budget projections for output sizes
+func (r *Ranker) estimate(documents []document) (*Estimate, error) {
+	documents, err := r.prepareDocuments(documents)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.cfg.Criteria) > 0 {
+		r.criterion = longestCriterion(r.cfg.Criteria)
+		defer func() { r.criterion = nil }()
+	}
+	if err := r.checkDocumentSizes(documents); err != nil {
+		return nil, err
+	}
+	if err := r.adjustBatchSize(documents); err != nil {
+		return nil, err
+	}
+
+	// Largest documents first for the worst case, average for the expected case
+	docTokens := make([]int, len(documents))
+	var totalDocTokens int
+	for i, doc := range documents {
+		docTokens[i] = r.estimateTokens([]document{doc}, false)
+		totalDocTokens += docTokens[i]
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(docTokens)))
+	avgDocTokens := float64(totalDocTokens) / float64(len(documents))
+
+	est := &Estimate{
+		NumDocuments: len(documents),
+		BatchSize:    r.cfg.BatchSize,
+		PromptTokens: r.countTokens(r.prompt() + r.disclaimer(r.cfg.Mode)),
+		Pricing:      r.pricing,
+	}
+
+	expectedTrials := r.cfg.NumTrials
+	if r.cfg.EnableConvergence {
+		// Convergence needs StableTrials ranking orders, recorded from MinTrials on
+		expectedTrials = min(r.cfg.NumTrials, r.cfg.MinTrials+r.cfg.StableTrials-1)
+	}
+
+	promptTokens := est.PromptTokens
+	addRound := func(round, n, batchSize, numBatches, expectedTrials, maxTrials int) {
+		var worstInput int
+		for _, tokens := range docTokens[:batchSize] {
+			worstInput += tokens
+		}
+		expectedBatch := Usage{
+			InputTokens:  promptTokens + int(avgDocTokens*float64(batchSize)),
+			OutputTokens: batchSize * outputTokensPerDoc(r.cfg.Relevance, round),
+		}
+		worstBatch := Usage{
+			InputTokens:  promptTokens + worstInput,
+			OutputTokens: expectedBatch.OutputTokens,
+		}
+
+		re := RoundEstimate{
+			Criterion:       r.criterionName(),
+			Round:           round,
+			Documents:       n,
+			BatchesPerTrial: numBatches,
+			ExpectedTrials:  expectedTrials,
+			MaxTrials:       maxTrials,
+			ExpectedCalls:   numBatches * expectedTrials,
+			WorstCaseCalls:  numBatches * maxTrials,
+			ExpectedUsage:   scaleUsage(expectedBatch, numBatches*expectedTrials),
+			WorstCaseUsage:  scaleUsage(worstBatch, numBatches*maxTrials),
+		}
+		est.Rounds = append(est.Rounds, re)
+		est.Expected.Calls += re.ExpectedCalls
+		est.Expected.Usage.Add(re.ExpectedUsage)
+		est.WorstCase.Calls += re.WorstCaseCalls
+		est.WorstCase.Usage.Add(re.WorstCaseUsage)
+	}
+
+	if r.cfg.Mode == ModePairwise {
+		// A single round of Swiss rounds (trials), each asking about every
+		// pair in both orders
+		if n := len(documents); n > 1 {
+			addRound(1, n, 2, 2*(n/2), pairwiseRounds(n), pairwiseRounds(n))
+		}
+	} else if r.cfg.Mode != ModePointwise || r.cfg.BlendWeight > 0 {
+		listwise := func() {
+			for round, n := 1, len(documents); n > 1; round++ {
+				batchSize := min(r.cfg.BatchSize, n)
+				addRound(round, n, batchSize, n/batchSize, expectedTrials, r.cfg.NumTrials)
+
+				// Same stopping rules as rank's ratio cutoff
+				mid := int(float64(n) * r.cfg.RefinementRatio)
+				if mid < 2 || mid == n {
+					break
+				}
+				n = mid
+			}
+		}
+
+		if len(r.cfg.Criteria) == 0 {
+			listwise()
+		}
+		for i := range r.cfg.Criteria {
+			r.criterion = &r.cfg.Criteria[i]
+			promptTokens = r.countTokens(r.prompt() + r.disclaimer(r.cfg.Mode))
+			listwise()
+		}
+	}
+
+	if r.cfg.Mode == ModePointwise {
+		// A scoring round after any listwise rounds, one trial per sample
+		n := len(documents)
+		batchSize := min(r.cfg.ScoreBatchSize, n)
+		numBatches := (n + batchSize - 1) / batchSize
+		addRound(len(est.Rounds)+1, n, batchSize, numBatches, r.cfg.PointwiseSamples, r.cfg.PointwiseSamples)
+	}
+
+	// Each document refined past round 1 (under any criterion) gets a summary
+	// of its snippets
+	var expectedSnippets, worstSnippets int
+	for _, re := range est.Rounds {
+		if re.Round > 1 {
+			expectedSnippets += re.ExpectedTrials
+			worstSnippets += re.MaxTrials
+		}
+		if r.cfg.Relevance && re.Round == 2 {
+			est.RelevanceCalls = max(est.RelevanceCalls, re.Documents)
+		}
+	}
+	if est.RelevanceCalls > 0 {
+		est.Expected.Calls += est.RelevanceCalls
+		est.Expected.Usage.Add(scaleUsage(Usage{
+			InputTokens:  int(avgDocTokens) + expectedSnippets*estimatedRelevanceTokensPerDoc,
+			OutputTokens: estimatedSummaryOutputTokens,
+		}, est.RelevanceCalls))
+		est.WorstCase.Calls += est.RelevanceCalls
+		est.WorstCase.Usage.Add(scaleUsage(Usage{
+			InputTokens:  docTokens[0] + worstSnippets*estimatedRelevanceTokensPerDoc,
+			OutputTokens: estimatedSummaryOutputTokens,
+		}, est.RelevanceCalls))
+	}
+
+	if r.pricing != nil {
+		expectedCost := r.pricing.Cost(est.Expected.Usage)
+		worstCost := r.pricing.Cost(est.WorstCase.Usage)
+		est.Expected.CostUSD = &expectedCost
+		est.WorstCase.CostUSD = &worstCost
+	}
+
+	return est, nil
+}
+
+// scaleUsage multiplies a per-call usage by a number of calls
+func scaleUsage(u Usage, calls int) Usage {
+	return Usage{
+		InputTokens:     u.InputTokens * calls,
+		OutputTokens:    u.OutputTokens * calls,
+		ReasoningTokens: u.ReasoningTokens * calls,
+	}
+}
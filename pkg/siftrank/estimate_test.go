@@ -0,0 +1,243 @@
+package siftrank
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func estimateTestConfig(provider LLMProvider) *Config {
+	config := testConfig(provider)
+	config.BatchSize = 5
+	config.NumTrials = 10
+	config.Concurrency = 4
+	config.Pricing = &Pricing{InputPerMillion: 1, OutputPerMillion: 2}
+	return config
+}
+
+func TestEstimateFromReader(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+	input := strings.Join(lines, "\n")
+
+	provider := &promptLogProvider{}
+	ranker, err := NewRanker(estimateTestConfig(provider))
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	est, err := ranker.EstimateFromReader(strings.NewReader(input), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("EstimateFromReader failed: %v", err)
+	}
+	if len(provider.prompts) != 0 {
+		t.Errorf("expected no LLM calls, got %d", len(provider.prompts))
+	}
+
+	// 20 -> 10 -> 5 -> 2 documents, halving with the default ratio
+	wantDocs := []int{20, 10, 5, 2}
+	wantBatches := []int{4, 2, 1, 1}
+	if len(est.Rounds) != len(wantDocs) {
+		t.Fatalf("expected %d rounds, got %+v", len(wantDocs), est.Rounds)
+	}
+	for i, re := range est.Rounds {
+		if re.Documents != wantDocs[i] || re.BatchesPerTrial != wantBatches[i] {
+			t.Errorf("round %d: expected %d docs in %d batches, got %d in %d",
+				re.Round, wantDocs[i], wantBatches[i], re.Documents, re.BatchesPerTrial)
+		}
+	}
+
+	// Without convergence the expected case is the worst case
+	if est.Expected.Calls != 80 || est.WorstCase.Calls != 80 {
+		t.Errorf("expected 80 calls, got %d expected and %d worst case", est.Expected.Calls, est.WorstCase.Calls)
+	}
+	if est.Expected.Usage.InputTokens == 0 || est.Expected.Usage.OutputTokens == 0 {
+		t.Errorf("expected projected tokens, got %+v", est.Expected.Usage)
+	}
+	if est.WorstCase.Usage.InputTokens < est.Expected.Usage.InputTokens {
+		t.Errorf("worst case %+v below expected %+v", est.WorstCase.Usage, est.Expected.Usage)
+	}
+	if est.Expected.CostUSD == nil || *est.Expected.CostUSD <= 0 {
+		t.Errorf("expected a cost with pricing set, got %v", est.Expected.CostUSD)
+	}
+
+	// A real run without convergence makes exactly the projected calls
+	ranker, err = NewRanker(estimateTestConfig(provider))
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	if _, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(input), "{{.Data}}", false); err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+	if len(provider.prompts) != est.WorstCase.Calls {
+		t.Errorf("expected %d calls in a real run, got %d", est.WorstCase.Calls, len(provider.prompts))
+	}
+}
+
+func TestEstimateFromReader_Convergence(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+
+	config := estimateTestConfig(echoRankProvider{})
+	config.EnableConvergence = true
+	config.MinTrials = 3
+	config.StableTrials = 4
+	config.Relevance = true
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	est, err := ranker.EstimateFromReader(strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("EstimateFromReader failed: %v", err)
+	}
+
+	// Earliest convergence is after MinTrials+StableTrials-1 trials
+	for _, re := range est.Rounds {
+		if re.ExpectedTrials != 6 || re.MaxTrials != 10 {
+			t.Errorf("round %d: expected 6 of 10 trials, got %d of %d", re.Round, re.ExpectedTrials, re.MaxTrials)
+		}
+	}
+
+	// Relevance summarizes every document that reached round 2
+	if est.RelevanceCalls != 10 {
+		t.Errorf("expected 10 relevance calls, got %d", est.RelevanceCalls)
+	}
+	if est.Expected.Calls != 6*8+10 || est.WorstCase.Calls != 10*8+10 {
+		t.Errorf("unexpected call totals: %d expected, %d worst case", est.Expected.Calls, est.WorstCase.Calls)
+	}
+}
+
+func TestNewEstimator_NoProvider(t *testing.T) {
+	config := testConfig(nil)
+	config.BatchSize = 5
+	config.ProviderConfig = &ProviderConfig{Type: ProviderTypeOpenAI, Model: "gpt-4o-mini"}
+	config.RecordPath = filepath.Join(t.TempDir(), "unused.jsonl")
+
+	// No API key is set, so NewRanker cannot create the provider
+	if _, err := NewRanker(config); err == nil {
+		t.Fatal("expected NewRanker to need an API key")
+	}
+
+	ranker, err := NewEstimator(config)
+	if err != nil && strings.Contains(err.Error(), "API key") {
+		t.Fatalf("expected the estimator not to need an API key, got %v", err)
+	}
+	if err != nil {
+		t.Skipf("tokenizer unavailable: %v", err)
+	}
+
+	est, err := ranker.EstimateFromReader(strings.NewReader("a\nb\nc\nd\ne\nf\n"), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("EstimateFromReader failed: %v", err)
+	}
+	if est.PromptTokens == 0 {
+		t.Error("expected prompt tokens counted by the tokenizer")
+	}
+	if _, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader("a\nb\n"), "{{.Data}}", false); err == nil {
+		t.Error("expected ranking with an estimator to fail")
+	}
+	if _, err := os.Stat(config.RecordPath); !os.IsNotExist(err) {
+		t.Errorf("expected no cassette to be created, got %v", err)
+	}
+}
+
+func TestEstimateFromReader_Pairwise(t *testing.T) {
+	var lines []string
+	for i := 0; i < 12; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+
+	config := estimateTestConfig(&promptLogProvider{})
+	config.Mode = ModePairwise
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	est, err := ranker.EstimateFromReader(strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("EstimateFromReader failed: %v", err)
+	}
+
+	// 5 Swiss rounds of 6 pairs, each asked in both orders
+	if len(est.Rounds) != 1 || est.Rounds[0].BatchesPerTrial != 12 || est.Rounds[0].ExpectedTrials != 5 {
+		t.Fatalf("expected one round of 5 trials of 12 calls, got %+v", est.Rounds)
+	}
+	if est.Expected.Calls != 60 || est.WorstCase.Calls != 60 {
+		t.Errorf("expected 60 calls, got %d expected and %d worst case", est.Expected.Calls, est.WorstCase.Calls)
+	}
+}
+
+func TestEstimateFromReader_Pointwise(t *testing.T) {
+	var lines []string
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+
+	config := estimateTestConfig(&promptLogProvider{})
+	config.Mode = ModePointwise
+	config.Rubric = "rubric"
+	config.ScoreBatchSize = 4
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	est, err := ranker.EstimateFromReader(strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("EstimateFromReader failed: %v", err)
+	}
+
+	// 3 samples of 3 batches, with no listwise rounds
+	if len(est.Rounds) != 1 || est.Rounds[0].BatchesPerTrial != 3 || est.Rounds[0].ExpectedTrials != 3 {
+		t.Fatalf("expected one round of 3 trials of 3 calls, got %+v", est.Rounds)
+	}
+	if est.Expected.Calls != 9 || est.WorstCase.Calls != 9 {
+		t.Errorf("expected 9 calls, got %d expected and %d worst case", est.Expected.Calls, est.WorstCase.Calls)
+	}
+}
+
+func TestEstimateFromReader_Criteria(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+
+	config := estimateTestConfig(&promptLogProvider{})
+	config.InitialPrompt = ""
+	config.Criteria = []Criterion{
+		{Name: "severity", Prompt: "Rank by severity", Weight: 2},
+		{Name: "exploitability", Prompt: "Rank by how easy each finding is to exploit", Weight: 1},
+	}
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	est, err := ranker.EstimateFromReader(strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("EstimateFromReader failed: %v", err)
+	}
+
+	// Each criterion runs the rounds of 20, 10, 5 and 2 documents
+	if len(est.Rounds) != 8 || est.Rounds[0].Criterion != "severity" || est.Rounds[4].Criterion != "exploitability" {
+		t.Fatalf("expected 4 rounds per criterion, got %+v", est.Rounds)
+	}
+	if want := 2 * (4 + 2 + 1 + 1) * 10; est.Expected.Calls != want {
+		t.Errorf("expected %d calls, got %d", want, est.Expected.Calls)
+	}
+	if est.Rounds[4].ExpectedUsage.InputTokens <= est.Rounds[0].ExpectedUsage.InputTokens {
+		t.Errorf("expected the longer criterion prompt to cost more, got %d and %d",
+			est.Rounds[0].ExpectedUsage.InputTokens, est.Rounds[4].ExpectedUsage.InputTokens)
+	}
+}
@@ -0,0 +1,146 @@
+package siftrank
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EventType identifies what an Event reports
+type EventType string
+
+const (
+	// EventRoundStarted is sent when a round starts ranking its documents
+	EventRoundStarted EventType = "round_started"
+	// EventBatchCompleted is sent when a batch (or pair, or scoring call)
+	// has been ranked
+	EventBatchCompleted EventType = "batch_completed"
+	// EventTrialCompleted is sent when every batch of a trial (Swiss round,
+	// or pointwise sample) has been ranked
+	EventTrialCompleted EventType = "trial_completed"
+	// EventConverged is sent when a round stops early because its ranking
+	// settled
+	EventConverged EventType = "converged"
+	// EventRelevanceSummarized is sent when a document's relevance snippets
+	// have been summarized
+	EventRelevanceSummarized EventType = "relevance_summarized"
+	// EventError is sent when a batch or summary fails. The run may still
+	// complete (e.g. with the batch missing from a trial).
+	EventError EventType = "error"
+)
+
+// Event is a progress report passed to Config.OnEvent. Fields that do not
+// apply to the event's Type are left zero.
+type Event struct {
+	Type      EventType `json:"type"`
+	Time      time.Time `json:"time"`
+	Criterion string    `json:"criterion,omitempty"` // Criterion being ranked (multi-criteria runs only)
+	Round     int       `json:"round"`
+	Trial     int       `json:"trial,omitempty"` // Trial, Swiss round or pointwise sample
+	Batch     int       `json:"batch,omitempty"` // 1-based batch within the trial
+
+	// Round started
+	Documents int `json:"documents,omitempty"` // Documents ranked in the round
+
+	// Batch completed: the batch's calls (including retries) and tokens.
+	// Trial completed: the run's tokens so far.
+	Calls int   `json:"calls,omitempty"`
+	Usage Usage `json:"usage"`
+
+	// Trial completed
+	TrialsCompleted int             `json:"trials_completed,omitempty"`
+	Ranking         []TrialDocument `json:"ranking,omitempty"`        // Ranking so far, best first
+	ElbowPosition   *int            `json:"elbow_position,omitempty"` // Latest elbow (convergence only, nil if not detected)
+	StableTrials    int             `json:"stable_trials,omitempty"`  // Trials the elbow has held still (convergence only)
+
+	// Converged
+	ConvergenceReason ConvergenceReason `json:"convergence_reason,omitempty"`
+
+	// Relevance summarized
+	Key       string             `json:"key,omitempty"`
+	Relevance *RelevanceProsCons `json:"relevance,omitempty"`
+
+	// Error
+	Err error `json:"-"`
+}
+
+// Top returns the first k documents of the event's ranking (all of them if
+// there are fewer than k)
+func (e Event) Top(k int) []TrialDocument {
+	return e.Ranking[:min(k, len(e.Ranking))]
+}
+
+// hasSubscribers reports whether trial rankings are wanted by anyone, since
+// they are costly to build
+func (r *Ranker) hasSubscribers() bool {
+	return r.traceFile != nil || (r.cfg.Watch && r.screen != nil) || r.cfg.OnEvent != nil
+}
+
+// emit passes event to the trace writer, the watch view and Config.OnEvent,
+// one event at a time
+func (r *Ranker) emit(event Event) {
+	event.Time = time.Now()
+	event.Criterion = r.criterionName()
+	if event.Round == 0 {
+		event.Round = r.round
+	}
+
+	r.eventMu.Lock()
+	defer r.eventMu.Unlock()
+
+	if err := r.traceEvent(event); err != nil {
+		r.cfg.Logger.Error("Failed to write trace line", "error", err)
+	}
+	if r.cfg.Watch && r.screen != nil && event.Type == EventTrialCompleted {
+		r.renderVisualization(event.Ranking, event.Round, event.Trial)
+	}
+	if r.cfg.OnEvent != nil {
+		r.cfg.OnEvent(event)
+	}
+}
+
+// emitError reports a failed batch or summary, unless it failed because the
+// run was canceled or ran out of budget
+func (r *Ranker) emitError(event Event, err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errBudgetExceeded) {
+		return
+	}
+	event.Type = EventError
+	event.Err = err
+	r.emit(event)
+}
+
+// traceEvent writes a trial's ranking to the trace file
+func (r *Ranker) traceEvent(event Event) error {
+	if r.traceFile == nil || event.Type != EventTrialCompleted {
+		return nil
+	}
+
+	trace := traceLine{
+		Criterion:         event.Criterion,
+		Round:             event.Round,
+		Trial:             event.Trial,
+		TrialsCompleted:   event.TrialsCompleted,
+		TrialsRemaining:   r.cfg.NumTrials - event.TrialsCompleted,
+		TotalInputTokens:  event.Usage.InputTokens,
+		TotalOutputTokens: event.Usage.OutputTokens,
+		ElbowPosition:     event.ElbowPosition,
+		StableTrialsCount: event.StableTrials,
+		Rankings:          event.Ranking,
+	}
+	data, err := json.Marshal(trace)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trace line: %w", err)
+	}
+	if _, err := r.traceFile.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write trace line: %w", err)
+	}
+
+	// Flush to disk immediately
+	if err := r.traceFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync trace file: %w", err)
+	}
+	return nil
+}
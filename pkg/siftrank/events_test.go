@@ -0,0 +1,150 @@
+package siftrank
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// failingProvider fails every call
+type failingProvider struct{}
+
+func (failingProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	return "", errors.New("provider unavailable")
+}
+
+func eventsTestConfig(provider LLMProvider, events *[]Event) *Config {
+	config := testConfig(provider)
+	config.BatchSize = 10
+	config.NumTrials = 4
+	config.OnEvent = func(event Event) {
+		*events = append(*events, event)
+	}
+	return config
+}
+
+func TestRanker_OnEvent(t *testing.T) {
+	var events []Event
+	ranker, err := NewRanker(eventsTestConfig(&oracleProvider{}, &events))
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(itemsInput(30)), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+
+	if len(events) == 0 || events[0].Type != EventRoundStarted || events[0].Round != 1 || events[0].Documents != 30 {
+		t.Fatalf("expected the first event to start round 1 with 30 documents, got %+v", events[0])
+	}
+
+	counts := make(map[EventType]int)
+	var batchUsage Usage
+	for _, event := range events {
+		counts[event.Type]++
+		if event.Time.IsZero() {
+			t.Errorf("%s: expected a timestamp", event.Type)
+		}
+		switch event.Type {
+		case EventBatchCompleted:
+			batchUsage.Add(event.Usage)
+			if event.Trial < 1 || event.Batch < 1 || event.Calls != 1 {
+				t.Errorf("expected a numbered batch of one call, got %+v", event)
+			}
+		case EventTrialCompleted:
+			for i := 1; i < len(event.Ranking); i++ {
+				if event.Ranking[i].Score < event.Ranking[i-1].Score {
+					t.Errorf("round %d trial %d: ranking not sorted best first", event.Round, event.Trial)
+				}
+			}
+			if top := event.Top(3); len(top) != 3 || top[0].ID != event.Ranking[0].ID {
+				t.Errorf("expected the top 3 documents, got %+v", top)
+			}
+		}
+	}
+
+	if counts[EventRoundStarted] != len(result.Rounds) {
+		t.Errorf("expected %d round started events, got %d", len(result.Rounds), counts[EventRoundStarted])
+	}
+	if counts[EventBatchCompleted] != result.NumBatches {
+		t.Errorf("expected %d batch completed events, got %d", result.NumBatches, counts[EventBatchCompleted])
+	}
+	if batchUsage != result.Usage {
+		t.Errorf("expected batch usage to add up to %+v, got %+v", result.Usage, batchUsage)
+	}
+	if counts[EventTrialCompleted] != result.NumTrials {
+		t.Errorf("expected %d trial completed events, got %d", result.NumTrials, counts[EventTrialCompleted])
+	}
+	if counts[EventError] != 0 || counts[EventConverged] != 0 {
+		t.Errorf("expected no error or convergence events, got %v", counts)
+	}
+}
+
+func TestRanker_OnEventConverged(t *testing.T) {
+	var events []Event
+	config := eventsTestConfig(&oracleProvider{}, &events)
+	config.NumTrials = 30
+	config.EnableConvergence = true
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(itemsInput(50)), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+
+	converged := make(map[int]ConvergenceReason)
+	for _, event := range events {
+		if event.Type == EventConverged {
+			if _, ok := converged[event.Round]; ok {
+				t.Errorf("round %d: expected one convergence event", event.Round)
+			}
+			converged[event.Round] = event.ConvergenceReason
+		}
+	}
+	if len(converged) == 0 {
+		t.Fatal("expected a convergence event")
+	}
+	for _, stats := range result.Rounds {
+		if reason, ok := converged[stats.Round]; ok && reason != stats.ConvergenceReason {
+			t.Errorf("round %d: expected reason %s, got %s", stats.Round, stats.ConvergenceReason, reason)
+		}
+	}
+}
+
+func TestRanker_OnEventError(t *testing.T) {
+	var events []Event
+	config := eventsTestConfig(failingProvider{}, &events)
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	if _, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(itemsInput(20)), "{{.Data}}", false); err == nil {
+		t.Fatal("expected the run to fail")
+	}
+
+	var errorEvents int
+	for _, event := range events {
+		if event.Type == EventError {
+			errorEvents++
+			if event.Err == nil || event.Trial < 1 || event.Batch < 1 {
+				t.Errorf("expected a batch error, got %+v", event)
+			}
+		}
+	}
+	if errorEvents == 0 {
+		t.Error("expected error events")
+	}
+}
+
+func TestEvent_Top(t *testing.T) {
+	event := Event{Ranking: []TrialDocument{{ID: "a"}, {ID: "b"}}}
+	if top := event.Top(5); len(top) != 2 {
+		t.Errorf("expected the whole ranking, got %d documents", len(top))
+	}
+	if top := event.Top(1); len(top) != 1 || top[0].ID != "a" {
+		t.Errorf("expected the first document, got %+v", top)
+	}
+}
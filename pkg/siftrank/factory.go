@@ -23,6 +23,66 @@ const (
 	ProviderTypeOllama     ProviderType = "ollama"
 )
 
+// DefaultOllamaBaseURL is used for Ollama when OLLAMA_BASE_URL is not set
+const DefaultOllamaBaseURL = "http://localhost:11434"
+
+// DefaultOpenRouterBaseURL is used for OpenRouter when no base URL is configured
+const DefaultOpenRouterBaseURL = "https://openrouter.ai/api/v1"
+
+// ProviderTypes lists every provider type understood by NewProvider
+var ProviderTypes = []ProviderType{
+	ProviderTypeOpenAI,
+	ProviderTypeAnthropic,
+	ProviderTypeOpenRouter,
+	ProviderTypeOllama,
+	ProviderTypeGoogle,
+}
+
+// ParseProviderType converts a provider name (e.g. from a CLI flag) into a ProviderType
+func ParseProviderType(name string) (ProviderType, error) {
+	providerType := ProviderType(strings.ToLower(strings.TrimSpace(name)))
+	for _, known := range ProviderTypes {
+		if providerType == known {
+			return providerType, nil
+		}
+	}
+	return "", fmt.Errorf("unknown provider type: %s", name)
+}
+
+// ProviderConfigFromEnv returns a ProviderConfig for the given provider type with
+// credentials read from the provider's environment variables:
+//   - OpenAI: OPENAI_API_KEY
+//   - Anthropic: ANTHROPIC_API_KEY
+//   - OpenRouter: OPENROUTER_API_KEY
+//   - Google: GOOGLE_API_KEY
+//   - Ollama: OLLAMA_BASE_URL (defaults to DefaultOllamaBaseURL)
+//
+// Model and other options are left for the caller to fill in.
+func ProviderConfigFromEnv(providerType ProviderType) (ProviderConfig, error) {
+	cfg := ProviderConfig{Type: providerType}
+
+	switch providerType {
+	case ProviderTypeOpenAI:
+		cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+	case ProviderTypeOpenRouter:
+		cfg.APIKey = os.Getenv("OPENROUTER_API_KEY")
+	case ProviderTypeAnthropic:
+		cfg.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+	case ProviderTypeOllama:
+		// Ollama typically doesn't need API key
+		cfg.BaseURL = os.Getenv("OLLAMA_BASE_URL")
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = DefaultOllamaBaseURL
+		}
+	case ProviderTypeGoogle:
+		cfg.APIKey = os.Getenv("GOOGLE_API_KEY")
+	default:
+		return cfg, fmt.Errorf("unknown provider type: %s", providerType)
+	}
+
+	return cfg, nil
+}
+
 // ProviderConfig contains common configuration for all providers
 type ProviderConfig struct {
 	// Provider type (required)
@@ -67,7 +127,7 @@ func NewProvider(cfg ProviderConfig) (LLMProvider, error) {
 	case ProviderTypeAnthropic:
 		return newAnthropicProvider(cfg, logger)
 	case ProviderTypeGoogle:
-		return nil, fmt.Errorf("google provider not yet implemented")
+		return newGeminiProvider(cfg, logger)
 	case ProviderTypeOllama:
 		return newOllamaProvider(cfg, logger)
 	default:
@@ -89,10 +149,16 @@ func newOpenAICompatibleProvider(cfg ProviderConfig, logger *slog.Logger) (LLMPr
 		encoding = DefaultEncoding
 	}
 
+	// OpenRouter is only reachable through its own endpoint
+	baseURL := cfg.BaseURL
+	if baseURL == "" && cfg.Type == ProviderTypeOpenRouter {
+		baseURL = DefaultOpenRouterBaseURL
+	}
+
 	return NewOpenAIProvider(OpenAIConfig{
 		Auth:     NewBearerAuth(cfg.APIKey),
 		Model:    openai.ChatModel(cfg.Model),
-		BaseURL:  cfg.BaseURL,
+		BaseURL:  baseURL,
 		Encoding: encoding,
 		Effort:   cfg.Effort,
 		Logger:   logger,
@@ -121,6 +187,28 @@ func newAnthropicProvider(cfg ProviderConfig, logger *slog.Logger) (LLMProvider,
 	})
 }
 
+// newGeminiProvider creates a provider for Google Gemini
+func newGeminiProvider(cfg ProviderConfig, logger *slog.Logger) (LLMProvider, error) {
+	// Gemini API keys are passed in the "key" query parameter
+	if cfg.APIKey == "" {
+		return nil, fmt.Errorf("google provider requires an API key")
+	}
+
+	// Default encoding for Gemini (tiktoken is only an approximation here)
+	encoding := cfg.Encoding
+	if encoding == "" {
+		encoding = DefaultEncoding
+	}
+
+	return NewGeminiProvider(GeminiConfig{
+		Auth:     NewQueryAuth("key", cfg.APIKey),
+		Model:    cfg.Model,
+		BaseURL:  cfg.BaseURL,
+		Encoding: encoding,
+		Logger:   logger,
+	})
+}
+
 // newOllamaProvider creates a provider for Ollama
 func newOllamaProvider(cfg ProviderConfig, logger *slog.Logger) (LLMProvider, error) {
 	// Ollama uses optional authentication
@@ -266,38 +354,14 @@ func NewEvalProvider(compareModels string, logger *slog.Logger) (LLMProvider, *e
 		// Construct full model identifier (used as key)
 		fullModelID := spec
 
-		// Determine API key based on provider
-		apiKey := ""
-		baseURL := ""
-
-		switch providerType {
-		case ProviderTypeOpenAI:
-			apiKey = os.Getenv("OPENAI_API_KEY")
-		case ProviderTypeOpenRouter:
-			apiKey = os.Getenv("OPENROUTER_API_KEY")
-		case ProviderTypeOllama:
-			// Ollama typically doesn't need API key
-			baseURL = os.Getenv("OLLAMA_BASE_URL")
-			if baseURL == "" {
-				baseURL = "http://localhost:11434"
-			}
-		case ProviderTypeAnthropic:
-			apiKey = os.Getenv("ANTHROPIC_API_KEY")
-		case ProviderTypeGoogle:
-			return nil, nil, fmt.Errorf("google provider not yet implemented")
-		default:
-			return nil, nil, fmt.Errorf("unknown provider type: %s", providerType)
-		}
-
-		// Create provider config
-		cfg := ProviderConfig{
-			Type:     providerType,
-			APIKey:   apiKey,
-			Model:    modelID,
-			BaseURL:  baseURL,
-			Encoding: DefaultEncoding,
-			Logger:   logger,
+		// Read credentials for this provider from the environment
+		cfg, err := ProviderConfigFromEnv(providerType)
+		if err != nil {
+			return nil, nil, err
 		}
+		cfg.Model = modelID
+		cfg.Encoding = DefaultEncoding
+		cfg.Logger = logger
 
 		// Create provider
 		provider, err := NewProvider(cfg)
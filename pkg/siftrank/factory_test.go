@@ -144,17 +144,40 @@ func TestNewProvider_OllamaMissingBaseURL(t *testing.T) {
 	}
 }
 
-func TestNewProvider_UnimplementedProvider(t *testing.T) {
+func TestNewProvider_Google(t *testing.T) {
 	cfg := ProviderConfig{
 		Type:     ProviderTypeGoogle,
 		APIKey:   "test-key",
-		Model:    "gemini-pro",
+		Model:    "gemini-2.0-flash",
+		Encoding: "o200k_base",
+	}
+
+	provider, err := NewProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+
+	if provider == nil {
+		t.Fatal("Expected non-nil provider")
+	}
+
+	// Verify it implements TokenEstimator (Gemini provider should)
+	_, ok := provider.(TokenEstimator)
+	if !ok {
+		t.Fatal("Gemini provider should implement TokenEstimator interface")
+	}
+}
+
+func TestNewProvider_Google_MissingAPIKey(t *testing.T) {
+	cfg := ProviderConfig{
+		Type:     ProviderTypeGoogle,
+		Model:    "gemini-2.0-flash",
 		Encoding: "o200k_base",
 	}
 
 	_, err := NewProvider(cfg)
 	if err == nil {
-		t.Fatal("Expected error for unimplemented Google provider")
+		t.Fatal("Expected error for missing API key")
 	}
 }
 
@@ -200,3 +223,60 @@ func TestNewProvider_Anthropic_MissingAPIKey(t *testing.T) {
 		t.Fatal("Expected error for missing API key")
 	}
 }
+
+func TestParseProviderType(t *testing.T) {
+	for _, name := range []string{"openai", "anthropic", "openrouter", "ollama", "google", " Anthropic "} {
+		if _, err := ParseProviderType(name); err != nil {
+			t.Errorf("ParseProviderType(%q) unexpected error: %v", name, err)
+		}
+	}
+
+	if _, err := ParseProviderType("bedrock"); err == nil {
+		t.Error("Expected error for unknown provider type")
+	}
+}
+
+func TestProviderConfigFromEnv(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "openai-key")
+	t.Setenv("ANTHROPIC_API_KEY", "anthropic-key")
+	t.Setenv("OPENROUTER_API_KEY", "openrouter-key")
+	t.Setenv("GOOGLE_API_KEY", "google-key")
+	t.Setenv("OLLAMA_BASE_URL", "")
+
+	tests := []struct {
+		providerType ProviderType
+		wantKey      string
+		wantBaseURL  string
+	}{
+		{ProviderTypeOpenAI, "openai-key", ""},
+		{ProviderTypeAnthropic, "anthropic-key", ""},
+		{ProviderTypeOpenRouter, "openrouter-key", ""},
+		{ProviderTypeGoogle, "google-key", ""},
+		{ProviderTypeOllama, "", DefaultOllamaBaseURL},
+	}
+
+	for _, tt := range tests {
+		cfg, err := ProviderConfigFromEnv(tt.providerType)
+		if err != nil {
+			t.Fatalf("ProviderConfigFromEnv(%s) unexpected error: %v", tt.providerType, err)
+		}
+		if cfg.Type != tt.providerType {
+			t.Errorf("ProviderConfigFromEnv(%s) type = %s", tt.providerType, cfg.Type)
+		}
+		if cfg.APIKey != tt.wantKey {
+			t.Errorf("ProviderConfigFromEnv(%s) key = %q, want %q", tt.providerType, cfg.APIKey, tt.wantKey)
+		}
+		if cfg.BaseURL != tt.wantBaseURL {
+			t.Errorf("ProviderConfigFromEnv(%s) base URL = %q, want %q", tt.providerType, cfg.BaseURL, tt.wantBaseURL)
+		}
+	}
+
+	t.Setenv("OLLAMA_BASE_URL", "http://gpu-server:11434")
+	cfg, err := ProviderConfigFromEnv(ProviderTypeOllama)
+	if err != nil {
+		t.Fatalf("ProviderConfigFromEnv(ollama) unexpected error: %v", err)
+	}
+	if cfg.BaseURL != "http://gpu-server:11434" {
+		t.Errorf("Expected OLLAMA_BASE_URL to be used, got %q", cfg.BaseURL)
+	}
+}
@@ -0,0 +1,288 @@
+package siftrank
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// InputFormat selects how input is split into documents
+type InputFormat string
+
+const (
+	// FormatText ranks each non-empty line, or each record if
+	// Config.RecordSeparator is set
+	FormatText InputFormat = "text"
+	// FormatJSON ranks each element of a JSON array
+	FormatJSON InputFormat = "json"
+	// FormatJSONL ranks each JSON value of a JSON Lines (NDJSON) file
+	FormatJSONL InputFormat = "jsonl"
+	// FormatCSV ranks each row of a comma-separated file with a header row
+	FormatCSV InputFormat = "csv"
+	// FormatTSV ranks each row of a tab-separated file with a header row
+	FormatTSV InputFormat = "tsv"
+)
+
+// validate reports whether the format is one of the known formats
+func (f InputFormat) validate() error {
+	switch f {
+	case FormatText, FormatJSON, FormatJSONL, FormatCSV, FormatTSV:
+		return nil
+	}
+	return fmt.Errorf("unknown input format %q (expected %s, %s, %s, %s or %s)", f, FormatText, FormatJSON, FormatJSONL, FormatCSV, FormatTSV)
+}
+
+// formatForPath picks the input format from a file's extension, falling back
+// to text
+func formatForPath(path string) InputFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".jsonl", ".ndjson":
+		return FormatJSONL
+	case ".csv":
+		return FormatCSV
+	case ".tsv":
+		return FormatTSV
+	}
+	return FormatText
+}
+
+// inputFormat returns the format to load input with: Config.InputFormat if
+// set, JSON if forced, and detected otherwise
+func (r *Ranker) inputFormat(forceJSON bool, detected InputFormat) InputFormat {
+	switch {
+	case r.cfg.InputFormat != "":
+		return r.cfg.InputFormat
+	case forceJSON:
+		return FormatJSON
+	}
+	return detected
+}
+
+// structuredValue renders a JSON value or CSV row for ranking: through the
+// template if there is one, else as JSON
+func structuredValue(value interface{}, tmpl *template.Template) (string, error) {
+	if tmpl == nil {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON value: %w", err)
+		}
+		return string(data), nil
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, value); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// loadJSONLDocuments reads one JSON value per line, skipping blank lines
+func (r *Ranker) loadJSONLDocuments(reader io.Reader, tmpl *template.Template) ([]document, error) {
+	buffered := bufio.NewReader(reader)
+
+	var documents []document
+	for lineNum := 1; ; lineNum++ {
+		line, readErr := buffered.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return nil, fmt.Errorf("failed to read content: %w", readErr)
+		}
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var value interface{}
+			if err := json.Unmarshal(line, &value); err != nil {
+				return nil, fmt.Errorf("line %d: invalid JSON: %w", lineNum, err)
+			}
+			valueStr, err := structuredValue(value, tmpl)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+
+			documents = append(documents, document{
+				ID:         ShortDeterministicID(valueStr, idLen),
+				Document:   value,
+				Value:      valueStr,
+				InputIndex: lineNum - 1,
+				fields:     value,
+			})
+		}
+
+		if readErr == io.EOF {
+			return documents, nil
+		}
+	}
+}
+
+// loadDelimitedDocuments reads CSV or TSV rows under a header row. Each row
+// is a map from column name to field, for the template and the result.
+func (r *Ranker) loadDelimitedDocuments(reader io.Reader, tmpl *template.Template, format InputFormat) ([]document, error) {
+	name := strings.ToUpper(string(format))
+	csvReader := csv.NewReader(reader)
+	if format == FormatTSV {
+		csvReader.Comma = '\t'
+		csvReader.LazyQuotes = true // TSV fields are rarely quoted
+	}
+
+	header, err := csvReader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s header: %w", name, err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // Byte order mark from spreadsheet exports
+	}
+	columns := make(map[string]bool, len(header))
+	for i, column := range header {
+		if column == "" {
+			return nil, fmt.Errorf("line 1: %s column %d has no name", name, i+1)
+		}
+		if columns[column] {
+			return nil, fmt.Errorf("line 1: %s column %q appears twice", name, column)
+		}
+		columns[column] = true
+	}
+
+	var documents []document
+	for {
+		record, err := csvReader.Read()
+		if errors.Is(err, io.EOF) {
+			return documents, nil
+		}
+		if err != nil {
+			// csv.ParseError carries the line number
+			return nil, fmt.Errorf("invalid %s: %w", name, err)
+		}
+
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			row[column] = record[i]
+		}
+		valueStr, err := structuredValue(row, tmpl)
+		if err != nil {
+			line, _ := csvReader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		documents = append(documents, document{
+			ID:         ShortDeterministicID(valueStr, idLen),
+			Document:   row,
+			Value:      valueStr,
+			InputIndex: len(documents),
+			fields:     row,
+		})
+	}
+}
+
+// recordSeparatorPattern compiles a record separator to match whole lines
+func recordSeparatorPattern(separator string) (*regexp.Regexp, error) {
+	pattern, err := regexp.Compile("^(?:" + separator + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid record separator: %w", err)
+	}
+	return pattern, nil
+}
+
+// loadRecordDocuments reads text records made of the lines between lines
+// matching Config.RecordSeparator. Leading and trailing blank lines are
+// dropped from each record, and records with nothing else are skipped.
+func (r *Ranker) loadRecordDocuments(reader io.Reader, tmpl *template.Template) ([]document, error) {
+	separator, err := recordSeparatorPattern(r.cfg.RecordSeparator)
+	if err != nil {
+		return nil, err
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content: %w", err)
+	}
+
+	var documents []document
+	var record []string
+	flush := func() error {
+		lines := record
+		record = nil
+		for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+			lines = lines[1:]
+		}
+		for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if len(lines) == 0 {
+			return nil
+		}
+		value := strings.Join(lines, "\n")
+
+		fields := map[string]string{"Data": value}
+		if tmpl != nil {
+			var tmplData bytes.Buffer
+			if err := tmpl.Execute(&tmplData, fields); err != nil {
+				return fmt.Errorf("failed to execute template on record %d: %w", len(documents)+1, err)
+			}
+			value = tmplData.String()
+		}
+
+		documents = append(documents, document{
+			ID:         ShortDeterministicID(value, idLen),
+			Value:      value,
+			InputIndex: len(documents),
+			fields:     fields,
+		})
+		return nil
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r") // Handle Windows line endings
+		if !separator.MatchString(line) {
+			record = append(record, line)
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// loadWholeFileDocument reads a file as a single document. The template sees
+// the file's Path (as given), Name and Data; the result keeps the path and
+// name.
+func (r *Ranker) loadWholeFileDocument(reader io.Reader, path string, tmpl *template.Template) ([]document, error) {
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content: %w", err)
+	}
+	data := strings.TrimRight(string(content), "\r\n")
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	value := data
+	fields := map[string]string{"Path": path, "Name": filepath.Base(path), "Data": data}
+	if tmpl != nil {
+		var tmplData bytes.Buffer
+		if err := tmpl.Execute(&tmplData, fields); err != nil {
+			return nil, fmt.Errorf("failed to execute template: %w", err)
+		}
+		value = tmplData.String()
+	}
+
+	return []document{{
+		ID:       ShortDeterministicID(value, idLen),
+		Document: map[string]string{"path": path, "name": filepath.Base(path)},
+		Value:    value,
+		fields:   fields,
+	}}, nil
+}
@@ -0,0 +1,272 @@
+package siftrank
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func formatsTestRanker(t *testing.T, format InputFormat) *Ranker {
+	t.Helper()
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.LLMProvider = echoRankProvider{}
+	config.InputFormat = format
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	return ranker
+}
+
+func TestFormatForPath(t *testing.T) {
+	tests := map[string]InputFormat{
+		"data.txt":     FormatText,
+		"data":         FormatText,
+		"data.json":    FormatJSON,
+		"data.JSONL":   FormatJSONL,
+		"data.ndjson":  FormatJSONL,
+		"dir/data.csv": FormatCSV,
+		"data.tsv":     FormatTSV,
+	}
+	for path, want := range tests {
+		if got := formatForPath(path); got != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+}
+
+func TestLoadJSONLDocuments(t *testing.T) {
+	ranker := formatsTestRanker(t, "")
+	input := "{\"title\": \"first\"}\n\n{\"title\": \"second\"}\r\n{\"title\": \"third\"}"
+
+	documents, err := ranker.loadDocumentsFromReader(strings.NewReader(input), "{{.title}}", FormatJSONL)
+	if err != nil {
+		t.Fatalf("loadDocumentsFromReader failed: %v", err)
+	}
+	if len(documents) != 3 {
+		t.Fatalf("expected 3 documents, got %d", len(documents))
+	}
+	for i, want := range []string{"first", "second", "third"} {
+		if documents[i].Value != want {
+			t.Errorf("document %d: expected %q, got %q", i, want, documents[i].Value)
+		}
+	}
+	if documents[1].InputIndex != 2 {
+		t.Errorf("expected the input index to count lines, got %d", documents[1].InputIndex)
+	}
+	if !reflect.DeepEqual(documents[0].Document, map[string]interface{}{"title": "first"}) {
+		t.Errorf("expected the original object, got %v", documents[0].Document)
+	}
+
+	_, err = ranker.loadDocumentsFromReader(strings.NewReader("{\"title\": \"ok\"}\n{\"title\": }\n"), "{{.title}}", FormatJSONL)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error naming line 2, got %v", err)
+	}
+}
+
+func TestLoadDelimitedDocuments(t *testing.T) {
+	ranker := formatsTestRanker(t, "")
+	input := "\ufefftitle,body\nfirst,\"one, with a comma\"\nsecond,two\n"
+
+	documents, err := ranker.loadDocumentsFromReader(strings.NewReader(input), "{{.title}}: {{.body}}", FormatCSV)
+	if err != nil {
+		t.Fatalf("loadDocumentsFromReader failed: %v", err)
+	}
+	if len(documents) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(documents))
+	}
+	if documents[0].Value != "first: one, with a comma" || documents[1].Value != "second: two" {
+		t.Errorf("unexpected values %q and %q", documents[0].Value, documents[1].Value)
+	}
+	if !reflect.DeepEqual(documents[0].Document, map[string]string{"title": "first", "body": "one, with a comma"}) {
+		t.Errorf("expected the original row, got %v", documents[0].Document)
+	}
+
+	documents, err = ranker.loadDocumentsFromReader(strings.NewReader("title\tbody\nfirst\ta \"quoted\" word\n"), "{{.body}}", FormatTSV)
+	if err != nil {
+		t.Fatalf("loadDocumentsFromReader failed: %v", err)
+	}
+	if len(documents) != 1 || documents[0].Value != "a \"quoted\" word" {
+		t.Errorf("expected one TSV row, got %+v", documents)
+	}
+
+	_, err = ranker.loadDocumentsFromReader(strings.NewReader("title,body\nfirst,one\nsecond\n"), "{{.title}}", FormatCSV)
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected an error naming line 3, got %v", err)
+	}
+
+	_, err = ranker.loadDocumentsFromReader(strings.NewReader("title,title\nfirst,one\n"), "{{.title}}", FormatCSV)
+	if err == nil {
+		t.Error("expected an error for a repeated column")
+	}
+}
+
+func TestLoadDocumentsFromFile_Formats(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		return path
+	}
+
+	// Picked by extension
+	ranker := formatsTestRanker(t, "")
+	documents, err := ranker.loadDocumentsFromFile(write("rows.csv", "name\nalpha\nbeta\n"), "{{.name}}", false)
+	if err != nil {
+		t.Fatalf("loadDocumentsFromFile failed: %v", err)
+	}
+	if len(documents) != 2 || documents[0].Value != "alpha" {
+		t.Errorf("expected two CSV rows, got %+v", documents)
+	}
+
+	// Config.InputFormat overrides the extension
+	ranker = formatsTestRanker(t, FormatJSONL)
+	documents, err = ranker.loadDocumentsFromFile(write("export.txt", "{\"name\": \"alpha\"}\n"), "{{.name}}", false)
+	if err != nil {
+		t.Fatalf("loadDocumentsFromFile failed: %v", err)
+	}
+	if len(documents) != 1 || documents[0].Value != "alpha" {
+		t.Errorf("expected one JSON Lines document, got %+v", documents)
+	}
+}
+
+func TestLoadRecordDocuments(t *testing.T) {
+	ranker := formatsTestRanker(t, "")
+	ranker.cfg.RecordSeparator = "---"
+	input := "---\npanic: boom\n  at main.go:10\n\n---\n\n---\r\nsecond\r\nrecord\r\n"
+
+	documents, err := ranker.loadDocumentsFromReader(strings.NewReader(input), "{{.Data}}", FormatText)
+	if err != nil {
+		t.Fatalf("loadDocumentsFromReader failed: %v", err)
+	}
+	if len(documents) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(documents))
+	}
+	if documents[0].Value != "panic: boom\n  at main.go:10" || documents[1].Value != "second\nrecord" {
+		t.Errorf("unexpected records %q and %q", documents[0].Value, documents[1].Value)
+	}
+	if documents[1].InputIndex != 1 {
+		t.Errorf("expected the input index to count records, got %d", documents[1].InputIndex)
+	}
+
+	// Blank lines as the separator
+	ranker.cfg.RecordSeparator = `\s*`
+	documents, err = ranker.loadDocumentsFromReader(strings.NewReader("first\nparagraph\n\n  \n\nsecond\n"), "", FormatText)
+	if err != nil {
+		t.Fatalf("loadDocumentsFromReader failed: %v", err)
+	}
+	if len(documents) != 2 || documents[0].Value != "first\nparagraph" || documents[1].Value != "second" {
+		t.Errorf("expected two paragraphs, got %+v", documents)
+	}
+}
+
+func TestLoadDocumentsFromFile_WholeFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "trace.log")
+	if err := os.WriteFile(path, []byte("line one\nline two\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	ranker := formatsTestRanker(t, "")
+	ranker.cfg.WholeFile = true
+	documents, err := ranker.loadDocumentsFromFile(path, "{{.Name}} ({{.Path}}):\n{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("loadDocumentsFromFile failed: %v", err)
+	}
+	if len(documents) != 1 {
+		t.Fatalf("expected 1 document, got %d", len(documents))
+	}
+	if want := "trace.log (" + path + "):\nline one\nline two"; documents[0].Value != want {
+		t.Errorf("expected %q, got %q", want, documents[0].Value)
+	}
+	if !reflect.DeepEqual(documents[0].Document, map[string]string{"path": path, "name": "trace.log"}) {
+		t.Errorf("expected the file's path and name, got %v", documents[0].Document)
+	}
+}
+
+func TestLoadDocumentsFromFiles_WholeFileIndexes(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("contents of "+name+"\n"), 0600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	ranker := formatsTestRanker(t, "")
+	ranker.cfg.WholeFile = true
+	documents, err := ranker.loadDocumentsFromFiles(paths, "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("loadDocumentsFromFiles failed: %v", err)
+	}
+	for i, doc := range documents {
+		if doc.InputIndex != i {
+			t.Errorf("expected %s to have input index %d, got %d", doc.Value, i, doc.InputIndex)
+		}
+	}
+}
+
+func TestRanker_SourceDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "logs", "api"), 0755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	first := filepath.Join(dir, "top.txt")
+	second := filepath.Join(dir, "logs", "api", "errors.txt")
+	if err := os.WriteFile(first, []byte("alpha\nbeta\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.WriteFile(second, []byte("gamma\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	ranker := formatsTestRanker(t, "")
+	ranker.cfg.SourceDir = dir
+	result, err := ranker.RankFromFilesResult(context.Background(), []string{first, second}, "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromFilesResult failed: %v", err)
+	}
+	want := map[string]string{"alpha": "top.txt", "beta": "top.txt", "gamma": "logs/api/errors.txt"}
+	for _, doc := range result.Documents {
+		if doc.Source != want[doc.Value] {
+			t.Errorf("%s: expected source %q, got %q", doc.Value, want[doc.Value], doc.Source)
+		}
+	}
+
+	if got := sourcePath(filepath.Join(dir, "logs"), first); got != first {
+		t.Errorf("expected a file outside the directory to keep its path, got %q", got)
+	}
+}
+
+func TestConfig_ValidateInputFormat(t *testing.T) {
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.LLMProvider = echoRankProvider{}
+	config.InputFormat = "xml"
+	if err := config.Validate(); err == nil {
+		t.Error("expected an unknown input format to be rejected")
+	}
+
+	config.InputFormat = ""
+	config.RecordSeparator = "("
+	if err := config.Validate(); err == nil {
+		t.Error("expected an invalid record separator to be rejected")
+	}
+
+	config.RecordSeparator = "---"
+	config.WholeFile = true
+	if err := config.Validate(); err == nil {
+		t.Error("expected a record separator in whole file mode to be rejected")
+	}
+}
@@ -0,0 +1,385 @@
+package siftrank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// DefaultGeminiBaseURL is the Generative Language API endpoint used when no BaseURL is set
+const DefaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// GeminiProvider implements LLMProvider using the Google Gemini
+// (Generative Language) REST API
+type GeminiProvider struct {
+	client   *http.Client
+	model    string
+	baseURL  string
+	logger   *slog.Logger
+	encoding *tiktoken.Tiktoken
+}
+
+// GeminiConfig configures the Gemini provider
+type GeminiConfig struct {
+	Auth     AuthStrategy // Authentication strategy (QueryAuth with "key" for Gemini API keys)
+	Model    string       // Model identifier (e.g., "gemini-2.0-flash")
+	BaseURL  string       // Optional: defaults to DefaultGeminiBaseURL
+	Encoding string       // Tokenizer encoding (approximation; Gemini does not use tiktoken)
+	Logger   *slog.Logger
+}
+
+// geminiPart is a single piece of content in a Gemini request or response
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+// geminiContent is a turn in a Gemini conversation
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiGenerationConfig controls sampling and structured output
+type geminiGenerationConfig struct {
+	Temperature      *float64    `json:"temperature,omitempty"`
+	MaxOutputTokens  *int        `json:"maxOutputTokens,omitempty"`
+	ResponseMimeType string      `json:"responseMimeType,omitempty"`
+	ResponseSchema   interface{} `json:"responseSchema,omitempty"`
+}
+
+// geminiRequest is the body of a generateContent call
+type geminiRequest struct {
+	Contents         []geminiContent         `json:"contents"`
+	GenerationConfig *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// geminiResponse is the subset of the generateContent response used by siftrank
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+	ResponseID   string `json:"responseId"`
+}
+
+// NewGeminiProvider creates a new Gemini provider
+func NewGeminiProvider(cfg GeminiConfig) (*GeminiProvider, error) {
+	// Create encoding
+	encoding, err := tiktoken.GetEncoding(cfg.Encoding)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tiktoken encoding: %w", err)
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultGeminiBaseURL
+	}
+
+	// Auth is applied by the transport so it also covers query-parameter keys
+	httpClient := &http.Client{
+		Transport: &authTransport{
+			Transport: http.DefaultTransport,
+			Auth:      cfg.Auth,
+		},
+	}
+
+	return &GeminiProvider{
+		client:   httpClient,
+		model:    strings.TrimPrefix(cfg.Model, "models/"),
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		logger:   cfg.Logger,
+		encoding: encoding,
+	}, nil
+}
+
+// Complete implements LLMProvider.Complete
+// Handles network-level retries only. Returns raw response without validation.
+func (p *GeminiProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	backoff := time.Second
+	maxBackoff := 30 * time.Second
+
+	// Create default options if nil
+	if opts == nil {
+		opts = &CompletionOptions{}
+	}
+
+	// Build request body once; it does not change between attempts
+	body, err := p.buildRequest(prompt, opts)
+	if err != nil {
+		return "", err
+	}
+
+	var totalUsage Usage
+
+	for {
+		// Check if context cancelled
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		// Create timeout context for this attempt
+		timeoutCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+		statusCode, headers, respBody, err := p.send(timeoutCtx, body)
+		cancel() // Cancel immediately after API call to avoid resource leak
+
+		if err == nil && statusCode == http.StatusOK {
+			var response geminiResponse
+			if err := json.Unmarshal(respBody, &response); err != nil {
+				return "", fmt.Errorf("failed to decode gemini response: %w", err)
+			}
+
+			// Success! Populate usage and metadata
+			callUsage := Usage{
+				InputTokens:     response.UsageMetadata.PromptTokenCount,
+				OutputTokens:    response.UsageMetadata.CandidatesTokenCount,
+				ReasoningTokens: response.UsageMetadata.ThoughtsTokenCount,
+			}
+
+			totalUsage.Add(callUsage)
+
+			// Populate output fields in opts
+			opts.Usage = totalUsage
+			opts.ModelUsed = response.ModelVersion
+			if opts.ModelUsed == "" {
+				opts.ModelUsed = p.model
+			}
+			opts.RequestID = response.ResponseID
+
+			// Gemini returns candidates made of parts; concatenate the text of the first candidate
+			var contentBuilder strings.Builder
+			if len(response.Candidates) > 0 {
+				opts.FinishReason = response.Candidates[0].FinishReason
+				for _, part := range response.Candidates[0].Content.Parts {
+					contentBuilder.WriteString(part.Text)
+				}
+			}
+			content := contentBuilder.String()
+
+			p.logger.Debug("Gemini call successful",
+				"input_tokens", callUsage.InputTokens,
+				"output_tokens", callUsage.OutputTokens,
+				"reasoning_tokens", callUsage.ReasoningTokens,
+				"model", opts.ModelUsed)
+
+			// Return raw content - no validation
+			return content, nil
+		}
+
+		// Check if context cancelled
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		// Handle timeout
+		if errors.Is(err, context.DeadlineExceeded) {
+			p.logger.Debug("Request timeout, retrying", "backoff", backoff)
+			if err := sleepContext(ctx, backoff); err != nil {
+				return "", err
+			}
+			backoff = minDuration(backoff*2, maxBackoff)
+			continue
+		}
+
+		// Network-level failure - retry with backoff
+		if err != nil {
+			p.logger.Debug("Request failed, retrying", "error", err, "backoff", backoff)
+			if err := sleepContext(ctx, backoff); err != nil {
+				return "", err
+			}
+			backoff = minDuration(backoff*2, maxBackoff)
+			continue
+		}
+
+		// Handle rate limits (429)
+		if statusCode == http.StatusTooManyRequests {
+			if err := p.handleRateLimit(ctx, headers, respBody, &backoff, maxBackoff); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		// Handle server errors (5xx) - retry
+		if statusCode >= 500 && statusCode < 600 {
+			p.logger.Debug("Server error, retrying",
+				"status", statusCode,
+				"backoff", backoff)
+			if err := sleepContext(ctx, backoff); err != nil {
+				return "", err
+			}
+			backoff = minDuration(backoff*2, maxBackoff)
+			continue
+		}
+
+		// Client errors (4xx except 429) are unrecoverable
+		apiErr := fmt.Errorf("gemini API error: %s", strings.TrimSpace(string(respBody)))
+		if statusCode >= 400 && statusCode < 500 {
+			p.logger.Error("Unrecoverable client error",
+				"status", statusCode,
+				"error", apiErr)
+			return "", fmt.Errorf("unrecoverable error (status %d): %w",
+				statusCode, apiErr)
+		}
+
+		// Other unexpected statuses - retry with backoff
+		p.logger.Debug("Unexpected status, retrying", "status", statusCode, "backoff", backoff)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return "", err
+		}
+		backoff = minDuration(backoff*2, maxBackoff)
+	}
+}
+
+// buildRequest marshals the generateContent body for a prompt and its options
+func (p *GeminiProvider) buildRequest(prompt string, opts *CompletionOptions) ([]byte, error) {
+	request := geminiRequest{
+		Contents: []geminiContent{
+			{Role: "user", Parts: []geminiPart{{Text: prompt}}},
+		},
+	}
+
+	genConfig := &geminiGenerationConfig{
+		Temperature:     opts.Temperature,
+		MaxOutputTokens: opts.MaxTokens,
+	}
+
+	// Add structured output if schema provided
+	if opts.Schema != nil {
+		schema, err := toGeminiSchema(opts.Schema)
+		if err != nil {
+			return nil, err
+		}
+		genConfig.ResponseMimeType = "application/json"
+		genConfig.ResponseSchema = schema
+	}
+
+	if genConfig.Temperature != nil || genConfig.MaxOutputTokens != nil || genConfig.ResponseSchema != nil {
+		request.GenerationConfig = genConfig
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal gemini request: %w", err)
+	}
+	return body, nil
+}
+
+// send performs a single generateContent request and returns the raw response
+func (p *GeminiProvider) send(ctx context.Context, body []byte) (int, http.Header, []byte, error) {
+	endpoint := fmt.Sprintf("%s/models/%s:generateContent", p.baseURL, url.PathEscape(p.model))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+
+	return resp.StatusCode, resp.Header, respBody, nil
+}
+
+// handleRateLimit handles rate limit errors with intelligent backoff
+func (p *GeminiProvider) handleRateLimit(ctx context.Context, headers http.Header, body []byte, backoff *time.Duration, maxBackoff time.Duration) error {
+	if body != nil {
+		p.logger.Debug("Rate limit response body", "body", string(body))
+	}
+
+	// Extract suggested wait time from retry-after header
+	var retryAfter time.Duration
+	if retryAfterStr := headers.Get("Retry-After"); retryAfterStr != "" {
+		// Try parsing as seconds first
+		if seconds, err := strconv.Atoi(retryAfterStr); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		} else {
+			// Try parsing as duration
+			retryAfter, _ = time.ParseDuration(retryAfterStr)
+		}
+	}
+
+	p.logger.Debug("Rate limit exceeded",
+		"retry_after", retryAfter)
+
+	// Use suggested wait time if available, otherwise exponential backoff
+	if retryAfter > 0 {
+		p.logger.Debug("Waiting for rate limit reset", "duration", retryAfter)
+		if err := sleepContext(ctx, retryAfter); err != nil {
+			return err
+		}
+	} else {
+		p.logger.Debug("Waiting with exponential backoff", "duration", *backoff)
+		if err := sleepContext(ctx, *backoff); err != nil {
+			return err
+		}
+		*backoff = minDuration(*backoff*2, maxBackoff)
+	}
+	return nil
+}
+
+// EstimateTokens implements TokenEstimator.EstimateTokens
+func (p *GeminiProvider) EstimateTokens(text string) int {
+	return len(p.encoding.Encode(text, nil, nil))
+}
+
+// geminiUnsupportedSchemaKeys are JSON Schema keywords rejected by Gemini's
+// OpenAPI-subset responseSchema
+var geminiUnsupportedSchemaKeys = []string{"$schema", "$id", "$ref", "$defs", "definitions", "additionalProperties"}
+
+// toGeminiSchema converts a JSON schema (as produced by generateSchema) into
+// the OpenAPI subset accepted by Gemini's responseSchema
+func toGeminiSchema(schema interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+
+	var converted map[string]interface{}
+	if err := json.Unmarshal(raw, &converted); err != nil {
+		return nil, fmt.Errorf("failed to convert schema: %w", err)
+	}
+
+	stripSchemaKeys(converted)
+	return converted, nil
+}
+
+// stripSchemaKeys recursively removes keywords Gemini does not understand
+func stripSchemaKeys(node interface{}) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for _, key := range geminiUnsupportedSchemaKeys {
+			delete(n, key)
+		}
+		for _, child := range n {
+			stripSchemaKeys(child)
+		}
+	case []interface{}:
+		for _, child := range n {
+			stripSchemaKeys(child)
+		}
+	}
+}
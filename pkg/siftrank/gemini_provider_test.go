@@ -0,0 +1,376 @@
+package siftrank
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// geminiTestResponse builds a generateContent response with a single text candidate
+func geminiTestResponse(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"candidates": []map[string]interface{}{
+			{
+				"content": map[string]interface{}{
+					"role":  "model",
+					"parts": []map[string]interface{}{{"text": text}},
+				},
+				"finishReason": "STOP",
+			},
+		},
+		"usageMetadata": map[string]interface{}{
+			"promptTokenCount":     12,
+			"candidatesTokenCount": 4,
+			"thoughtsTokenCount":   2,
+		},
+		"modelVersion": "gemini-2.0-flash",
+		"responseId":   "resp_123",
+	}
+}
+
+// newTestGeminiProvider creates a Gemini provider pointed at a test server
+func newTestGeminiProvider(t *testing.T, baseURL string) *GeminiProvider {
+	t.Helper()
+
+	provider, err := NewGeminiProvider(GeminiConfig{
+		Auth:     NewQueryAuth("key", "test-key"),
+		Model:    "gemini-2.0-flash",
+		BaseURL:  baseURL,
+		Encoding: "o200k_base",
+		Logger:   slog.Default(),
+	})
+	if err != nil {
+		t.Fatalf("NewGeminiProvider failed: %v", err)
+	}
+	return provider
+}
+
+// TestGeminiProviderImplementsInterfaces verifies interface compliance
+func TestGeminiProviderImplementsInterfaces(t *testing.T) {
+	provider := newTestGeminiProvider(t, "")
+
+	var _ LLMProvider = provider
+	var _ TokenEstimator = provider
+}
+
+// TestGeminiProviderComplete tests the Complete method with a mock server
+func TestGeminiProviderComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			t.Errorf("Expected POST request, got %s", r.Method)
+		}
+		if r.URL.Path != "/models/gemini-2.0-flash:generateContent" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+
+		// API key must travel in the query string, not a header
+		if r.URL.Query().Get("key") != "test-key" {
+			t.Errorf("Expected key query parameter 'test-key', got '%s'", r.URL.Query().Get("key"))
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected no Authorization header, got '%s'", r.Header.Get("Authorization"))
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Failed to read request body: %v", err)
+		}
+
+		var reqBody map[string]interface{}
+		if err := json.Unmarshal(body, &reqBody); err != nil {
+			t.Errorf("Failed to parse request body: %v", err)
+		}
+
+		contents := reqBody["contents"].([]interface{})
+		parts := contents[0].(map[string]interface{})["parts"].([]interface{})
+		if parts[0].(map[string]interface{})["text"] != "Hello!" {
+			t.Errorf("Expected prompt 'Hello!', got %v", parts[0])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(geminiTestResponse("Hello! I'm Gemini."))
+	}))
+	defer server.Close()
+
+	provider := newTestGeminiProvider(t, server.URL)
+
+	opts := &CompletionOptions{}
+	result, err := provider.Complete(context.Background(), "Hello!", opts)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	if result != "Hello! I'm Gemini." {
+		t.Errorf("Expected 'Hello! I'm Gemini.', got '%s'", result)
+	}
+
+	// Verify usage and metadata were populated
+	if opts.Usage.InputTokens != 12 {
+		t.Errorf("Expected 12 input tokens, got %d", opts.Usage.InputTokens)
+	}
+	if opts.Usage.OutputTokens != 4 {
+		t.Errorf("Expected 4 output tokens, got %d", opts.Usage.OutputTokens)
+	}
+	if opts.Usage.ReasoningTokens != 2 {
+		t.Errorf("Expected 2 reasoning tokens, got %d", opts.Usage.ReasoningTokens)
+	}
+	if opts.ModelUsed != "gemini-2.0-flash" {
+		t.Errorf("Expected model 'gemini-2.0-flash', got '%s'", opts.ModelUsed)
+	}
+	if opts.FinishReason != "STOP" {
+		t.Errorf("Expected finish reason 'STOP', got '%s'", opts.FinishReason)
+	}
+	if opts.RequestID != "resp_123" {
+		t.Errorf("Expected request ID 'resp_123', got '%s'", opts.RequestID)
+	}
+}
+
+// TestGeminiProviderSchema verifies the schema is sent as a Gemini responseSchema
+func TestGeminiProviderSchema(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var reqBody struct {
+			GenerationConfig map[string]interface{} `json:"generationConfig"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			t.Errorf("Failed to parse request body: %v", err)
+		}
+
+		genConfig := reqBody.GenerationConfig
+		if genConfig["responseMimeType"] != "application/json" {
+			t.Errorf("Expected responseMimeType application/json, got %v", genConfig["responseMimeType"])
+		}
+		if genConfig["temperature"] != 0.2 {
+			t.Errorf("Expected temperature 0.2, got %v", genConfig["temperature"])
+		}
+
+		schema, ok := genConfig["responseSchema"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected responseSchema object, got %v", genConfig["responseSchema"])
+		}
+		for _, key := range geminiUnsupportedSchemaKeys {
+			if _, found := schema[key]; found {
+				t.Errorf("responseSchema should not contain %q", key)
+			}
+		}
+		if _, ok := schema["properties"].(map[string]interface{})["docs"]; !ok {
+			t.Errorf("Expected docs property in responseSchema, got %v", schema["properties"])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(geminiTestResponse(`{"docs":["a","b"]}`))
+	}))
+	defer server.Close()
+
+	provider := newTestGeminiProvider(t, server.URL)
+
+	temp := 0.2
+	opts := &CompletionOptions{
+		Schema:      generateSchema[rankedDocumentResponseNoRelevance](),
+		Temperature: &temp,
+	}
+	result, err := provider.Complete(context.Background(), "Rank", opts)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	if result != `{"docs":["a","b"]}` {
+		t.Errorf("Unexpected result %s", result)
+	}
+}
+
+// TestGeminiProviderRateLimitRetry tests rate limit handling
+func TestGeminiProviderRateLimitRetry(t *testing.T) {
+	callCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		if callCount == 1 {
+			// First call: rate limited
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{"code": 429, "status": "RESOURCE_EXHAUSTED"},
+			})
+			return
+		}
+
+		// Second call: success
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(geminiTestResponse("Success after retry"))
+	}))
+	defer server.Close()
+
+	provider := newTestGeminiProvider(t, server.URL)
+
+	result, err := provider.Complete(context.Background(), "Hello!", nil)
+	if err != nil {
+		t.Fatalf("Complete failed after retry: %v", err)
+	}
+
+	if result != "Success after retry" {
+		t.Errorf("Expected 'Success after retry', got '%s'", result)
+	}
+
+	if callCount != 2 {
+		t.Errorf("Expected 2 calls (1 rate limited + 1 success), got %d", callCount)
+	}
+}
+
+// TestGeminiProviderServerErrorRetry tests 5xx error retry behavior
+func TestGeminiProviderServerErrorRetry(t *testing.T) {
+	callCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount++
+		if callCount == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(geminiTestResponse("Success"))
+	}))
+	defer server.Close()
+
+	provider := newTestGeminiProvider(t, server.URL)
+
+	result, err := provider.Complete(context.Background(), "Hello!", nil)
+	if err != nil {
+		t.Fatalf("Complete failed after retries: %v", err)
+	}
+
+	if result != "Success" {
+		t.Errorf("Expected 'Success', got '%s'", result)
+	}
+}
+
+// TestGeminiProviderUnrecoverableError tests client error handling
+func TestGeminiProviderUnrecoverableError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": map[string]interface{}{"code": 400, "message": "API key not valid"},
+		})
+	}))
+	defer server.Close()
+
+	provider := newTestGeminiProvider(t, server.URL)
+
+	_, err := provider.Complete(context.Background(), "Hello!", nil)
+	if err == nil {
+		t.Fatal("Expected error for invalid API key")
+	}
+
+	if !strings.Contains(err.Error(), "unrecoverable") {
+		t.Errorf("Expected unrecoverable error, got: %v", err)
+	}
+}
+
+// TestGeminiProviderContextCancellation tests context handling
+func TestGeminiProviderContextCancellation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Slow response to allow cancellation
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(geminiTestResponse("Response"))
+	}))
+	defer server.Close()
+
+	provider := newTestGeminiProvider(t, server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := provider.Complete(ctx, "Hello!", nil)
+	if err == nil {
+		t.Fatal("Expected error due to context timeout")
+	}
+
+	if ctx.Err() == nil {
+		t.Error("Expected context to be cancelled/timed out")
+	}
+}
+
+func TestGeminiProviderBackoffCancellation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Long retry-after so only cancellation can end the wait
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	provider := newTestGeminiProvider(t, server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := provider.Complete(ctx, "Hello!", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected backoff to stop on cancellation, took %v", elapsed)
+	}
+}
+
+// TestQueryAuth verifies the key is added to the query string without clobbering other parameters
+func TestQueryAuth(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "https://example.com/models/x:generateContent?alt=json", nil)
+
+	NewQueryAuth("key", "secret").ApplyAuth(req)
+
+	if req.URL.Query().Get("key") != "secret" {
+		t.Errorf("Expected key=secret, got %q", req.URL.RawQuery)
+	}
+	if req.URL.Query().Get("alt") != "json" {
+		t.Errorf("Expected existing query parameter to be preserved, got %q", req.URL.RawQuery)
+	}
+}
+
+// TestAuthTransport_QueryKeyNotLeaked verifies the transport leaves the caller's
+// request alone and keeps the key out of its errors
+func TestAuthTransport_QueryKeyNotLeaked(t *testing.T) {
+	var sent string
+	transport := &authTransport{
+		Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			sent = req.URL.RawQuery
+			return nil, &url.Error{Op: "Post", URL: req.URL.String(), Err: errors.New("connection refused")}
+		}),
+		Auth: NewQueryAuth("key", "secret"),
+	}
+	req := httptest.NewRequest(http.MethodPost, "https://example.com/models/x:generateContent?alt=json", nil)
+
+	_, err := transport.RoundTrip(req)
+
+	if !strings.Contains(sent, "key=secret") {
+		t.Errorf("Expected the key to be sent, got %q", sent)
+	}
+	if req.URL.RawQuery != "alt=json" {
+		t.Errorf("Expected the caller's request to be left unchanged, got %q", req.URL.RawQuery)
+	}
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Expected an error without the key, got %v", err)
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		t.Errorf("Expected a *url.Error, got %T", err)
+	}
+}
+
+// roundTripFunc adapts a function to http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,67 @@
+package siftrank
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// testConfig returns a quiet, reproducible config ranking with provider
+func testConfig(provider LLMProvider) *Config {
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.EnableConvergence = false
+	config.LLMProvider = provider
+	config.Seed = 5
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return config
+}
+
+// itemsInput returns n distinct lines "item 000" to "item 099", shuffled
+func itemsInput(n int) string {
+	var lines []string
+	for i := 0; i < n; i++ {
+		lines = append(lines, fmt.Sprintf("item %03d", (i*37)%100))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// promptDocPattern matches a document's ID and value rendered with promptFmt
+var promptDocPattern = regexp.MustCompile("id: `([^`]+)`\nvalue:\n```\n([^`]*)\n```")
+
+// oracleProvider ranks documents by their value, highest first, or lowest
+// first when the prompt asks for it, and counts calls
+type oracleProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *oracleProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+
+	lowestFirst := strings.Contains(prompt, "lowest first")
+	matches := promptDocPattern.FindAllStringSubmatch(prompt, -1)
+	sort.Slice(matches, func(i, j int) bool {
+		if lowestFirst {
+			return matches[i][2] < matches[j][2]
+		}
+		return matches[i][2] > matches[j][2]
+	})
+	var ids []string
+	for _, m := range matches {
+		ids = append(ids, m[1])
+	}
+	if opts != nil {
+		opts.Usage = Usage{InputTokens: len(prompt) / 4, OutputTokens: len(ids)}
+	}
+	data, err := json.Marshal(map[string][]string{"docs": ids})
+	return string(data), err
+}
@@ -0,0 +1,196 @@
+package siftrank
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DuplicatePolicy selects what happens to documents that share an ID
+type DuplicatePolicy string
+
+const (
+	// DuplicatesMerge ranks the first document once and lists the input
+	// indexes and sources of the others in its result's Duplicates
+	DuplicatesMerge DuplicatePolicy = "merge"
+	// DuplicatesKeepFirst ranks the first document and drops the others
+	DuplicatesKeepFirst DuplicatePolicy = "keep-first"
+	// DuplicatesError fails the run
+	DuplicatesError DuplicatePolicy = "error"
+)
+
+// validate reports whether the policy is one of the known policies
+func (p DuplicatePolicy) validate() error {
+	switch p {
+	case DuplicatesMerge, DuplicatesKeepFirst, DuplicatesError:
+		return nil
+	}
+	return fmt.Errorf("unknown duplicate policy %q (expected %s, %s or %s)", p, DuplicatesMerge, DuplicatesKeepFirst, DuplicatesError)
+}
+
+// Duplicate is a document merged into another with the same ID
+type Duplicate struct {
+	InputIndex int    `json:"input_index"`      // Index in the input (0-based, counted across files)
+	Source     string `json:"source,omitempty"` // File it was loaded from, relative to Config.SourceDir
+}
+
+// describeInput names a document's position for error messages
+func describeInput(doc document) string {
+	if doc.source != "" {
+		return fmt.Sprintf("%d (%s)", doc.InputIndex, doc.source)
+	}
+	return strconv.Itoa(doc.InputIndex)
+}
+
+// maxIDLen caps the length of hash IDs lengthened after a collision
+const maxIDLen = 40
+
+// prepareDocuments gives documents their final IDs, applies the duplicate
+// policy and remembers their source files. IDs come from Config.IDField or
+// Config.IDTemplate if set; hash IDs that collide for different values are
+// lengthened until they don't.
+func (r *Ranker) prepareDocuments(documents []document) ([]document, error) {
+	switch {
+	case r.cfg.IDField != "":
+		for i := range documents {
+			id, err := fieldID(documents[i].fields, r.cfg.IDField)
+			if err != nil {
+				return nil, fmt.Errorf("document %d: %w", i+1, err)
+			}
+			documents[i].ID = id
+		}
+	case r.cfg.IDTemplate != "":
+		tmpl, err := parseItemTemplate(r.cfg.IDTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID template: %w", err)
+		}
+		for i := range documents {
+			var id bytes.Buffer
+			if err := tmpl.Execute(&id, documents[i].fields); err != nil {
+				return nil, fmt.Errorf("document %d: failed to execute ID template: %w", i+1, err)
+			}
+			if strings.TrimSpace(id.String()) == "" {
+				return nil, fmt.Errorf("document %d: ID template produced an empty ID", i+1)
+			}
+			documents[i].ID = id.String()
+		}
+	default:
+		if lengthened := lengthenCollidingIDs(documents); lengthened > 0 {
+			r.cfg.Logger.Warn("Lengthened colliding document IDs", "count", lengthened)
+		}
+	}
+
+	policy := r.cfg.Duplicates
+	if policy == "" {
+		policy = DuplicatesMerge
+	}
+	kept := make([]document, 0, len(documents))
+	first := make(map[string]document, len(documents))
+	for _, doc := range documents {
+		firstDoc, seen := first[doc.ID]
+		if !seen {
+			first[doc.ID] = doc
+			kept = append(kept, doc)
+			if doc.source != "" {
+				if r.sources == nil {
+					r.sources = make(map[string]string)
+				}
+				r.sources[doc.ID] = doc.source
+			}
+			continue
+		}
+		switch policy {
+		case DuplicatesError:
+			return nil, fmt.Errorf("documents at input indexes %s and %s share the ID %q", describeInput(firstDoc), describeInput(doc), doc.ID)
+		case DuplicatesMerge:
+			if r.duplicates == nil {
+				r.duplicates = make(map[string][]Duplicate)
+			}
+			r.duplicates[doc.ID] = append(r.duplicates[doc.ID], Duplicate{InputIndex: doc.InputIndex, Source: doc.source})
+		}
+	}
+	if dropped := len(documents) - len(kept); dropped > 0 {
+		r.cfg.Logger.Warn("Found documents with duplicate IDs", "count", dropped, "policy", policy)
+	}
+	return kept, nil
+}
+
+// lengthenCollidingIDs re-hashes documents whose different values share a
+// hash ID with longer IDs, leaving every other ID as it was. It returns the
+// number of documents given longer IDs.
+func lengthenCollidingIDs(documents []document) int {
+	lengthened := make(map[int]bool)
+	for length := idLen; length < maxIDLen; {
+		values := make(map[string]string, len(documents))
+		colliding := make(map[string]bool)
+		for _, doc := range documents {
+			if value, ok := values[doc.ID]; !ok {
+				values[doc.ID] = doc.Value
+			} else if value != doc.Value {
+				colliding[doc.ID] = true
+			}
+		}
+		if len(colliding) == 0 {
+			break
+		}
+
+		length = min(length*2, maxIDLen)
+		for i := range documents {
+			if colliding[documents[i].ID] {
+				documents[i].ID = ShortDeterministicID(documents[i].Value, length)
+				lengthened[i] = true
+			}
+		}
+	}
+	return len(lengthened)
+}
+
+// fieldID reads a document ID from a dot-separated path (e.g. "meta.id") into
+// a JSON value, or a CSV/TSV column
+func fieldID(fields interface{}, path string) (string, error) {
+	value := fields
+	for rest := strings.TrimPrefix(path, "."); rest != ""; {
+		key, next, _ := strings.Cut(rest, ".")
+		switch v := value.(type) {
+		case map[string]string:
+			// Columns are flat, so the rest of the path names one (dots included)
+			field, ok := v[rest]
+			if !ok {
+				return "", fmt.Errorf("no ID field %q", path)
+			}
+			value, next = field, ""
+		case map[string]interface{}:
+			field, ok := v[key]
+			if !ok {
+				return "", fmt.Errorf("no ID field %q", path)
+			}
+			value = field
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(v) {
+				return "", fmt.Errorf("no ID field %q", path)
+			}
+			value = v[index]
+		default:
+			return "", fmt.Errorf("no ID field %q", path)
+		}
+		rest = next
+	}
+
+	var id string
+	switch v := value.(type) {
+	case string:
+		id = v
+	case float64:
+		id = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		id = strconv.FormatBool(v)
+	default:
+		return "", fmt.Errorf("ID field %q is not a string, number or boolean", path)
+	}
+	if strings.TrimSpace(id) == "" {
+		return "", fmt.Errorf("ID field %q is empty", path)
+	}
+	return id, nil
+}
@@ -0,0 +1,197 @@
+package siftrank
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func rankedKeys(result *RankResult) []string {
+	var keys []string
+	for _, doc := range result.Documents {
+		keys = append(keys, doc.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestRanker_DuplicatePolicies(t *testing.T) {
+	input := "alpha\nbeta\nalpha\ngamma\nalpha\n"
+
+	ranker := formatsTestRanker(t, "")
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(input), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+	if len(result.Documents) != 3 {
+		t.Fatalf("expected 3 documents, got %d", len(result.Documents))
+	}
+	for _, doc := range result.Documents {
+		want := []Duplicate(nil)
+		if doc.Value == "alpha" {
+			want = []Duplicate{{InputIndex: 2}, {InputIndex: 4}}
+		}
+		if !reflect.DeepEqual(doc.Duplicates, want) {
+			t.Errorf("%s: expected duplicates %v, got %v", doc.Value, want, doc.Duplicates)
+		}
+	}
+
+	ranker = formatsTestRanker(t, "")
+	ranker.cfg.Duplicates = DuplicatesKeepFirst
+	result, err = ranker.RankFromReaderResult(context.Background(), strings.NewReader(input), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+	for _, doc := range result.Documents {
+		if doc.Duplicates != nil {
+			t.Errorf("%s: expected no duplicates to be listed, got %v", doc.Value, doc.Duplicates)
+		}
+	}
+
+	ranker = formatsTestRanker(t, "")
+	ranker.cfg.Duplicates = DuplicatesError
+	_, err = ranker.RankFromReaderResult(context.Background(), strings.NewReader(input), "{{.Data}}", false)
+	if err == nil || !strings.Contains(err.Error(), "input indexes 0 and 2") {
+		t.Errorf("expected a duplicate error naming both documents, got %v", err)
+	}
+}
+
+func TestRanker_DuplicatesAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.txt")
+	second := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(first, []byte("alpha\nbeta\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if err := os.WriteFile(second, []byte("gamma\nalpha\n"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	ranker := formatsTestRanker(t, "")
+	ranker.cfg.SourceDir = dir
+	result, err := ranker.RankFromFilesResult(context.Background(), []string{first, second}, "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromFilesResult failed: %v", err)
+	}
+	for _, doc := range result.Documents {
+		if doc.Value != "alpha" {
+			continue
+		}
+		want := []Duplicate{{InputIndex: 3, Source: "b.txt"}}
+		if doc.InputIndex != 0 || doc.Source != "a.txt" || !reflect.DeepEqual(doc.Duplicates, want) {
+			t.Errorf("expected alpha from a.txt at 0 with duplicate %v, got %d %q %v", want, doc.InputIndex, doc.Source, doc.Duplicates)
+		}
+	}
+
+	ranker = formatsTestRanker(t, "")
+	ranker.cfg.SourceDir = dir
+	ranker.cfg.Duplicates = DuplicatesError
+	_, err = ranker.RankFromFilesResult(context.Background(), []string{first, second}, "{{.Data}}", false)
+	if err == nil || !strings.Contains(err.Error(), "input indexes 0 (a.txt) and 3 (b.txt)") {
+		t.Errorf("expected a duplicate error naming both files, got %v", err)
+	}
+}
+
+func TestRanker_IDField(t *testing.T) {
+	ranker := formatsTestRanker(t, FormatJSONL)
+	ranker.cfg.IDField = "meta.id"
+	input := "{\"meta\": {\"id\": 101}, \"title\": \"first\"}\n{\"meta\": {\"id\": \"b-2\"}, \"title\": \"second\"}\n"
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(input), "{{.title}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+	if keys := rankedKeys(result); !reflect.DeepEqual(keys, []string{"101", "b-2"}) {
+		t.Errorf("expected the IDs from the input, got %v", keys)
+	}
+
+	ranker = formatsTestRanker(t, FormatCSV)
+	ranker.cfg.IDField = "ticket.id"
+	result, err = ranker.RankFromReaderResult(context.Background(), strings.NewReader("ticket.id,subject\nT-1,one\nT-2,two\n"), "{{.subject}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+	if keys := rankedKeys(result); !reflect.DeepEqual(keys, []string{"T-1", "T-2"}) {
+		t.Errorf("expected the IDs from the column, got %v", keys)
+	}
+
+	ranker = formatsTestRanker(t, FormatJSONL)
+	ranker.cfg.IDField = "id"
+	_, err = ranker.RankFromReaderResult(context.Background(), strings.NewReader("{\"id\": \"a\"}\n{\"title\": \"b\"}\n"), "", false)
+	if err == nil || !strings.Contains(err.Error(), "document 2") {
+		t.Errorf("expected an error for the document without an ID, got %v", err)
+	}
+}
+
+func TestRanker_IDTemplate(t *testing.T) {
+	ranker := formatsTestRanker(t, "")
+	ranker.cfg.IDTemplate = "line-{{.Data}}"
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader("one\ntwo\n"), "Rank {{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+	if keys := rankedKeys(result); !reflect.DeepEqual(keys, []string{"line-one", "line-two"}) {
+		t.Errorf("expected templated IDs, got %v", keys)
+	}
+}
+
+func TestLengthenCollidingIDs(t *testing.T) {
+	documents := []document{
+		{ID: "same", Value: "x"},
+		{ID: "same", Value: "y"},
+		{ID: "same", Value: "x"},
+		{ID: "other", Value: "z"},
+	}
+	if lengthened := lengthenCollidingIDs(documents); lengthened != 3 {
+		t.Errorf("expected 3 documents to be given longer IDs, got %d", lengthened)
+	}
+	if documents[0].ID != ShortDeterministicID("x", idLen*2) || documents[1].ID != ShortDeterministicID("y", idLen*2) {
+		t.Errorf("expected %d character hash IDs, got %q and %q", idLen*2, documents[0].ID, documents[1].ID)
+	}
+	if documents[0].ID != documents[2].ID {
+		t.Error("expected identical values to keep sharing an ID")
+	}
+	if documents[3].ID != "other" {
+		t.Errorf("expected other IDs to be left alone, got %q", documents[3].ID)
+	}
+}
+
+func TestFieldID(t *testing.T) {
+	value := map[string]interface{}{
+		"id":    "a",
+		"tags":  []interface{}{"x", 7.0},
+		"meta":  map[string]interface{}{"ok": true},
+		"empty": "",
+	}
+	tests := map[string]string{"id": "a", ".id": "a", "tags.0": "x", "tags.1": "7", "meta.ok": "true"}
+	for path, want := range tests {
+		if got, err := fieldID(value, path); err != nil || got != want {
+			t.Errorf("%s: expected %q, got %q (%v)", path, want, got, err)
+		}
+	}
+	for _, path := range []string{"missing", "tags.2", "meta", "empty"} {
+		if _, err := fieldID(value, path); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestConfig_ValidateIDs(t *testing.T) {
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.LLMProvider = echoRankProvider{}
+	config.IDField = "id"
+	config.IDTemplate = "{{.id}}"
+	if err := config.Validate(); err == nil {
+		t.Error("expected an ID field and template together to be rejected")
+	}
+
+	config.IDTemplate = ""
+	config.Duplicates = "drop"
+	if err := config.Validate(); err == nil {
+		t.Error("expected an unknown duplicate policy to be rejected")
+	}
+}
@@ -0,0 +1,344 @@
+package siftrank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// rngDomainInsert separates insert batch composition from other random sources
+const rngDomainInsert = -5
+
+// batchComposer builds the batches of one trial of shuffleBatchRank
+type batchComposer func(trialNum int) [][]document
+
+// LoadRankedDocuments reads the ranking written by an earlier run, in either
+// output format: a JSON list of documents or a RankResult envelope
+func LoadRankedDocuments(path string) ([]*RankedDocument, error) {
+	// #nosec G304 - Caller supplies a validated path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read base ranking: %w", err)
+	}
+
+	var documents []*RankedDocument
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var result RankResult
+		if err := json.Unmarshal(trimmed, &result); err != nil {
+			return nil, fmt.Errorf("invalid base ranking: %w", err)
+		}
+		documents = result.Documents
+	} else if err := json.Unmarshal(trimmed, &documents); err != nil {
+		return nil, fmt.Errorf("invalid base ranking: %w", err)
+	}
+	if len(documents) == 0 {
+		return nil, fmt.Errorf("base ranking has no documents")
+	}
+
+	// Rankings are written best first; Rank restores that order if reshuffled
+	sort.SliceStable(documents, func(i, j int) bool {
+		return documents[i].Rank < documents[j].Rank
+	})
+	return documents, nil
+}
+
+// InsertFromFilesResult ranks the documents loaded from filePaths into base,
+// an existing ranking (see LoadRankedDocuments), without re-ranking base.
+// Trials batch only the new documents, each batch filled with reference
+// documents drawn across base's score range, and the new documents' scores
+// are mapped onto base's scale through the references. The result holds base
+// and the new documents; documents base already holds are skipped.
+func (r *Ranker) InsertFromFilesResult(ctx context.Context, base []*RankedDocument, filePaths []string, templateData string, forceJSON bool) (*RankResult, error) {
+	documents, err := r.loadDocumentsFromFiles(filePaths, templateData, forceJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	run := r.newRun()
+	return r.withTrace(run, func() (*RankResult, error) {
+		return run.insertDocuments(ctx, base, documents)
+	})
+}
+
+// InsertFromReaderResult is like InsertFromFilesResult but reads the new
+// documents from reader (see RankFromReader)
+func (r *Ranker) InsertFromReaderResult(ctx context.Context, base []*RankedDocument, reader io.Reader, templateData string, isJSON bool) (*RankResult, error) {
+	documents, err := r.loadDocumentsFromReader(reader, templateData, r.inputFormat(isJSON, FormatText))
+	if err != nil {
+		return nil, err
+	}
+
+	run := r.newRun()
+	return r.withTrace(run, func() (*RankResult, error) {
+		return run.insertDocuments(ctx, base, documents)
+	})
+}
+
+// insertDocuments ranks documents into base in a single round of constrained
+// trials. If ctx ends early, base is returned with the documents placed so far
+// and a *CanceledError.
+func (r *Ranker) insertDocuments(ctx context.Context, base []*RankedDocument, documents []document) (*RankResult, error) {
+	startTime := time.Now()
+
+	if r.cfg.Mode == ModePairwise || r.cfg.Mode == ModePointwise || len(r.cfg.Criteria) > 0 || r.cfg.Relevance {
+		return nil, fmt.Errorf("insert only supports batch mode without criteria or relevance")
+	}
+	if r.checkpointDir != "" {
+		return nil, fmt.Errorf("insert does not support checkpoints")
+	}
+	if len(base) == 0 {
+		return nil, fmt.Errorf("base ranking has no documents")
+	}
+	documents, err := r.prepareDocuments(documents)
+	if err != nil {
+		return nil, err
+	}
+
+	// References keep base's order; new documents follow base in input order
+	known := make(map[string]bool, len(base))
+	nextIndex := 0
+	references := make([]document, len(base))
+	for i, doc := range base {
+		known[doc.Key] = true
+		nextIndex = max(nextIndex, doc.InputIndex+1)
+		references[i] = document{ID: doc.Key, Value: doc.Value, Document: doc.Document, InputIndex: doc.InputIndex}
+	}
+	var inserted []document
+	for _, doc := range documents {
+		if known[doc.ID] {
+			continue
+		}
+		known[doc.ID] = true
+		doc.InputIndex = nextIndex + len(inserted)
+		inserted = append(inserted, doc)
+	}
+	if skipped := len(documents) - len(inserted); skipped > 0 {
+		r.cfg.Logger.Info("Skipped documents already ranked", "count", skipped)
+	}
+	if len(base)+len(inserted) > MaxDocuments {
+		return nil, fmt.Errorf("too many documents to rank (max %d)", MaxDocuments)
+	}
+
+	pool := append(append([]document(nil), inserted...), references...)
+	if err := r.checkDocumentSizes(inserted); err != nil {
+		return nil, err
+	}
+	if err := r.adjustBatchSize(pool); err != nil {
+		return nil, err
+	}
+
+	r.comparedAgainst = make(map[string]map[string]bool)
+	r.orderings = nil
+	r.callMode = ModeBatch
+	r.round = 1
+	r.originalDocCount = len(pool)
+
+	var results []*RankedDocument
+	if len(inserted) > 0 {
+		r.cfg.BatchSize = min(r.cfg.BatchSize, len(pool))
+		r.numBatches = insertBatchCount(len(inserted), r.cfg.BatchSize)
+		r.composeTrial = func(trialNum int) [][]document {
+			return r.insertBatches(inserted, references, trialNum)
+		}
+		defer func() { r.composeTrial = nil }()
+
+		r.cfg.Logger.Info("Inserting documents",
+			"count", len(inserted),
+			"base", len(base),
+			"batches_per_trial", r.numBatches)
+		r.emit(Event{Type: EventRoundStarted, Documents: len(pool)})
+
+		results, err = r.shuffleBatchRank(ctx, pool)
+		var canceledErr *CanceledError
+		if err != nil && !errors.As(err, &canceledErr) {
+			return nil, err
+		}
+	}
+
+	merged := mergeInserted(base, results, r.comparedAgainst)
+	r.cfg.Logger.Info("Insert completed",
+		"inserted", len(merged)-len(base),
+		"total", len(merged),
+		"num_calls", r.totalCalls,
+		"input_tokens", r.totalUsage.InputTokens,
+		"output_tokens", r.totalUsage.OutputTokens)
+	return r.buildResult(merged, startTime), err
+}
+
+// insertBatchCount is the number of batches per insert trial: new documents
+// take up to half of each batch, references the rest
+func insertBatchCount(numInserted, batchSize int) int {
+	perBatch := max(batchSize/2, 1)
+	return (numInserted + perBatch - 1) / perBatch
+}
+
+// insertBatches composes one insert trial. The new documents are shuffled and
+// spread evenly over the batches, and each batch is filled with references
+// drawn one from each equal slice of the base ranking, so that every batch
+// spans base's score range.
+func (r *Ranker) insertBatches(inserted, references []document, trialNum int) [][]document {
+	rng := r.derivedRNG(rngDomainInsert, int64(trialNum))
+
+	shuffled := append([]document(nil), inserted...)
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	batches := make([][]document, insertBatchCount(len(inserted), r.cfg.BatchSize))
+	for i, doc := range shuffled {
+		batches[i%len(batches)] = append(batches[i%len(batches)], doc)
+	}
+	for i, batch := range batches {
+		slots := min(r.cfg.BatchSize-len(batch), len(references))
+		for s := 0; s < slots; s++ {
+			start, end := s*len(references)/slots, (s+1)*len(references)/slots
+			batch = append(batch, references[start+rng.Intn(end-start)])
+		}
+		// Mix the references in so neither kind holds the top positions
+		rng.Shuffle(len(batch), func(i, j int) {
+			batch[i], batch[j] = batch[j], batch[i]
+		})
+		batches[i] = batch
+	}
+	return batches
+}
+
+// mergeInserted places the new documents among results into base. Their
+// scores are calibrated onto base's scale (see calibrateInserted) and their
+// rank intervals and exposure computed over the merged ranking. Base
+// documents keep their scores; their rank intervals shift with the merged
+// ranks and their exposure counts the new documents they were compared with.
+func mergeInserted(base, results []*RankedDocument, comparedAgainst map[string]map[string]bool) []*RankedDocument {
+	calibrated := calibrateInserted(base, results)
+
+	merged := make([]*RankedDocument, 0, len(base)+len(calibrated))
+	for _, doc := range base {
+		copied := *doc
+		merged = append(merged, &copied)
+	}
+	var insertOrder []string
+	for _, doc := range results {
+		insertOrder = append(insertOrder, doc.Key)
+		if score, ok := calibrated[doc.Key]; ok {
+			// Strengths of the insert run are not on base's scale
+			doc.Score, doc.Strength, doc.StdErr = score, 0, 0
+			merged = append(merged, doc)
+		}
+	}
+
+	// Base documents win ties, as they hold their place on more evidence
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score < merged[j].Score
+	})
+
+	mergedRank := make(map[string]int, len(merged))
+	for i, doc := range merged {
+		mergedRank[doc.Key] = i + 1
+	}
+	baseOrder := make([]string, len(base))
+	for i, doc := range base {
+		baseOrder[i] = doc.Key
+	}
+
+	others := float64(len(merged) - 1)
+	for i, doc := range merged {
+		doc.Rank = i + 1
+		if _, isNew := calibrated[doc.Key]; isNew {
+			doc.RankCILow, doc.RankCIHigh = spanRanks(insertOrder, doc.RankCILow, doc.RankCIHigh, doc.Rank, mergedRank)
+			doc.Exposure = 1.0
+			if others > 0 {
+				doc.Exposure = float64(len(comparedAgainst[doc.Key])) / others
+			}
+			continue
+		}
+
+		doc.RankCILow, doc.RankCIHigh = spanRanks(baseOrder, doc.RankCILow, doc.RankCIHigh, doc.Rank, mergedRank)
+		var comparedNew int
+		for id := range comparedAgainst[doc.Key] {
+			if _, isNew := calibrated[id]; isNew {
+				comparedNew++
+			}
+		}
+		if others > 0 {
+			doc.Exposure = min((doc.Exposure*float64(len(base)-1)+float64(comparedNew))/others, 1.0)
+		}
+	}
+
+	markTies(merged)
+	return merged
+}
+
+// calibrateInserted maps the insert run's scores of the new documents onto
+// base's scale. The references are matched by quantile (the k-th best
+// reference of the insert run takes the k-th best base score among them) and
+// each new document is interpolated between its neighbouring references,
+// extrapolating past the ends within base's score range. New documents are
+// left out if no reference was scored.
+func calibrateInserted(base, results []*RankedDocument) map[string]float64 {
+	baseScores := make(map[string]float64, len(base))
+	lowest, highest := base[0].Score, base[0].Score
+	for _, doc := range base {
+		baseScores[doc.Key] = doc.Score
+		lowest, highest = min(lowest, doc.Score), max(highest, doc.Score)
+	}
+
+	// results are sorted by score, so fitted is ascending
+	var fitted, anchored []float64
+	for _, doc := range results {
+		if score, ok := baseScores[doc.Key]; ok {
+			fitted = append(fitted, doc.Score)
+			anchored = append(anchored, score)
+		}
+	}
+	if len(fitted) == 0 {
+		return nil
+	}
+	sort.Float64s(anchored)
+
+	calibrated := make(map[string]float64)
+	for _, doc := range results {
+		if _, ok := baseScores[doc.Key]; ok {
+			continue
+		}
+		score := interpolate(fitted, anchored, doc.Score)
+		calibrated[doc.Key] = min(max(score, lowest), highest)
+	}
+	return calibrated
+}
+
+// interpolate evaluates the piecewise linear function through (xs[i], ys[i])
+// at x, extending the end segments past the ends. xs must be ascending.
+func interpolate(xs, ys []float64, x float64) float64 {
+	if len(xs) == 1 {
+		return ys[0]
+	}
+	lo := min(max(sort.SearchFloat64s(xs, x)-1, 0), len(xs)-2)
+	hi := lo + 1
+	if xs[hi] == xs[lo] {
+		return (ys[lo] + ys[hi]) / 2
+	}
+	return ys[lo] + (x-xs[lo])*(ys[hi]-ys[lo])/(xs[hi]-xs[lo])
+}
+
+// spanRanks maps a rank interval over order onto the merged ranking: the best
+// and worst merged rank of the documents order ranks within it. A missing
+// interval maps to rank itself.
+func spanRanks(order []string, low, high, rank int, mergedRank map[string]int) (int, int) {
+	low, high = max(low, 1), min(high, len(order))
+	if low > high {
+		return rank, rank
+	}
+	spanLow, spanHigh := rank, rank
+	for _, key := range order[low-1 : high] {
+		if r, ok := mergedRank[key]; ok {
+			spanLow, spanHigh = min(spanLow, r), max(spanHigh, r)
+		}
+	}
+	return spanLow, spanHigh
+}
@@ -0,0 +1,197 @@
+package siftrank
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func insertTestConfig(provider LLMProvider) *Config {
+	config := testConfig(provider)
+	config.BatchSize = 10
+	config.NumTrials = 10
+	return config
+}
+
+func TestInsertBatches(t *testing.T) {
+	var inserted, references []document
+	for i := 0; i < 7; i++ {
+		inserted = append(inserted, document{ID: fmt.Sprintf("new%d", i)})
+	}
+	for i := 0; i < 20; i++ {
+		references = append(references, document{ID: fmt.Sprintf("ref%02d", i)})
+	}
+
+	config := insertTestConfig(echoRankProvider{})
+	config.BatchSize = 6
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	batches := ranker.insertBatches(inserted, references, 1)
+	if len(batches) != 3 {
+		t.Fatalf("expected 3 batches, got %d", len(batches))
+	}
+
+	placed := make(map[string]bool)
+	for i, batch := range batches {
+		if len(batch) != 6 {
+			t.Errorf("batch %d: expected 6 documents, got %d", i, len(batch))
+		}
+		var numNew int
+		var refs []string
+		for _, doc := range batch {
+			if strings.HasPrefix(doc.ID, "new") {
+				numNew++
+				placed[doc.ID] = true
+			} else {
+				refs = append(refs, doc.ID)
+			}
+		}
+		if numNew > 3 {
+			t.Errorf("batch %d: expected at most 3 new documents, got %d", i, numNew)
+		}
+
+		// One reference from each slice of the base ranking
+		slices := make(map[int]bool)
+		for _, id := range refs {
+			var index int
+			fmt.Sscanf(id, "ref%d", &index)
+			for s := len(refs) - 1; s >= 0; s-- {
+				if index >= s*len(references)/len(refs) {
+					slices[s] = true
+					break
+				}
+			}
+		}
+		if len(slices) != len(refs) {
+			t.Errorf("batch %d: expected references from distinct slices, got %v", i, refs)
+		}
+	}
+	if len(placed) != len(inserted) {
+		t.Errorf("expected every new document batched once per trial, got %d", len(placed))
+	}
+}
+
+func TestRanker_Insert(t *testing.T) {
+	var lines []string
+	for i := 0; i < 100; i += 2 {
+		lines = append(lines, fmt.Sprintf("item %03d", (i*37)%100))
+	}
+	baseRanker, err := NewRanker(insertTestConfig(&oracleProvider{}))
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	base, err := baseRanker.RankFromReader(strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReader failed: %v", err)
+	}
+
+	provider := &oracleProvider{}
+	ranker, err := NewRanker(insertTestConfig(provider))
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	newItems := "item 097\nitem 051\nitem 010\nitem 005"
+	result, err := ranker.InsertFromReaderResult(context.Background(), base, strings.NewReader(newItems), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("InsertFromReaderResult failed: %v", err)
+	}
+
+	// item 010 is already ranked; the other three fit in one batch per trial
+	if len(result.Documents) != 53 {
+		t.Fatalf("expected 53 documents, got %d", len(result.Documents))
+	}
+	if provider.calls != 10 {
+		t.Errorf("expected 10 calls (one batch per trial), got %d", provider.calls)
+	}
+
+	// Ranks by value, give or take the base ranking's own noise
+	want := map[string]int{"item 097": 2, "item 051": 25, "item 005": 48}
+	for i, doc := range result.Documents {
+		if doc.Rank != i+1 {
+			t.Errorf("expected rank %d, got %d", i+1, doc.Rank)
+		}
+		if doc.RankCILow > doc.Rank || doc.RankCIHigh < doc.Rank {
+			t.Errorf("%s: rank %d outside its interval [%d, %d]", doc.Value, doc.Rank, doc.RankCILow, doc.RankCIHigh)
+		}
+		if rank, ok := want[doc.Value]; ok {
+			if doc.Rank < rank-3 || doc.Rank > rank+3 {
+				t.Errorf("%s: expected rank near %d, got %d", doc.Value, rank, doc.Rank)
+			}
+			if doc.InputIndex < len(base) {
+				t.Errorf("%s: expected input index after the base documents, got %d", doc.Value, doc.InputIndex)
+			}
+			if doc.Exposure <= 0 {
+				t.Errorf("%s: expected positive exposure", doc.Value)
+			}
+			delete(want, doc.Value)
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("expected inserted documents %v in the result", want)
+	}
+
+	// Base documents keep their scores
+	for _, doc := range base {
+		for _, merged := range result.Documents {
+			if merged.Key == doc.Key && merged.Score != doc.Score {
+				t.Errorf("%s: expected base score %v, got %v", doc.Value, doc.Score, merged.Score)
+			}
+		}
+	}
+}
+
+func TestRanker_InsertRejectsOtherModes(t *testing.T) {
+	config := pointwiseTestConfig(&gradeOracleProvider{})
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	base := []*RankedDocument{{Key: "a", Value: "item 001"}}
+	if _, err := ranker.InsertFromReaderResult(context.Background(), base, strings.NewReader("item 002"), "{{.Data}}", false); err == nil {
+		t.Error("expected insert to reject pointwise mode")
+	}
+}
+
+func TestLoadRankedDocuments(t *testing.T) {
+	dir := t.TempDir()
+	documents := []*RankedDocument{
+		{Key: "b", Value: "second", Rank: 2},
+		{Key: "a", Value: "first", Rank: 1},
+	}
+
+	write := func(name string, v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		return path
+	}
+
+	for _, path := range []string{
+		write("documents.json", documents),
+		write("envelope.json", RankResult{Documents: documents}),
+	} {
+		loaded, err := LoadRankedDocuments(path)
+		if err != nil {
+			t.Fatalf("%s: LoadRankedDocuments failed: %v", path, err)
+		}
+		if len(loaded) != 2 || loaded[0].Key != "a" || loaded[1].Key != "b" {
+			t.Errorf("%s: expected documents in rank order, got %+v", path, loaded)
+		}
+	}
+
+	if _, err := LoadRankedDocuments(write("empty.json", []*RankedDocument{})); err == nil {
+		t.Error("expected an error for an empty ranking")
+	}
+}
@@ -74,13 +74,18 @@ type CompletionOptions struct {
 	// Optional; may be empty if provider doesn't report it.
 	// Useful for debugging or support requests with the provider.
 	RequestID string
+
+	// Cached is true when the response was served from a response cache
+	// (see CachingProvider). Usage then reflects the original call, not
+	// tokens spent on this one.
+	Cached bool
 }
 
 // Usage tracks token consumption for LLM calls
 type Usage struct {
-	InputTokens     int // Prompt tokens
-	OutputTokens    int // Completion tokens
-	ReasoningTokens int // Reasoning tokens (o1/o3 models)
+	InputTokens     int `json:"input_tokens"`     // Prompt tokens
+	OutputTokens    int `json:"output_tokens"`    // Completion tokens
+	ReasoningTokens int `json:"reasoning_tokens"` // Reasoning tokens (o1/o3 models)
 }
 
 // TotalTokens returns the sum of all token counts
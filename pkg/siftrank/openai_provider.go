@@ -51,9 +51,8 @@ type authTransport struct {
 }
 
 func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	// Apply authentication before forwarding to next transport
-	t.Auth.ApplyAuth(req)
-	return t.Transport.RoundTrip(req)
+	// Apply authentication to a copy before forwarding to next transport
+	return roundTripAuthenticated(t.Transport, t.Auth, req)
 }
 
 // OpenAIProvider implements LLMProvider using OpenAI API
@@ -224,14 +223,18 @@ func (p *OpenAIProvider) Complete(ctx context.Context, prompt string, opts *Comp
 		// Handle timeout
 		if err == context.DeadlineExceeded {
 			p.logger.Debug("Request timeout, retrying", "backoff", backoff)
-			time.Sleep(backoff)
+			if err := sleepContext(ctx, backoff); err != nil {
+				return "", err
+			}
 			backoff = minDuration(backoff*2, maxBackoff)
 			continue
 		}
 
 		// Handle rate limits (429)
 		if p.transport.StatusCode == http.StatusTooManyRequests {
-			p.handleRateLimit(&backoff, maxBackoff)
+			if err := p.handleRateLimit(ctx, &backoff, maxBackoff); err != nil {
+				return "", err
+			}
 			continue
 		}
 
@@ -240,7 +243,9 @@ func (p *OpenAIProvider) Complete(ctx context.Context, prompt string, opts *Comp
 			p.logger.Debug("Server error, retrying",
 				"status", p.transport.StatusCode,
 				"backoff", backoff)
-			time.Sleep(backoff)
+			if err := sleepContext(ctx, backoff); err != nil {
+				return "", err
+			}
 			backoff = minDuration(backoff*2, maxBackoff)
 			continue
 		}
@@ -256,13 +261,15 @@ func (p *OpenAIProvider) Complete(ctx context.Context, prompt string, opts *Comp
 
 		// Other errors - retry with backoff
 		p.logger.Debug("Request failed, retrying", "error", err, "backoff", backoff)
-		time.Sleep(backoff)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return "", err
+		}
 		backoff = minDuration(backoff*2, maxBackoff)
 	}
 }
 
 // handleRateLimit handles rate limit errors with intelligent backoff
-func (p *OpenAIProvider) handleRateLimit(backoff *time.Duration, maxBackoff time.Duration) {
+func (p *OpenAIProvider) handleRateLimit(ctx context.Context, backoff *time.Duration, maxBackoff time.Duration) error {
 	// Log rate limit headers
 	for key, values := range p.transport.Headers {
 		if strings.HasPrefix(key, "X-Ratelimit") || strings.HasPrefix(key, "X-RateLimit") {
@@ -297,12 +304,17 @@ func (p *OpenAIProvider) handleRateLimit(backoff *time.Duration, maxBackoff time
 	// Use suggested wait time if available, otherwise exponential backoff
 	if resetDuration > 0 {
 		p.logger.Debug("Waiting for rate limit reset", "duration", resetDuration)
-		time.Sleep(resetDuration)
+		if err := sleepContext(ctx, resetDuration); err != nil {
+			return err
+		}
 	} else {
 		p.logger.Debug("Waiting with exponential backoff", "duration", *backoff)
-		time.Sleep(*backoff)
+		if err := sleepContext(ctx, *backoff); err != nil {
+			return err
+		}
 		*backoff = minDuration(*backoff*2, maxBackoff)
 	}
+	return nil
 }
 
 // EstimateTokens implements LLMProvider.EstimateTokens
@@ -317,3 +329,16 @@ func minDuration(a, b time.Duration) time.Duration {
 	}
 	return b
 }
+
+// sleepContext waits for d, returning early with ctx.Err() if ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
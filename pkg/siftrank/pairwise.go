@@ -0,0 +1,344 @@
+package siftrank
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// rngDomainPairwise separates Swiss pairing random sources from others
+const rngDomainPairwise = -3
+
+var pairwisePromptDisclaimer = "\n\nREMEMBER to:\n" +
+	"- Compare the TWO documents below and pick the one that is MORE RELEVANT\n" +
+	"- ALWAYS respond with the short 6-8 character ID of the document you pick, found above its value " +
+	"(i.e., I'll provide you with `id: <ID>` above the value, and you should respond with that same ID in your response)\n" +
+	"— NEVER respond with the actual value!\n" +
+	"— NEVER include backticks around the ID in your response!\n" +
+	"— NEVER include scores or a written reason/justification in your response!\n" +
+	"- Respond in JSON format, with the following schema:\n  {\"winner\": \"<ID>\"}\n\n" +
+	"Here are the two documents to compare:\n\n"
+
+// Used for parsing and schema generation in pairwise mode
+type pairwiseResponse struct {
+	Winner string `json:"winner" jsonschema_description:"ID of the more relevant document"`
+}
+
+// parsePairwiseResponse turns a pairwise answer into a two-document ranking.
+// shownIDs are the IDs in the prompt; a non-empty problem explains why the
+// answer is unusable.
+func parsePairwiseResponse(jsonResponse string, shownIDs []string) (rankedDocumentResponse, string) {
+	var answer pairwiseResponse
+	if err := json.Unmarshal([]byte(jsonResponse), &answer); err != nil {
+		return rankedDocumentResponse{}, fmt.Sprintf("Your JSON had a syntax error: %v", err)
+	}
+
+	winner := strings.TrimSpace(strings.ReplaceAll(answer.Winner, "`", ""))
+	for i, id := range shownIDs {
+		if strings.EqualFold(id, winner) {
+			return rankedDocumentResponse{Documents: []string{id, shownIDs[1-i]}}, ""
+		}
+	}
+	return rankedDocumentResponse{}, fmt.Sprintf("%q is not one of the IDs [%s]. Answer with the ID of the more relevant document.",
+		answer.Winner, strings.Join(shownIDs, ", "))
+}
+
+// pairwiseRounds is the number of Swiss rounds for n documents: enough for a
+// single winner to emerge from pairwise games, plus one, but no more than a
+// round robin needs
+func pairwiseRounds(n int) int {
+	return min(bits.Len(uint(n-1))+1, n-1+n%2) // #nosec G115 - n is a document count
+}
+
+// pairKey identifies an unordered pair of documents
+func pairKey(a, b string) [2]string {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]string{a, b}
+}
+
+// swissSearchLimit bounds the pairings swissPairs tries before settling for
+// a greedy pairing that may leave more than one document out
+const swissSearchLimit = 10000
+
+// swissPairs pairs documents ordered by standing, best first. Each document
+// meets the nearest document below it that it has not met yet, backtracking
+// so that at most one document (for an odd count) sits the round out.
+func swissPairs(standings []document, played map[[2]string]bool) [][2]document {
+	paired := make([]bool, len(standings))
+	var pairs [][2]document
+	byes := len(standings) % 2
+	steps := 0
+
+	var solve func(greedy bool) bool
+	solve = func(greedy bool) bool {
+		i := 0
+		for i < len(standings) && paired[i] {
+			i++
+		}
+		if i == len(standings) {
+			return true
+		}
+		for j := i + 1; j < len(standings); j++ {
+			if paired[j] || played[pairKey(standings[i].ID, standings[j].ID)] {
+				continue
+			}
+			if steps++; !greedy && steps > swissSearchLimit {
+				return false
+			}
+			paired[i], paired[j] = true, true
+			pairs = append(pairs, [2]document{standings[i], standings[j]})
+			if solve(greedy) || greedy {
+				return true
+			}
+			paired[i], paired[j] = false, false
+			pairs = pairs[:len(pairs)-1]
+		}
+		// Sit this document out
+		if byes > 0 || greedy {
+			byes--
+			paired[i] = true
+			if solve(greedy) {
+				return true
+			}
+			paired[i] = false
+			byes++
+		}
+		return false
+	}
+
+	if !solve(false) {
+		clear(paired)
+		pairs = pairs[:0]
+		solve(true)
+	}
+	return pairs
+}
+
+// pairwiseStandings orders documents for a Swiss round: shuffled for the
+// first round, then by the strengths fitted so far, unscored documents last
+func (r *Ranker) pairwiseStandings(documents []document, swissRound int) []document {
+	standings := append([]document(nil), documents...)
+	if swissRound == 1 {
+		rng := r.derivedRNG(rngDomainPairwise, int64(swissRound))
+		rng.Shuffle(len(standings), func(i, j int) {
+			standings[i], standings[j] = standings[j], standings[i]
+		})
+		return standings
+	}
+
+	fitted := r.scorer.Score(r.orderings, r.round)
+	sort.SliceStable(standings, func(i, j int) bool {
+		si, oki := fitted[standings[i].ID]
+		sj, okj := fitted[standings[j].ID]
+		if oki != okj {
+			return oki
+		}
+		if si.Score != sj.Score {
+			return si.Score < sj.Score
+		}
+		return standings[i].InputIndex < standings[j].InputIndex
+	})
+	return standings
+}
+
+// rankPairwise ranks documents by pairwise comparisons. Each Swiss round
+// pairs documents of similar standing that have not met, and asks about every
+// pair in both orders so that a preference for the first (or second) document
+// cancels out. The scorer (Bradley-Terry through Plackett-Luce by default)
+// fits strengths to every answer.
+func (r *Ranker) rankPairwise(ctx context.Context, documents []document) ([]*RankedDocument, error) {
+	if len(documents) < 2 {
+		return r.rank(ctx, documents, 1)
+	}
+
+	r.round = 1
+	r.callMode = ModePairwise
+	r.originalDocCount = len(documents)
+	r.mu.Lock()
+	r.convergenceReason = ""
+	r.mu.Unlock()
+
+	numRounds := pairwiseRounds(len(documents))
+	r.cfg.Logger.Info("Ranking documents pairwise",
+		"count", len(documents),
+		"swiss_rounds", numRounds)
+	r.emit(Event{Type: EventRoundStarted, Documents: len(documents)})
+
+	// Winner positions (1 = won, 2 = lost) for variance and the trace
+	scores := make(map[string][]float64)
+	played := make(map[[2]string]bool)
+
+	var roundUsage Usage
+	var roundCalls, roundComparisons, completedRounds int
+	var fatalErr error
+
+	for swissRound := 1; swissRound <= numRounds; swissRound++ {
+		if ctx.Err() != nil || r.isBudgetExceeded() {
+			break
+		}
+
+		pairs := swissPairs(r.pairwiseStandings(documents, swissRound), played)
+		if len(pairs) == 0 {
+			r.mu.Lock()
+			r.convergenceReason = ConvergenceSettled
+			r.mu.Unlock()
+			r.cfg.Logger.Info("Pairwise ranking: every pair has been compared",
+				"swiss_rounds", completedRounds)
+			r.emit(Event{Type: EventConverged, Trial: completedRounds, ConvergenceReason: ConvergenceSettled})
+			break
+		}
+
+		// Both orders of every pair
+		var comparisons [][]document
+		for _, pair := range pairs {
+			played[pairKey(pair[0].ID, pair[1].ID)] = true
+			comparisons = append(comparisons,
+				[]document{pair[0], pair[1]},
+				[]document{pair[1], pair[0]})
+		}
+
+		var usage Usage
+		var numCalls, numComparisons int
+		for _, result := range r.rankBatches(ctx, comparisons, swissRound) {
+			usage.Add(result.usage)
+			numCalls += result.numCalls
+			if result.err != nil {
+				if !errors.Is(result.err, errBudgetExceeded) && ctx.Err() == nil && fatalErr == nil {
+					fatalErr = result.err
+				}
+				continue
+			}
+			numComparisons++
+
+			ordering := BatchOrdering{Round: r.round, Trial: swissRound}
+			for _, rankedDoc := range result.rankedDocs {
+				ordering.IDs = append(ordering.IDs, rankedDoc.Document.ID)
+				scores[rankedDoc.Document.ID] = append(scores[rankedDoc.Document.ID], rankedDoc.Score)
+			}
+			winner, loser := ordering.IDs[0], ordering.IDs[1]
+			r.mu.Lock()
+			r.orderings = append(r.orderings, ordering)
+			for _, ids := range [][2]string{{winner, loser}, {loser, winner}} {
+				if r.comparedAgainst[ids[0]] == nil {
+					r.comparedAgainst[ids[0]] = make(map[string]bool)
+				}
+				r.comparedAgainst[ids[0]][ids[1]] = true
+			}
+			r.mu.Unlock()
+		}
+
+		roundUsage.Add(usage)
+		roundCalls += numCalls
+		roundComparisons += numComparisons
+
+		r.mu.Lock()
+		r.totalUsage.Add(usage)
+		r.totalCalls += numCalls
+		r.totalBatches += numComparisons
+		r.mu.Unlock()
+
+		if fatalErr != nil {
+			break
+		}
+		if numComparisons < len(comparisons) {
+			// Canceled or out of budget mid-round
+			continue
+		}
+		completedRounds++
+
+		r.cfg.Logger.Info("Swiss round completed",
+			"swiss_round", swissRound,
+			"num_pairs", len(pairs),
+			"num_calls", numCalls,
+			"input_tokens", usage.InputTokens,
+			"output_tokens", usage.OutputTokens)
+
+		r.recordTrialState(swissRound, swissRound, scores, documents, swissRound == numRounds)
+		if err := r.recordModelPerformance(r.round, swissRound); err != nil {
+			r.cfg.Logger.Error("Failed to record model performance", "error", err)
+		}
+	}
+
+	// Fit strengths to every answer
+	fitted := r.scorer.Score(r.orderings, r.round)
+	intervals := strengthIntervals(fitted)
+
+	var results []*RankedDocument
+	for _, doc := range documents {
+		score, ok := fitted[doc.ID]
+		if !ok {
+			continue
+		}
+		results = append(results, &RankedDocument{
+			Key:        doc.ID,
+			Value:      doc.Value,
+			Document:   doc.Document,
+			Score:      score.Score,
+			Strength:   score.Strength,
+			StdErr:     score.StdErr,
+			Rounds:     r.round,
+			InputIndex: doc.InputIndex,
+
+			ScoreVariance: sampleVariance(scores[doc.ID]),
+			Observations:  len(scores[doc.ID]),
+			RankCILow:     intervals[doc.ID].rankLow,
+			RankCIHigh:    intervals[doc.ID].rankHigh,
+		})
+	}
+
+	// Break ties by input order so seeded runs are reproducible
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score < results[j].Score
+		}
+		return results[i].InputIndex < results[j].InputIndex
+	})
+
+	r.mu.Lock()
+	r.totalTrials += completedRounds
+	r.totalRounds++
+	reason := r.convergenceReason
+	if reason == "" {
+		switch {
+		case ctx.Err() != nil:
+			reason = ConvergenceCanceled
+		case r.budgetExceeded:
+			reason = ConvergenceBudget
+		default:
+			reason = ConvergenceMaxTrials
+		}
+	}
+	r.roundStats = append(r.roundStats, RoundStats{
+		Round:             r.round,
+		Documents:         len(documents),
+		Trials:            completedRounds,
+		Batches:           roundComparisons,
+		Calls:             roundCalls,
+		Usage:             roundUsage,
+		ElbowCutoff:       -1,
+		ConvergenceReason: reason,
+	})
+	r.mu.Unlock()
+
+	r.cfg.Logger.Info("Round completed",
+		"round", r.round,
+		"num_trials", completedRounds,
+		"num_batches", roundComparisons,
+		"num_calls", roundCalls,
+		"input_tokens", roundUsage.InputTokens,
+		"output_tokens", roundUsage.OutputTokens)
+
+	if fatalErr != nil {
+		return nil, fatalErr
+	}
+	if ctx.Err() != nil {
+		return results, &CanceledError{Round: r.round, Trials: completedRounds, Err: ctx.Err()}
+	}
+	return results, nil
+}
@@ -0,0 +1,178 @@
+package siftrank
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// pairOracleProvider answers pairwise prompts with the higher value, or with
+// the first document shown when preferFirst is set, and counts calls
+type pairOracleProvider struct {
+	preferFirst bool
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *pairOracleProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+
+	matches := promptDocPattern.FindAllStringSubmatch(prompt, -1)
+	if len(matches) != 2 {
+		return "", fmt.Errorf("expected 2 documents, got %d", len(matches))
+	}
+	winner := matches[0]
+	if !p.preferFirst && matches[1][2] > matches[0][2] {
+		winner = matches[1]
+	}
+	if opts != nil {
+		opts.Usage = Usage{InputTokens: len(prompt) / 4, OutputTokens: 1}
+	}
+	data, err := json.Marshal(pairwiseResponse{Winner: winner[1]})
+	return string(data), err
+}
+
+func pairwiseTestRanker(t *testing.T, provider LLMProvider) *Ranker {
+	t.Helper()
+
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.Mode = ModePairwise
+	config.LLMProvider = provider
+	config.Seed = 3
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	return ranker
+}
+
+func TestRanker_Pairwise(t *testing.T) {
+	var lines []string
+	for i := 0; i < 12; i++ {
+		lines = append(lines, fmt.Sprintf("item %02d", (i*5)%12))
+	}
+
+	provider := &pairOracleProvider{}
+	result, err := pairwiseTestRanker(t, provider).RankFromReaderResult(context.Background(), strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+
+	// 5 Swiss rounds of 6 pairs, each asked in both orders
+	if provider.calls != 60 || result.NumCalls != 60 {
+		t.Errorf("expected 60 calls, got %d (reported %d)", provider.calls, result.NumCalls)
+	}
+	if len(result.Documents) != len(lines) {
+		t.Fatalf("expected %d results, got %d", len(lines), len(result.Documents))
+	}
+	for i, want := range []string{"item 11", "item 10", "item 09"} {
+		if got := result.Documents[i].Value; got != want {
+			t.Errorf("rank %d: expected %q, got %q", i+1, want, got)
+		}
+	}
+	for _, doc := range result.Documents {
+		if doc.Strength <= 0 || doc.StdErr <= 0 {
+			t.Errorf("expected strength and std err for %s, got %v and %v", doc.Key, doc.Strength, doc.StdErr)
+		}
+		if doc.Observations != 10 {
+			t.Errorf("expected 10 comparisons for %s, got %d", doc.Key, doc.Observations)
+		}
+	}
+	if len(result.Rounds) != 1 || result.Rounds[0].Trials != 5 {
+		t.Errorf("expected one round of 5 Swiss rounds, got %+v", result.Rounds)
+	}
+}
+
+func TestRanker_PairwiseCancelsPositionBias(t *testing.T) {
+	input := "alpha\nbravo\ncharlie\ndelta\necho\nfoxtrot"
+
+	results, err := pairwiseTestRanker(t, &pairOracleProvider{preferFirst: true}).RankFromReader(strings.NewReader(input), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReader failed: %v", err)
+	}
+
+	// Every pair splits its two verdicts, so no document stands out
+	for _, doc := range results {
+		if math.Abs(doc.Score) > 1e-6 {
+			t.Errorf("expected equal strengths, got score %v for %s", doc.Score, doc.Value)
+		}
+	}
+}
+
+func TestSwissPairs(t *testing.T) {
+	standings := []document{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}, {ID: "e"}}
+	played := map[[2]string]bool{pairKey("b", "a"): true}
+
+	if got, want := formatPairs(swissPairs(standings, played)), "ac,bd"; got != want {
+		t.Errorf("expected pairs %s, got %s", want, got)
+	}
+
+	// Pairing a with b would leave c and d, who have met, without opponents
+	played = map[[2]string]bool{pairKey("c", "d"): true}
+	if got, want := formatPairs(swissPairs(standings[:4], played)), "ac,bd"; got != want {
+		t.Errorf("expected pairs %s, got %s", want, got)
+	}
+}
+
+func formatPairs(pairs [][2]document) string {
+	var ids []string
+	for _, pair := range pairs {
+		ids = append(ids, pair[0].ID+pair[1].ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestPairwiseRounds(t *testing.T) {
+	for n, want := range map[int]int{2: 1, 3: 3, 4: 3, 12: 5, 40: 7} {
+		if got := pairwiseRounds(n); got != want {
+			t.Errorf("pairwiseRounds(%d): expected %d, got %d", n, want, got)
+		}
+	}
+}
+
+func TestParsePairwiseResponse(t *testing.T) {
+	shown := []string{"BlueFox", "RedOwl"}
+
+	response, problem := parsePairwiseResponse(`{"winner": "`+"`redowl`"+`"}`, shown)
+	if problem != "" {
+		t.Fatalf("unexpected problem: %s", problem)
+	}
+	if strings.Join(response.Documents, ",") != "RedOwl,BlueFox" {
+		t.Errorf("expected RedOwl ahead of BlueFox, got %v", response.Documents)
+	}
+
+	if _, problem := parsePairwiseResponse(`{"winner": "GreenCat"}`, shown); !strings.Contains(problem, "GreenCat") {
+		t.Errorf("expected problem naming the unknown ID, got %q", problem)
+	}
+	if _, problem := parsePairwiseResponse(`{"winner": 3}`, shown); problem == "" {
+		t.Error("expected problem for malformed answer")
+	}
+}
+
+func TestConfigValidate_Pairwise(t *testing.T) {
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.LLMProvider = echoRankProvider{}
+	config.Mode = "tournament"
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to reject unknown mode")
+	}
+
+	config.Mode = ModePairwise
+	config.Relevance = true
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to reject relevance in pairwise mode")
+	}
+}
@@ -0,0 +1,299 @@
+package siftrank
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Range of the absolute scores asked for in pointwise mode
+const (
+	minAbsoluteScore = 1
+	maxAbsoluteScore = 10
+)
+
+// rngDomainPointwise separates pointwise batch shuffles from other random sources
+const rngDomainPointwise = -4
+
+var pointwisePromptDisclaimer = "\n\nREMEMBER to:\n" +
+	"- Score EACH document below on its own against the rubric, from 1 (worst) to 10 (best)\n" +
+	"- ALWAYS identify each document by the short 6-8 character ID found above its value " +
+	"(i.e., I'll provide you with `id: <ID>` above the value, and you should respond with that same ID in your response)\n" +
+	"— NEVER respond with the actual value!\n" +
+	"— NEVER include backticks around IDs in your response!\n" +
+	"— NEVER include a written reason/justification in your response!\n" +
+	"- Respond in JSON format, with the following schema:\n  {\"scores\": [{\"id\": \"<ID1>\", \"score\": <1-10>}, ...]}\n\n" +
+	"Here are the documents to score:\n\n"
+
+type documentGrade struct {
+	ID    string  `json:"id" jsonschema_description:"Document ID"`
+	Score float64 `json:"score" jsonschema:"minimum=1,maximum=10" jsonschema_description:"Score from 1 (worst) to 10 (best) against the rubric"`
+}
+
+// Used for parsing and schema generation in pointwise mode
+type pointwiseResponse struct {
+	Scores []documentGrade `json:"scores" jsonschema_description:"Score for each document"`
+}
+
+// parsePointwiseResponse splits a pointwise answer into the scored IDs and
+// their scores; a non-empty problem explains why the answer is unusable
+func parsePointwiseResponse(jsonResponse string) (rankedDocumentResponse, []float64, string) {
+	var answer pointwiseResponse
+	if err := json.Unmarshal([]byte(jsonResponse), &answer); err != nil {
+		return rankedDocumentResponse{}, nil, fmt.Sprintf("Your JSON had a syntax error: %v", err)
+	}
+
+	var response rankedDocumentResponse
+	var grades []float64
+	for _, grade := range answer.Scores {
+		if grade.Score < minAbsoluteScore || grade.Score > maxAbsoluteScore {
+			return rankedDocumentResponse{}, nil, fmt.Sprintf("The score %v for %s is outside %d-%d.",
+				grade.Score, grade.ID, minAbsoluteScore, maxAbsoluteScore)
+		}
+		response.Documents = append(response.Documents, grade.ID)
+		grades = append(grades, grade.Score)
+	}
+	return response, grades, ""
+}
+
+// rankPointwise scores every document against the rubric PointwiseSamples
+// times, in shuffled batches of ScoreBatchSize, and orders documents by their
+// mean score. With a BlendWeight the listwise ranking runs first and the two
+// orders are blended.
+func (r *Ranker) rankPointwise(ctx context.Context, documents []document) ([]*RankedDocument, error) {
+	var listwise []*RankedDocument
+	if r.cfg.BlendWeight > 0 {
+		r.callMode = ModeBatch
+		var err error
+		listwise, err = r.rank(ctx, documents, 1)
+		if err != nil || r.isBudgetExceeded() {
+			return listwise, err
+		}
+	}
+
+	// Scoring is a round of its own, after any listwise rounds
+	r.round = r.totalRounds + 1
+	r.callMode = ModePointwise
+	if r.round == 1 {
+		r.originalDocCount = len(documents)
+	}
+	r.mu.Lock()
+	r.convergenceReason = ""
+	r.mu.Unlock()
+
+	r.cfg.Logger.Info("Scoring documents against the rubric",
+		"round", r.round,
+		"count", len(documents),
+		"samples", r.cfg.PointwiseSamples)
+	r.emit(Event{Type: EventRoundStarted, Documents: len(documents)})
+
+	// Scores per document (absolute) and as "lower is better" for the trace
+	grades := make(map[string][]float64)
+	scores := make(map[string][]float64)
+
+	var roundUsage Usage
+	var roundCalls, roundBatches, completedSamples int
+	var fatalErr error
+
+	for sample := 1; sample <= r.cfg.PointwiseSamples; sample++ {
+		if ctx.Err() != nil || r.isBudgetExceeded() {
+			break
+		}
+
+		shuffled := append([]document(nil), documents...)
+		rng := r.derivedRNG(rngDomainPointwise, int64(r.round), int64(sample))
+		rng.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		var batches [][]document
+		for start := 0; start < len(shuffled); start += r.cfg.ScoreBatchSize {
+			batches = append(batches, shuffled[start:min(start+r.cfg.ScoreBatchSize, len(shuffled))])
+		}
+
+		var usage Usage
+		var numCalls, numBatches int
+		for _, outcome := range r.rankBatches(ctx, batches, sample) {
+			usage.Add(outcome.usage)
+			numCalls += outcome.numCalls
+			if outcome.err != nil {
+				if !errors.Is(outcome.err, errBudgetExceeded) && ctx.Err() == nil && fatalErr == nil {
+					fatalErr = outcome.err
+				}
+				continue
+			}
+			numBatches++
+
+			r.mu.Lock()
+			for _, scored := range outcome.rankedDocs {
+				id := scored.Document.ID
+				grades[id] = append(grades[id], scored.Score)
+				scores[id] = append(scores[id], maxAbsoluteScore-scored.Score)
+
+				// Documents scored in one call have seen each other
+				for _, other := range outcome.rankedDocs {
+					if other.Document.ID == id {
+						continue
+					}
+					if r.comparedAgainst[id] == nil {
+						r.comparedAgainst[id] = make(map[string]bool)
+					}
+					r.comparedAgainst[id][other.Document.ID] = true
+				}
+			}
+			r.mu.Unlock()
+		}
+
+		roundUsage.Add(usage)
+		roundCalls += numCalls
+		roundBatches += numBatches
+
+		r.mu.Lock()
+		r.totalUsage.Add(usage)
+		r.totalCalls += numCalls
+		r.totalBatches += numBatches
+		r.mu.Unlock()
+
+		if fatalErr != nil {
+			break
+		}
+		if numBatches < len(batches) {
+			// Canceled or out of budget mid-sample
+			continue
+		}
+		completedSamples++
+
+		r.cfg.Logger.Info("Sample completed",
+			"round", r.round,
+			"sample", sample,
+			"num_batches", numBatches,
+			"num_calls", numCalls,
+			"input_tokens", usage.InputTokens,
+			"output_tokens", usage.OutputTokens)
+
+		r.recordTrialState(sample, sample, scores, documents, sample == r.cfg.PointwiseSamples)
+		if err := r.recordModelPerformance(r.round, sample); err != nil {
+			r.cfg.Logger.Error("Failed to record model performance", "error", err)
+		}
+	}
+
+	uncertainty := scoreUncertainty(scores, r.bootstrapRNG(completedSamples))
+
+	var results []*RankedDocument
+	for _, doc := range documents {
+		list := grades[doc.ID]
+		if len(list) == 0 {
+			continue
+		}
+		var sum float64
+		for _, grade := range list {
+			sum += grade
+		}
+		mean := sum / float64(len(list))
+
+		results = append(results, &RankedDocument{
+			Key:           doc.ID,
+			Value:         doc.Value,
+			Document:      doc.Document,
+			Score:         maxAbsoluteScore - mean,
+			AbsoluteScore: mean,
+			Rounds:        r.round,
+			InputIndex:    doc.InputIndex,
+
+			ScoreVariance: uncertainty[doc.ID].variance,
+			Observations:  uncertainty[doc.ID].observations,
+			RankCILow:     uncertainty[doc.ID].rankLow,
+			RankCIHigh:    uncertainty[doc.ID].rankHigh,
+		})
+	}
+
+	// Break ties by input order so seeded runs are reproducible
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score < results[j].Score
+		}
+		return results[i].InputIndex < results[j].InputIndex
+	})
+
+	r.mu.Lock()
+	r.totalTrials += completedSamples
+	r.totalRounds++
+	reason := r.convergenceReason
+	if reason == "" {
+		switch {
+		case ctx.Err() != nil:
+			reason = ConvergenceCanceled
+		case r.budgetExceeded:
+			reason = ConvergenceBudget
+		default:
+			reason = ConvergenceMaxTrials
+		}
+	}
+	r.roundStats = append(r.roundStats, RoundStats{
+		Round:             r.round,
+		Documents:         len(documents),
+		Trials:            completedSamples,
+		Batches:           roundBatches,
+		Calls:             roundCalls,
+		Usage:             roundUsage,
+		ElbowCutoff:       -1,
+		ConvergenceReason: reason,
+	})
+	r.mu.Unlock()
+
+	r.cfg.Logger.Info("Round completed",
+		"round", r.round,
+		"num_trials", completedSamples,
+		"num_batches", roundBatches,
+		"num_calls", roundCalls,
+		"input_tokens", roundUsage.InputTokens,
+		"output_tokens", roundUsage.OutputTokens)
+
+	if fatalErr != nil {
+		return nil, fatalErr
+	}
+
+	// A blend needs every document scored; otherwise the listwise order stands
+	if listwise != nil {
+		if len(results) < len(listwise) {
+			results = listwise
+		} else {
+			results = blendRankings(listwise, results, r.cfg.BlendWeight)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return results, &CanceledError{Round: r.round, Trials: completedSamples, Err: ctx.Err()}
+	}
+	return results, nil
+}
+
+// blendRankings orders the listwise results by a weighted mix of their
+// listwise position and their absolute score, both scaled to 0 (best) to 1.
+// The blend becomes Score; the uncertainty fields stay those of the listwise
+// ranking.
+func blendRankings(listwise, pointwise []*RankedDocument, weight float64) []*RankedDocument {
+	absolute := make(map[string]float64, len(pointwise))
+	for _, doc := range pointwise {
+		absolute[doc.Key] = doc.AbsoluteScore
+	}
+
+	blended := make([]*RankedDocument, len(listwise))
+	for i, doc := range listwise {
+		var position float64
+		if len(listwise) > 1 {
+			position = float64(i) / float64(len(listwise)-1)
+		}
+		grade := (maxAbsoluteScore - absolute[doc.Key]) / (maxAbsoluteScore - minAbsoluteScore)
+
+		blended[i] = doc
+		doc.AbsoluteScore = absolute[doc.Key]
+		doc.Score = weight*position + (1-weight)*grade
+	}
+
+	sort.SliceStable(blended, func(i, j int) bool {
+		return blended[i].Score < blended[j].Score
+	})
+	return blended
+}
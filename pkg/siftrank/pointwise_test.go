@@ -0,0 +1,229 @@
+package siftrank
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// gradeOracleProvider scores each document by the number ending its value,
+// plus one, and counts calls
+type gradeOracleProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *gradeOracleProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+
+	var answer pointwiseResponse
+	for _, m := range promptDocPattern.FindAllStringSubmatch(prompt, -1) {
+		fields := strings.Fields(m[2])
+		n, err := strconv.Atoi(fields[len(fields)-1])
+		if err != nil {
+			return "", err
+		}
+		answer.Scores = append(answer.Scores, documentGrade{ID: m[1], Score: float64(n + 1)})
+	}
+	if opts != nil {
+		opts.Usage = Usage{InputTokens: len(prompt) / 4, OutputTokens: len(answer.Scores)}
+	}
+	data, err := json.Marshal(answer)
+	return string(data), err
+}
+
+// blendOracleProvider sends scoring prompts to grader and listwise prompts
+// to ranker
+type blendOracleProvider struct {
+	ranker *oracleProvider
+	grader *gradeOracleProvider
+}
+
+func (p *blendOracleProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	if strings.Contains(prompt, "RUBRIC:") {
+		return p.grader.Complete(ctx, prompt, opts)
+	}
+	return p.ranker.Complete(ctx, prompt, opts)
+}
+
+func pointwiseTestConfig(provider LLMProvider) *Config {
+	config := testConfig(provider)
+	config.InitialPrompt = "grade"
+	config.Mode = ModePointwise
+	config.Rubric = "10 for high numbers, 1 for low ones"
+	return config
+}
+
+func pointwiseTestInput() string {
+	var lines []string
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", (i*3)%10))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestRanker_Pointwise(t *testing.T) {
+	provider := &gradeOracleProvider{}
+	config := pointwiseTestConfig(provider)
+	config.ScoreBatchSize = 4
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(pointwiseTestInput()), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+
+	// 3 samples of batches of 4, 4 and 2 documents
+	if provider.calls != 9 || result.NumCalls != 9 {
+		t.Errorf("expected 9 calls, got %d (reported %d)", provider.calls, result.NumCalls)
+	}
+	if len(result.Documents) != 10 {
+		t.Fatalf("expected 10 results, got %d", len(result.Documents))
+	}
+	for i, doc := range result.Documents {
+		if want := fmt.Sprintf("item %d", 9-i); doc.Value != want {
+			t.Errorf("rank %d: expected %q, got %q", i+1, want, doc.Value)
+		}
+		if want := float64(10 - i); doc.AbsoluteScore != want {
+			t.Errorf("expected absolute score %v for %s, got %v", want, doc.Value, doc.AbsoluteScore)
+		}
+		if doc.Observations != 3 {
+			t.Errorf("expected 3 observations for %s, got %d", doc.Value, doc.Observations)
+		}
+	}
+	if len(result.Rounds) != 1 || result.Rounds[0].Trials != 3 {
+		t.Errorf("expected one round of 3 samples, got %+v", result.Rounds)
+	}
+}
+
+func TestRanker_PointwiseMinScore(t *testing.T) {
+	config := pointwiseTestConfig(&gradeOracleProvider{})
+	config.MinScore = 7
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	results, err := ranker.RankFromReader(strings.NewReader(pointwiseTestInput()), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReader failed: %v", err)
+	}
+
+	// Scores 7 to 10 belong to items 6 to 9
+	if len(results) != 4 {
+		t.Fatalf("expected 4 documents at or above 7, got %d", len(results))
+	}
+	for _, doc := range results {
+		if doc.AbsoluteScore < 7 {
+			t.Errorf("expected %s to be filtered out, score %v", doc.Value, doc.AbsoluteScore)
+		}
+	}
+}
+
+func TestRanker_PointwiseBlend(t *testing.T) {
+	config := pointwiseTestConfig(nil)
+	config.BlendWeight = 0.5
+	config.BatchSize = 5
+	config.NumTrials = 2
+	config.RefinementRatio = 0
+
+	grader := &gradeOracleProvider{}
+	config.LLMProvider = &blendOracleProvider{ranker: &oracleProvider{}, grader: grader}
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(pointwiseTestInput()), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+
+	if grader.calls != 30 {
+		t.Errorf("expected 30 scoring calls, got %d", grader.calls)
+	}
+	if len(result.Rounds) != 2 {
+		t.Errorf("expected a listwise round and a scoring round, got %d", len(result.Rounds))
+	}
+	if len(result.Documents) != 10 || result.Documents[0].Value != "item 9" {
+		t.Fatalf("expected item 9 first of 10, got %+v", result.Documents)
+	}
+	for i, doc := range result.Documents {
+		if want := float64(doc.Value[len(doc.Value)-1]-'0') + 1; doc.AbsoluteScore != want {
+			t.Errorf("expected absolute score %v for %s, got %v", want, doc.Value, doc.AbsoluteScore)
+		}
+		if i > 0 && doc.Score < result.Documents[i-1].Score {
+			t.Errorf("expected blended scores in order, got %v after %v", doc.Score, result.Documents[i-1].Score)
+		}
+	}
+}
+
+func TestBlendRankings(t *testing.T) {
+	listwise := []*RankedDocument{{Key: "a"}, {Key: "b"}, {Key: "c"}}
+	pointwise := []*RankedDocument{{Key: "a", AbsoluteScore: 2}, {Key: "b", AbsoluteScore: 9}, {Key: "c", AbsoluteScore: 5}}
+
+	blended := blendRankings(listwise, pointwise, 0.25)
+	var order []string
+	for _, doc := range blended {
+		order = append(order, doc.Key)
+	}
+	if got := strings.Join(order, ""); got != "bac" {
+		t.Errorf("expected order bac, got %s", got)
+	}
+	if blended[0].AbsoluteScore != 9 {
+		t.Errorf("expected b to keep its absolute score, got %v", blended[0].AbsoluteScore)
+	}
+}
+
+func TestParsePointwiseResponse(t *testing.T) {
+	response, grades, problem := parsePointwiseResponse(`{"scores": [{"id": "BlueFox", "score": 7}, {"id": "RedOwl", "score": 2.5}]}`)
+	if problem != "" {
+		t.Fatalf("unexpected problem: %s", problem)
+	}
+	if strings.Join(response.Documents, ",") != "BlueFox,RedOwl" || grades[0] != 7 || grades[1] != 2.5 {
+		t.Errorf("unexpected parse: %v %v", response.Documents, grades)
+	}
+
+	if _, _, problem := parsePointwiseResponse(`{"scores": [{"id": "BlueFox", "score": 11}]}`); !strings.Contains(problem, "BlueFox") {
+		t.Errorf("expected problem naming the out-of-range score, got %q", problem)
+	}
+	if _, _, problem := parsePointwiseResponse(`{"scores": "none"}`); problem == "" {
+		t.Error("expected problem for malformed answer")
+	}
+}
+
+func TestConfigValidate_Pointwise(t *testing.T) {
+	config := pointwiseTestConfig(echoRankProvider{})
+	config.Rubric = ""
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to require a rubric")
+	}
+
+	config.Rubric = "rubric"
+	config.BlendWeight = 1.5
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to reject blend weight above 1")
+	}
+
+	config.BlendWeight = 0
+	config.MinScore = 11
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to reject min score above 10")
+	}
+
+	config.MinScore = 0
+	config.Mode = ModeBatch
+	config.BlendWeight = 0.5
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to reject blend weight outside pointwise mode")
+	}
+}
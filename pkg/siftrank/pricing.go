@@ -0,0 +1,108 @@
+package siftrank
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Pricing is a model's token price in USD per million tokens
+type Pricing struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"` // Also applied to reasoning tokens
+}
+
+// Cost returns the USD cost of the given usage
+func (p Pricing) Cost(u Usage) float64 {
+	return (float64(u.InputTokens)*p.InputPerMillion +
+		float64(u.OutputTokens+u.ReasoningTokens)*p.OutputPerMillion) / 1_000_000
+}
+
+// PricingTable maps model names to their pricing
+type PricingTable map[string]Pricing
+
+// DefaultPricing holds list prices for common models at the time of writing.
+// Prices change; override them with LoadPricingFile or Config.PricingTable.
+var DefaultPricing = PricingTable{
+	// OpenAI
+	"gpt-4o-mini":  {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+	"gpt-4o":       {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+	"gpt-4.1":      {InputPerMillion: 2.00, OutputPerMillion: 8.00},
+	"gpt-4.1-mini": {InputPerMillion: 0.40, OutputPerMillion: 1.60},
+	"gpt-4.1-nano": {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	"gpt-5":        {InputPerMillion: 1.25, OutputPerMillion: 10.00},
+	"gpt-5-mini":   {InputPerMillion: 0.25, OutputPerMillion: 2.00},
+	"gpt-5-nano":   {InputPerMillion: 0.05, OutputPerMillion: 0.40},
+	"o3-mini":      {InputPerMillion: 1.10, OutputPerMillion: 4.40},
+	"o4-mini":      {InputPerMillion: 1.10, OutputPerMillion: 4.40},
+
+	// Anthropic
+	"claude-3-haiku":    {InputPerMillion: 0.25, OutputPerMillion: 1.25},
+	"claude-3-5-haiku":  {InputPerMillion: 0.80, OutputPerMillion: 4.00},
+	"claude-haiku-4-5":  {InputPerMillion: 1.00, OutputPerMillion: 5.00},
+	"claude-3-5-sonnet": {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+	"claude-sonnet-4":   {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+	"claude-sonnet-4-5": {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+	"claude-opus-4":     {InputPerMillion: 15.00, OutputPerMillion: 75.00},
+
+	// Google
+	"gemini-2.0-flash":      {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	"gemini-2.5-flash":      {InputPerMillion: 0.30, OutputPerMillion: 2.50},
+	"gemini-2.5-flash-lite": {InputPerMillion: 0.10, OutputPerMillion: 0.40},
+	"gemini-2.5-pro":        {InputPerMillion: 1.25, OutputPerMillion: 10.00},
+}
+
+// Lookup finds the pricing for a model. Provider prefixes such as
+// "openai/" (OpenRouter) are ignored, and dated or suffixed variants
+// (e.g. "gpt-4o-mini-2024-07-18") match the longest known prefix.
+func (t PricingTable) Lookup(model string) (Pricing, bool) {
+	if pricing, ok := t[model]; ok {
+		return pricing, true
+	}
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+		if pricing, ok := t[model]; ok {
+			return pricing, true
+		}
+	}
+
+	var best string
+	for name := range t {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Pricing{}, false
+	}
+	return t[best], true
+}
+
+// LoadPricingFile reads a JSON pricing table and merges it over DefaultPricing.
+// The file maps model names to prices, e.g.
+// {"gpt-4o-mini": {"input_per_million": 0.15, "output_per_million": 0.6}}.
+func LoadPricingFile(path string) (PricingTable, error) {
+	// #nosec G304 - Caller supplies a validated path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing file: %w", err)
+	}
+
+	var overrides PricingTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid pricing file: %w", err)
+	}
+
+	table := make(PricingTable, len(DefaultPricing)+len(overrides))
+	for name, pricing := range DefaultPricing {
+		table[name] = pricing
+	}
+	for name, pricing := range overrides {
+		if pricing.InputPerMillion < 0 || pricing.OutputPerMillion < 0 {
+			return nil, fmt.Errorf("invalid pricing for %s: prices must be >= 0", name)
+		}
+		table[name] = pricing
+	}
+	return table, nil
+}
@@ -0,0 +1,80 @@
+package siftrank
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPricingCost(t *testing.T) {
+	pricing := Pricing{InputPerMillion: 0.15, OutputPerMillion: 0.60}
+	usage := Usage{InputTokens: 50_000, OutputTokens: 8_000, ReasoningTokens: 2_000}
+
+	// Reasoning tokens are billed at the output rate
+	want := 50_000*0.15/1_000_000 + 10_000*0.60/1_000_000
+	if got := pricing.Cost(usage); math.Abs(got-want) > 1e-12 {
+		t.Errorf("expected cost %v, got %v", want, got)
+	}
+}
+
+func TestPricingTableLookup(t *testing.T) {
+	table := PricingTable{
+		"gpt-4o":      {InputPerMillion: 2.5, OutputPerMillion: 10},
+		"gpt-4o-mini": {InputPerMillion: 0.15, OutputPerMillion: 0.6},
+	}
+
+	tests := []struct {
+		model string
+		want  float64 // InputPerMillion, 0 if not found
+	}{
+		{"gpt-4o", 2.5},
+		{"gpt-4o-mini", 0.15},
+		{"gpt-4o-mini-2024-07-18", 0.15}, // Longest prefix wins
+		{"gpt-4o-2024-08-06", 2.5},
+		{"openai/gpt-4o-mini", 0.15}, // OpenRouter provider prefix
+		{"llama3", 0},
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		pricing, ok := table.Lookup(tt.model)
+		if ok != (tt.want != 0) || pricing.InputPerMillion != tt.want {
+			t.Errorf("Lookup(%q) = %+v, %v; want input price %v", tt.model, pricing, ok, tt.want)
+		}
+	}
+}
+
+func TestLoadPricingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pricing.json")
+	content := `{"gpt-4o-mini": {"input_per_million": 1, "output_per_million": 2}, "llama3": {"input_per_million": 0, "output_per_million": 0}}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	table, err := LoadPricingFile(path)
+	if err != nil {
+		t.Fatalf("LoadPricingFile failed: %v", err)
+	}
+
+	if pricing, _ := table.Lookup("gpt-4o-mini"); pricing.InputPerMillion != 1 || pricing.OutputPerMillion != 2 {
+		t.Errorf("expected override for gpt-4o-mini, got %+v", pricing)
+	}
+	if _, ok := table.Lookup("llama3"); !ok {
+		t.Error("expected new model from file")
+	}
+	if _, ok := table.Lookup("gpt-4o"); !ok {
+		t.Error("expected built-in prices to be kept")
+	}
+	if DefaultPricing["gpt-4o-mini"].InputPerMillion == 1 {
+		t.Error("expected DefaultPricing to be left unchanged")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"bad": {"input_per_million": -1}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPricingFile(path); err == nil {
+		t.Error("expected error for negative price")
+	}
+}
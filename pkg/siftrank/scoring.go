@@ -0,0 +1,231 @@
+package siftrank
+
+import (
+	"fmt"
+	"math"
+)
+
+// ScoringModel selects how batch orderings are turned into document scores
+type ScoringModel string
+
+const (
+	// ScoringMean averages each document's position across its batches (default)
+	ScoringMean ScoringModel = "mean"
+	// ScoringPlackettLuce fits latent document strengths to every batch
+	// ordering with the Plackett-Luce (listwise Bradley-Terry) model
+	ScoringPlackettLuce ScoringModel = "plackett-luce"
+)
+
+// validate reports whether the model is one of the known scoring models
+func (m ScoringModel) validate() error {
+	switch m {
+	case ScoringMean, ScoringPlackettLuce:
+		return nil
+	}
+	return fmt.Errorf("unknown scoring model %q (expected %s or %s)", m, ScoringMean, ScoringPlackettLuce)
+}
+
+// BatchOrdering is one batch as ranked by the LLM, best document first
+type BatchOrdering struct {
+	Round  int
+	Trial  int
+	IDs    []string
+	Weight float64 // Evidence weight in PlackettLuceScorer's fit (0 counts as 1)
+}
+
+// weight returns the ordering's evidence weight
+func (o BatchOrdering) weight() float64 {
+	if o.Weight == 0 {
+		return 1
+	}
+	return o.Weight
+}
+
+// DocumentScore is a scorer's verdict on one document
+type DocumentScore struct {
+	Score    float64 // Lower is better; must be >= 0
+	Strength float64 // Latent strength (0 if the scorer has none)
+	StdErr   float64 // Standard error of log(Strength) (0 if the scorer has none)
+}
+
+// Scorer turns batch orderings into document scores. Score receives every
+// ordering collected so far in the run, earlier rounds included, and scores
+// the documents that appear in the given round's orderings.
+type Scorer interface {
+	Score(orderings []BatchOrdering, round int) map[string]DocumentScore
+}
+
+// NewScorer returns the built-in scorer for a scoring model
+func NewScorer(model ScoringModel) (Scorer, error) {
+	switch model {
+	case "", ScoringMean:
+		return MeanPositionScorer{}, nil
+	case ScoringPlackettLuce:
+		return PlackettLuceScorer{}, nil
+	}
+	return nil, model.validate()
+}
+
+// MeanPositionScorer scores each document by its mean 1-based position in
+// the round's batches
+type MeanPositionScorer struct{}
+
+// Score implements Scorer.Score
+func (MeanPositionScorer) Score(orderings []BatchOrdering, round int) map[string]DocumentScore {
+	sums := make(map[string]float64)
+	counts := make(map[string]int)
+	for _, o := range orderings {
+		if o.Round != round {
+			continue
+		}
+		for i, id := range o.IDs {
+			sums[id] += float64(i + 1)
+			counts[id]++
+		}
+	}
+
+	scores := make(map[string]DocumentScore, len(sums))
+	for id, sum := range sums {
+		scores[id] = DocumentScore{Score: sum / float64(counts[id])}
+	}
+	return scores
+}
+
+const (
+	plMaxIterations = 1000
+	plTolerance     = 1e-6
+)
+
+// PlackettLuceScorer fits a strength γ to every document so that the
+// probability of a batch ordering is the product, over its positions, of the
+// chosen document's strength over the strengths still remaining. Orderings
+// from all rounds contribute, so a document's score no longer depends on
+// which batches it happened to land in.
+//
+// The fit uses Hunter's MM algorithm. Each document also plays one win and
+// one loss against a virtual reference of strength 1, which keeps documents
+// that always came first or last finite and anchors the scale. Score is
+// log(γ_max) - log(γ), and StdErr comes from the diagonal of the Fisher
+// information of log(γ). An ordering with a Weight counts as that many
+// observations of it.
+type PlackettLuceScorer struct{}
+
+// Score implements Scorer.Score
+func (PlackettLuceScorer) Score(orderings []BatchOrdering, round int) map[string]DocumentScore {
+	// Index documents and translate orderings
+	index := make(map[string]int)
+	var ids []string
+	inRound := make(map[int]bool)
+	lists := make([][]int, 0, len(orderings))
+	weights := make([]float64, 0, len(orderings))
+	for _, o := range orderings {
+		if len(o.IDs) < 2 {
+			continue
+		}
+		list := make([]int, len(o.IDs))
+		for i, id := range o.IDs {
+			idx, ok := index[id]
+			if !ok {
+				idx = len(ids)
+				index[id] = idx
+				ids = append(ids, id)
+			}
+			list[i] = idx
+			if o.Round == round {
+				inRound[idx] = true
+			}
+		}
+		lists = append(lists, list)
+		weights = append(weights, o.weight())
+	}
+	if len(ids) == 0 {
+		return map[string]DocumentScore{}
+	}
+
+	// Wins: times chosen ahead of the rest, plus the one against the reference
+	wins := make([]float64, len(ids))
+	for i := range wins {
+		wins[i] = 1
+	}
+	for l, list := range lists {
+		for _, idx := range list[:len(list)-1] {
+			wins[idx] += weights[l]
+		}
+	}
+
+	gamma := make([]float64, len(ids))
+	for i := range gamma {
+		gamma[i] = 1
+	}
+	denom := make([]float64, len(ids))
+
+	for iter := 0; iter < plMaxIterations; iter++ {
+		// Reference games: 1/(γ_i+1) for the win and for the loss
+		for i := range denom {
+			denom[i] = 2 / (gamma[i] + 1)
+		}
+		for l, list := range lists {
+			// Each stage s picks list[s] from list[s:]; every document still
+			// in the running gets 1/Σγ of that stage
+			var tail float64
+			for _, idx := range list {
+				tail += gamma[idx]
+			}
+			var cum float64
+			for s, idx := range list[:len(list)-1] {
+				cum += weights[l] / tail
+				denom[idx] += cum
+				tail -= gamma[idx]
+				if s == len(list)-2 {
+					// The last document is present in every stage
+					denom[list[s+1]] += cum
+				}
+			}
+		}
+
+		var maxDelta float64
+		for i := range gamma {
+			updated := wins[i] / denom[i]
+			maxDelta = math.Max(maxDelta, math.Abs(math.Log(updated)-math.Log(gamma[i])))
+			gamma[i] = updated
+		}
+		if maxDelta < plTolerance {
+			break
+		}
+	}
+
+	// Fisher information of log(γ_i): Σ over stages of p(1-p)
+	info := make([]float64, len(ids))
+	for i := range info {
+		p := gamma[i] / (gamma[i] + 1)
+		info[i] = 2 * p * (1 - p)
+	}
+	for l, list := range lists {
+		var tail float64
+		for _, idx := range list {
+			tail += gamma[idx]
+		}
+		for s := 0; s < len(list)-1; s++ {
+			for _, idx := range list[s:] {
+				p := gamma[idx] / tail
+				info[idx] += weights[l] * p * (1 - p)
+			}
+			tail -= gamma[list[s]]
+		}
+	}
+
+	maxLog := math.Inf(-1)
+	for idx := range inRound {
+		maxLog = math.Max(maxLog, math.Log(gamma[idx]))
+	}
+
+	scores := make(map[string]DocumentScore, len(inRound))
+	for idx := range inRound {
+		scores[ids[idx]] = DocumentScore{
+			Score:    maxLog - math.Log(gamma[idx]),
+			Strength: gamma[idx],
+			StdErr:   1 / math.Sqrt(info[idx]),
+		}
+	}
+	return scores
+}
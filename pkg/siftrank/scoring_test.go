@@ -0,0 +1,182 @@
+package siftrank
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMeanPositionScorer(t *testing.T) {
+	orderings := []BatchOrdering{
+		{Round: 1, Trial: 1, IDs: []string{"a", "b", "c"}},
+		{Round: 1, Trial: 2, IDs: []string{"b", "a", "c"}},
+		{Round: 2, Trial: 1, IDs: []string{"c", "a"}},
+	}
+
+	scores := MeanPositionScorer{}.Score(orderings, 1)
+	want := map[string]float64{"a": 1.5, "b": 1.5, "c": 3}
+	if len(scores) != len(want) {
+		t.Fatalf("expected %d scores, got %v", len(want), scores)
+	}
+	for id, score := range want {
+		if scores[id].Score != score {
+			t.Errorf("expected %s to score %v, got %v", id, score, scores[id].Score)
+		}
+	}
+
+	// Only the requested round counts
+	scores = MeanPositionScorer{}.Score(orderings, 2)
+	if len(scores) != 2 || scores["c"].Score != 1 || scores["a"].Score != 2 {
+		t.Errorf("unexpected round 2 scores: %v", scores)
+	}
+}
+
+func TestPlackettLuceScorer_Chain(t *testing.T) {
+	// a > b, b > c, c > d: by mean position b and c tie with a and d,
+	// but their strengths follow the chain
+	var orderings []BatchOrdering
+	for trial := 1; trial <= 5; trial++ {
+		orderings = append(orderings,
+			BatchOrdering{Round: 1, Trial: trial, IDs: []string{"a", "b"}},
+			BatchOrdering{Round: 1, Trial: trial, IDs: []string{"b", "c"}},
+			BatchOrdering{Round: 1, Trial: trial, IDs: []string{"c", "d"}},
+		)
+	}
+
+	scores := PlackettLuceScorer{}.Score(orderings, 1)
+	chain := []string{"a", "b", "c", "d"}
+	for i, id := range chain {
+		s := scores[id]
+		if s.Strength <= 0 || s.StdErr <= 0 {
+			t.Errorf("expected positive strength and std err for %s, got %+v", id, s)
+		}
+		if i > 0 && s.Strength >= scores[chain[i-1]].Strength {
+			t.Errorf("expected %s weaker than %s, got %+v vs %+v", id, chain[i-1], s, scores[chain[i-1]])
+		}
+		if i > 0 && s.Score <= scores[chain[i-1]].Score {
+			t.Errorf("expected %s to score worse than %s", id, chain[i-1])
+		}
+	}
+	if scores["a"].Score != 0 {
+		t.Errorf("expected the strongest document to score 0, got %v", scores["a"].Score)
+	}
+}
+
+func TestPlackettLuceScorer_UsesEarlierRounds(t *testing.T) {
+	orderings := []BatchOrdering{
+		{Round: 1, Trial: 1, IDs: []string{"a", "b", "c", "d"}},
+		{Round: 1, Trial: 2, IDs: []string{"a", "c", "b", "d"}},
+		{Round: 2, Trial: 1, IDs: []string{"b", "a"}},
+	}
+
+	scores := PlackettLuceScorer{}.Score(orderings, 2)
+	if len(scores) != 2 {
+		t.Fatalf("expected scores for round 2 documents only, got %v", scores)
+	}
+
+	// a led both round 1 batches, so one loss to b leaves it ahead
+	if scores["a"].Score >= scores["b"].Score {
+		t.Errorf("expected a ahead of b, got %+v vs %+v", scores["a"], scores["b"])
+	}
+
+	// More data narrows the standard error
+	fewer := PlackettLuceScorer{}.Score(orderings[2:], 2)
+	if scores["a"].StdErr >= fewer["a"].StdErr {
+		t.Errorf("expected earlier rounds to narrow the std err, got %v vs %v", scores["a"].StdErr, fewer["a"].StdErr)
+	}
+}
+
+func TestPlackettLuceScorer_Weights(t *testing.T) {
+	// An ordering of weight 2 counts like the same ordering twice
+	weighted := []BatchOrdering{
+		{Round: 1, IDs: []string{"a", "b", "c"}, Weight: 2},
+		{Round: 1, IDs: []string{"c", "a"}},
+	}
+	repeated := []BatchOrdering{
+		{Round: 1, IDs: []string{"a", "b", "c"}},
+		{Round: 1, IDs: []string{"a", "b", "c"}},
+		{Round: 1, IDs: []string{"c", "a"}},
+	}
+
+	got := PlackettLuceScorer{}.Score(weighted, 1)
+	want := PlackettLuceScorer{}.Score(repeated, 1)
+	for id, score := range want {
+		if math.Abs(got[id].Strength-score.Strength) > 1e-6 || math.Abs(got[id].StdErr-score.StdErr) > 1e-6 {
+			t.Errorf("expected %s to fit %+v, got %+v", id, score, got[id])
+		}
+	}
+}
+
+func TestNewScorer(t *testing.T) {
+	for _, model := range []ScoringModel{"", ScoringMean, ScoringPlackettLuce} {
+		if _, err := NewScorer(model); err != nil {
+			t.Errorf("NewScorer(%q) failed: %v", model, err)
+		}
+	}
+	if _, err := NewScorer("elo"); err == nil {
+		t.Error("expected error for unknown scoring model")
+	}
+
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.LLMProvider = echoRankProvider{}
+	config.ScoringModel = "elo"
+	if err := config.Validate(); err == nil {
+		t.Error("expected Validate to reject unknown scoring model")
+	}
+}
+
+func TestRanker_PlackettLuceScoring(t *testing.T) {
+	var lines []string
+	for i := 0; i < 12; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.BatchSize = 4
+	config.NumTrials = 3
+	config.EnableConvergence = false
+	config.RefinementRatio = 0
+	config.ScoringModel = ScoringPlackettLuce
+	config.LLMProvider = echoRankProvider{}
+	config.Seed = 7
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	results, err := ranker.RankFromReader(strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReader failed: %v", err)
+	}
+
+	if len(results) != len(lines) {
+		t.Fatalf("expected %d results, got %d", len(lines), len(results))
+	}
+	for _, doc := range results {
+		if doc.Strength <= 0 || doc.StdErr <= 0 {
+			t.Errorf("expected strength and std err for %s, got %v and %v", doc.Key, doc.Strength, doc.StdErr)
+		}
+	}
+
+	// Rank intervals come from the fitted standard errors, not bootstrapped positions
+	fitted := make(map[string]DocumentScore)
+	for _, doc := range results {
+		fitted[doc.Key] = DocumentScore{Score: doc.Score, Strength: doc.Strength, StdErr: doc.StdErr}
+	}
+	intervals := strengthIntervals(fitted)
+	for _, doc := range results {
+		if doc.RankCILow != intervals[doc.Key].rankLow || doc.RankCIHigh != intervals[doc.Key].rankHigh {
+			t.Errorf("expected rank interval [%d, %d] for %s, got [%d, %d]", intervals[doc.Key].rankLow,
+				intervals[doc.Key].rankHigh, doc.Key, doc.RankCILow, doc.RankCIHigh)
+		}
+		if doc.Observations != config.NumTrials {
+			t.Errorf("expected %d observations for %s, got %d", config.NumTrials, doc.Key, doc.Observations)
+		}
+	}
+}
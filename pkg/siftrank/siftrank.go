@@ -10,6 +10,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log/slog"
 	"math"
@@ -33,6 +34,14 @@ import (
 const (
 	idLen        = 8
 	minBatchSize = 2
+
+	// Projected response size per document for budget checks: an ID in the
+	// ranked list, plus a relevance sentence when relevance is collected
+	estimatedOutputTokensPerDoc    = 10
+	estimatedRelevanceTokensPerDoc = 60
+
+	// Projected response size of a relevance summary for budget checks
+	estimatedSummaryOutputTokens = 200
 )
 
 // ElbowMethod specifies the algorithm for detecting the elbow point in rankings
@@ -43,6 +52,29 @@ const (
 	ElbowMethodPerpendicular ElbowMethod = "perpendicular"
 )
 
+// RankMode selects how documents are compared
+type RankMode string
+
+const (
+	// ModeBatch ranks shuffled batches of documents per call (default)
+	ModeBatch RankMode = "batch"
+	// ModePairwise asks which of two documents is better per call, pairs
+	// documents Swiss-style and fits Bradley-Terry strengths to the answers
+	ModePairwise RankMode = "pairwise"
+	// ModePointwise scores each document from 1 to 10 against a rubric, which
+	// keeps scores comparable across runs
+	ModePointwise RankMode = "pointwise"
+)
+
+// validate reports whether the mode is one of the known ranking modes
+func (m RankMode) validate() error {
+	switch m {
+	case ModeBatch, ModePairwise, ModePointwise:
+		return nil
+	}
+	return fmt.Errorf("unknown mode %q (expected %s, %s or %s)", m, ModeBatch, ModePairwise, ModePointwise)
+}
+
 // Default configuration values
 const (
 	DefaultBatchSize         = 10
@@ -56,6 +88,9 @@ const (
 	DefaultMinTrials         = 5
 	DefaultElbowMethod       = ElbowMethodCurvature
 	DefaultEnableConvergence = true
+	DefaultAdaptiveWarmup    = 3
+	DefaultPointwiseSamples  = 3
+	DefaultScoreBatchSize    = 1
 
 	// MaxDocuments limits the total number of documents that can be ranked
 	// in a single operation to prevent out-of-memory conditions
@@ -148,7 +183,8 @@ type Config struct {
 	// More trials improve stability but increase cost/time.
 	NumTrials int `json:"num_trials"`
 
-	// Concurrency is the maximum concurrent LLM calls across all trials.
+	// Concurrency is the maximum concurrent LLM calls across all trials (and
+	// across concurrent calls on one Ranker).
 	Concurrency int `json:"concurrency"`
 
 	// RefinementRatio controls how many top documents are re-ranked (0.0-1.0).
@@ -162,9 +198,43 @@ type Config struct {
 	DryRun bool `json:"-"`
 
 	// TracePath writes JSON Lines trace output to this file path.
-	// Empty string disables tracing.
+	// Empty string disables tracing. Each traced call of a Ranker writes a
+	// file of its own: the first TracePath, later ones TracePath numbered
+	// before its extension (trace.2.jsonl, trace.3.jsonl, ...).
 	TracePath string `json:"-"`
 
+	// InputFormat sets how input is split into documents. Empty picks the
+	// format from the file extension (text for readers, or JSON if asked).
+	InputFormat InputFormat `json:"-"`
+
+	// RecordSeparator splits text input into multi-line records instead of
+	// lines. It is a regular expression matched against whole lines, e.g.
+	// "---", or `\s*` for blank lines; matching lines end a record and are
+	// dropped. Empty ranks each line.
+	RecordSeparator string `json:"-"`
+
+	// WholeFile ranks each input file as one document, with {{.Path}},
+	// {{.Name}} and {{.Data}} (the file's content) for the template.
+	WholeFile bool `json:"-"`
+
+	// SourceDir records, for each document loaded from a file, the file's
+	// path relative to this directory in RankedDocument.Source. Empty records
+	// nothing.
+	SourceDir string `json:"-"`
+
+	// IDField takes each document's ID from its JSON value (a dot-separated
+	// path such as "meta.id") or CSV/TSV column instead of hashing its value,
+	// so results can be joined back to the input by their keys.
+	IDField string `json:"-"`
+
+	// IDTemplate builds each document's ID with a Go template over the same
+	// fields as the item template (or "@file.tpl" to read it from a file).
+	IDTemplate string `json:"-"`
+
+	// Duplicates sets what happens to documents with the same ID, such as
+	// identical lines. Empty merges them.
+	Duplicates DuplicatePolicy `json:"-"`
+
 	// Relevance enables post-processing to generate pros/cons for each item.
 	Relevance bool `json:"relevance"`
 
@@ -174,6 +244,12 @@ type Config struct {
 	// Logger is the structured logger for output. If nil, a default is created.
 	Logger *slog.Logger `json:"-"`
 
+	// OnEvent receives progress events (round started, batch and trial
+	// completed, convergence, relevance summaries and errors) as the run
+	// goes. Events are delivered one at a time from the ranking goroutines,
+	// so a slow handler slows the run. Nil disables events.
+	OnEvent func(Event) `json:"-"`
+
 	// EnableConvergence enables early stopping when rankings stabilize.
 	EnableConvergence bool `json:"enable_convergence"`
 
@@ -190,12 +266,82 @@ type Config struct {
 	// ElbowMethodCurvature (default) or ElbowMethodPerpendicular.
 	ElbowMethod ElbowMethod `json:"elbow_method"`
 
-	// LLMProvider handles LLM calls. If nil, creates default OpenAI provider.
+	// ScoringModel selects how batch orderings become scores: ScoringMean
+	// (default) or ScoringPlackettLuce. Convergence detection always uses
+	// mean positions.
+	ScoringModel ScoringModel `json:"scoring_model,omitempty"`
+
+	// Scorer overrides ScoringModel with a custom scoring implementation.
+	Scorer Scorer `json:"-"`
+
+	// Mode chooses how documents are compared: ModeBatch (default) ranks
+	// batches of BatchSize documents per call; ModePairwise asks which of two
+	// documents is better, for small sets where accuracy matters more than
+	// calls; ModePointwise scores documents against Rubric. Pairwise mode
+	// defaults ScoringModel to ScoringPlackettLuce, which on pairs is the
+	// Bradley-Terry model. Neither pairwise nor pointwise mode supports
+	// Relevance, and pairwise mode does not support adaptive batch selection.
+	Mode RankMode `json:"mode,omitempty"`
+
+	// Rubric is the grading guide for ModePointwise, which scores each
+	// document from 1 (worst) to 10 (best) against it. Required in that mode.
+	Rubric string `json:"rubric,omitempty"`
+
+	// PointwiseSamples is how many times ModePointwise scores each document;
+	// its AbsoluteScore is the mean.
+	PointwiseSamples int `json:"pointwise_samples,omitempty"`
+
+	// ScoreBatchSize is the number of documents ModePointwise scores per call.
+	ScoreBatchSize int `json:"score_batch_size,omitempty"`
+
+	// BlendWeight mixes a listwise ranking into ModePointwise's order: 0 (the
+	// default) orders by absolute score alone, 1 by listwise position alone.
+	// A non-zero weight runs the listwise ranking first.
+	BlendWeight float64 `json:"blend_weight,omitempty"`
+
+	// MinScore drops documents whose AbsoluteScore is below it (0 = keep
+	// all). ModePointwise only.
+	MinScore float64 `json:"min_score,omitempty"`
+
+	// Criteria ranks the documents once per criterion, each with its own
+	// prompt (after InitialPrompt, which becomes optional), and combines the
+	// rankings with CriteriaAggregation. Batch mode only.
+	Criteria []Criterion `json:"criteria,omitempty"`
+
+	// CriteriaAggregation combines per-criterion rankings: AggregationBorda
+	// (default) by weighted mean position, or AggregationPlackettLuce by one
+	// weighted fit to every criterion's batch orderings.
+	CriteriaAggregation CriteriaAggregation `json:"criteria_aggregation,omitempty"`
+
+	// BatchSelection chooses how trials build their batches:
+	// BatchSelectionRandom (default) shuffles every document into each trial;
+	// BatchSelectionAdaptive focuses later trials on documents whose rank is
+	// still uncertain around the refinement cutoff. Adaptive batches are not
+	// random, so it defaults ScoringModel to ScoringPlackettLuce.
+	BatchSelection BatchSelection `json:"batch_selection,omitempty"`
+
+	// AdaptiveWarmupTrials is the number of random trials run before adaptive
+	// batching starts. Every document is ranked in each of them, which is the
+	// minimum exposure adaptive batching guarantees.
+	AdaptiveWarmupTrials int `json:"adaptive_warmup_trials,omitempty"`
+
+	// LLMProvider handles LLM calls. If nil, NewRanker creates one from
+	// ProviderConfig, or from Provider and the OpenAI* fields below.
 	LLMProvider LLMProvider `json:"-"`
 
-	// OpenAI configuration (used only if LLMProvider is nil)
+	// Provider selects the provider type created when LLMProvider and
+	// ProviderConfig are nil. Defaults to ProviderTypeOpenAI. The OpenAI*
+	// fields below supply its model, API key and base URL.
+	Provider ProviderType `json:"provider,omitempty"`
+
+	// ProviderConfig fully describes the provider to create when LLMProvider
+	// is nil. Takes precedence over Provider and the OpenAI* fields. Empty
+	// Encoding and Logger are filled in from this Config.
+	ProviderConfig *ProviderConfig `json:"-"`
+
+	// OpenAI configuration (used only if LLMProvider and ProviderConfig are nil)
 	OpenAIModel  openai.ChatModel `json:"openai_model"` // Model name (e.g., "gpt-4o-mini")
-	OpenAIKey    string           `json:"-"`            // API key (required if LLMProvider is nil)
+	OpenAIKey    string           `json:"-"`            // API key (required for the default OpenAI provider)
 	OpenAIAPIURL string           `json:"-"`            // Base URL (for compatible APIs like vLLM)
 
 	// CompareModels enables model comparison mode (format: "provider:model,provider:model")
@@ -210,6 +356,67 @@ type Config struct {
 	// Effort is the reasoning effort level: none, minimal, low, medium, high.
 	Effort string `json:"effort"`
 
+	// CacheDir enables the on-disk response cache when non-empty.
+	// Completions are stored under this directory and replayed for identical requests.
+	CacheDir string `json:"-"`
+
+	// CacheMode controls cache reads and writes (default: CacheModeReadWrite).
+	CacheMode CacheMode `json:"-"`
+
+	// CacheTTL expires cache entries older than this duration (0 = never expire).
+	CacheTTL time.Duration `json:"-"`
+
+	// CacheNamespace identifies the model behind a custom LLMProvider in cache
+	// keys. Required with CacheDir and LLMProvider, since the ranker cannot
+	// tell which model a custom provider calls.
+	CacheNamespace string `json:"-"`
+
+	// RecordPath writes every LLM call to this JSONL cassette when non-empty.
+	// The cassette also stores the seed so a replay shuffles identically.
+	RecordPath string `json:"-"`
+
+	// ReplayPath serves LLM responses from a cassette written via RecordPath
+	// instead of calling a provider. Mutually exclusive with RecordPath.
+	ReplayPath string `json:"-"`
+
+	// ReplayMode selects how replayed calls are matched (default: ReplayByPrompt).
+	ReplayMode ReplayMode `json:"-"`
+
+	// CheckpointDir saves the run's progress to this directory after every
+	// completed trial and round, so that ResumeDir can continue it after a
+	// crash or interrupt. Batch mode without Criteria only, and one ranking
+	// call at a time, since every call writes the same checkpoint.
+	CheckpointDir string `json:"-"`
+
+	// ResumeDir continues the run checkpointed in this directory: finished
+	// rounds and completed trials are restored rather than re-run. The run
+	// must rank the same documents with the same prompt, seed and ranking
+	// settings. Checkpoints keep going to ResumeDir unless CheckpointDir is set.
+	ResumeDir string `json:"-"`
+
+	// Seed makes every random decision in a run (trial shuffles, remainder
+	// reshuffles, ID assignment) reproducible. 0 picks a random seed (or the
+	// cassette's seed when replaying, or cacheSeed when CacheDir is set). The
+	// seed used is logged and written to the trace header.
+	Seed int64 `json:"seed,omitempty"`
+
+	// Pricing prices every call at this rate when non-nil, overriding
+	// PricingTable. Used for RankResult.CostUSD and MaxCostUSD.
+	Pricing *Pricing `json:"pricing,omitempty"`
+
+	// PricingTable prices calls by the model that served them (default:
+	// DefaultPricing). Calls from unlisted models use the configured model's price.
+	PricingTable PricingTable `json:"-"`
+
+	// MaxTokens stops scheduling LLM calls once the tokens used plus those
+	// projected for the next call would exceed it (0 = no limit).
+	MaxTokens int `json:"max_tokens,omitempty"`
+
+	// MaxCostUSD stops scheduling LLM calls once the cost so far plus the
+	// projected cost of the next call would exceed it (0 = no limit).
+	// Requires Pricing or a PricingTable entry for the configured model(s).
+	MaxCostUSD float64 `json:"max_cost_usd,omitempty"`
+
 	// Watch enables live terminal visualization (CLI only).
 	Watch bool `json:"-"`
 
@@ -218,7 +425,7 @@ type Config struct {
 }
 
 func (c *Config) Validate() error {
-	if c.InitialPrompt == "" {
+	if c.InitialPrompt == "" && len(c.Criteria) == 0 {
 		return fmt.Errorf("initial prompt cannot be empty")
 	}
 	if c.BatchSize <= 0 {
@@ -233,8 +440,14 @@ func (c *Config) Validate() error {
 	if c.BatchTokens <= 0 {
 		return fmt.Errorf("batch tokens must be greater than 0")
 	}
-	// Only require OpenAI key if no provider is set
-	if c.LLMProvider == nil && c.OpenAIAPIURL == "" && c.OpenAIKey == "" {
+	if c.Provider != "" {
+		if _, err := ParseProviderType(string(c.Provider)); err != nil {
+			return err
+		}
+	}
+	// Only require OpenAI key if the default OpenAI provider will be created
+	usesDefaultOpenAI := c.Provider == "" || c.Provider == ProviderTypeOpenAI
+	if c.LLMProvider == nil && c.ProviderConfig == nil && c.CompareModels == "" && c.ReplayPath == "" && usesDefaultOpenAI && c.OpenAIAPIURL == "" && c.OpenAIKey == "" {
 		return fmt.Errorf("openai key cannot be empty")
 	}
 	if c.BatchSize < minBatchSize {
@@ -254,11 +467,111 @@ func (c *Config) Validate() error {
 	if c.ElbowMethod != "" && c.ElbowMethod != ElbowMethodCurvature && c.ElbowMethod != ElbowMethodPerpendicular {
 		return fmt.Errorf("elbow method must be ElbowMethodCurvature or ElbowMethodPerpendicular, got '%s'", c.ElbowMethod)
 	}
+	if c.ScoringModel != "" {
+		if err := c.ScoringModel.validate(); err != nil {
+			return err
+		}
+	}
+	if c.BatchSelection != "" {
+		if err := c.BatchSelection.validate(); err != nil {
+			return err
+		}
+	}
+	if c.BatchSelection == BatchSelectionAdaptive && c.AdaptiveWarmupTrials < 1 {
+		return fmt.Errorf("adaptive warm-up trials must be at least 1")
+	}
+	if c.Mode != "" {
+		if err := c.Mode.validate(); err != nil {
+			return err
+		}
+	}
+	if (c.Mode == ModePairwise || c.Mode == ModePointwise) && c.Relevance {
+		return fmt.Errorf("relevance is not supported in %s mode", c.Mode)
+	}
+	if c.Mode == ModePairwise && c.BatchSelection == BatchSelectionAdaptive {
+		return fmt.Errorf("adaptive batch selection is not supported in pairwise mode")
+	}
+	if c.Mode == ModePointwise {
+		if strings.TrimSpace(c.Rubric) == "" {
+			return fmt.Errorf("pointwise mode requires a rubric")
+		}
+		if c.PointwiseSamples < 1 {
+			return fmt.Errorf("pointwise samples must be at least 1")
+		}
+		if c.ScoreBatchSize < 1 {
+			return fmt.Errorf("score batch size must be at least 1")
+		}
+	} else if c.BlendWeight != 0 || c.MinScore != 0 {
+		return fmt.Errorf("blend weight and minimum score require pointwise mode")
+	}
+	if c.BlendWeight < 0 || c.BlendWeight > 1 {
+		return fmt.Errorf("blend weight must be between 0 and 1")
+	}
+	if c.MinScore != 0 && (c.MinScore < minAbsoluteScore || c.MinScore > maxAbsoluteScore) {
+		return fmt.Errorf("minimum score must be between %d and %d", minAbsoluteScore, maxAbsoluteScore)
+	}
+	if len(c.Criteria) > 0 {
+		if c.Mode != "" && c.Mode != ModeBatch {
+			return fmt.Errorf("criteria are not supported in %s mode", c.Mode)
+		}
+		if err := validateCriteria(c.Criteria); err != nil {
+			return err
+		}
+	}
+	if c.InputFormat != "" {
+		if err := c.InputFormat.validate(); err != nil {
+			return err
+		}
+	}
+	if c.RecordSeparator != "" {
+		if c.WholeFile {
+			return fmt.Errorf("record separator and whole file mode are mutually exclusive")
+		}
+		if _, err := recordSeparatorPattern(c.RecordSeparator); err != nil {
+			return err
+		}
+	}
+	if c.IDField != "" && c.IDTemplate != "" {
+		return fmt.Errorf("ID field and ID template are mutually exclusive")
+	}
+	if c.Duplicates != "" {
+		if err := c.Duplicates.validate(); err != nil {
+			return err
+		}
+	}
+	if c.CriteriaAggregation != "" {
+		if err := c.CriteriaAggregation.validate(); err != nil {
+			return err
+		}
+	}
+	if c.CacheMode != "" {
+		if err := c.CacheMode.validate(); err != nil {
+			return err
+		}
+	}
+	if c.CacheTTL < 0 {
+		return fmt.Errorf("cache TTL must be >= 0")
+	}
+	if c.CacheDir != "" && c.LLMProvider != nil && c.CacheNamespace == "" {
+		return fmt.Errorf("response cache needs CacheNamespace to identify a custom LLMProvider")
+	}
+	if c.RecordPath != "" && c.ReplayPath != "" {
+		return fmt.Errorf("record and replay cannot be used together")
+	}
+	if (c.CheckpointDir != "" || c.ResumeDir != "") && (c.Mode == ModePairwise || c.Mode == ModePointwise || len(c.Criteria) > 0) {
+		return fmt.Errorf("checkpoints are only supported in batch mode without criteria")
+	}
+	if c.MaxTokens < 0 {
+		return fmt.Errorf("max tokens must be >= 0")
+	}
+	if c.MaxCostUSD < 0 {
+		return fmt.Errorf("max cost must be >= 0")
+	}
 	return nil
 }
 
 // NewConfig returns a Config with sensible defaults matching the CLI.
-// Callers should set at minimum: InitialPrompt and OpenAIKey (or LLMProvider).
+// Callers should set at minimum: InitialPrompt and OpenAIKey (or ProviderConfig/LLMProvider).
 func NewConfig() *Config {
 	return &Config{
 		BatchSize:         DefaultBatchSize,
@@ -272,6 +585,10 @@ func NewConfig() *Config {
 		StableTrials:      DefaultStableTrials,
 		MinTrials:         DefaultMinTrials,
 		EnableConvergence: DefaultEnableConvergence,
+
+		AdaptiveWarmupTrials: DefaultAdaptiveWarmup,
+		PointwiseSamples:     DefaultPointwiseSamples,
+		ScoreBatchSize:       DefaultScoreBatchSize,
 	}
 }
 
@@ -279,27 +596,63 @@ type docStats struct {
 	ID                string
 	Value             string
 	Document          interface{}
-	InputIndex        int      // Index in original input (0-based)
-	relevanceSnippets []string // Collected relevance from all batches/trials
+	InputIndex        int        // Index in original input (0-based)
+	relevanceSnippets []string   // Collected relevance from all batches/trials
+	snippetTrials     []trialRef // Trial each snippet came from (for checkpoints)
 }
 
+// Ranker ranks documents with an LLM. Its configuration is fixed by NewRanker,
+// and every ranking call runs on its own copy of the per-run state, so one
+// Ranker can serve concurrent calls and later calls start fresh. Calls share
+// the provider, response cache, cassette recorder and Concurrency limit, and
+// each traced call writes a trace file of its own (see Config.TracePath).
 type Ranker struct {
 	cfg              *Config
 	provider         LLMProvider
+	scorer           Scorer                 // Turns batch orderings into scores
+	semaphore        chan struct{}          // Global concurrency limiter
+	metricsCollector *eval.MetricsCollector // Model evaluation (optional, only set when CompareModels is used)
+	cache            *CachingProvider       // Response cache (optional, only set when CacheDir is used)
+	recorder         *RecordingProvider     // Cassette recorder (optional, only set when RecordPath is used)
+	mu               sync.Mutex             // Protects runState, and resume and traceRuns of the shared Ranker
+	traceRuns        int                    // Traced calls started, numbering their trace files
+
+	// Pricing for cost reporting and budgets
+	pricing      *Pricing     // Price for calls from models missing in pricingTable (nil if unknown)
+	pricingTable PricingTable // Prices by model name
+
+	// Checkpointing (optional, only set when CheckpointDir or ResumeDir is used)
+	checkpointDir string      // Directory checkpoints are written to
+	resume        *checkpoint // Checkpoint being resumed (nil once its rounds are restored)
+
+	// Seed used for rng and per-batch ID mappings (recorded so runs can be reproduced)
+	seed int64
+
+	runState
+}
+
+// runState is the state of one ranking call, which newRun starts from scratch
+type runState struct {
 	rng              *rand.Rand
+	rngSource        *countingSource // Source of rng, counted so a resume can restore it
 	numBatches       int
 	round            int
-	semaphore        chan struct{}              // Global concurrency limiter
 	elbowPositions   []int                      // Track elbow position after each trial
 	rankingOrders    [][]string                 // Track full ranking order per trial
-	mu               sync.Mutex                 // Protect elbowPositions, rankingOrders, converged, comparedAgainst, and allDocStats
 	converged        bool                       // Track if convergence already detected
 	elbowCutoff      int                        // Cutoff position for refinement
 	originalDocCount int                        // Track original dataset size for exposure calculation
 	comparedAgainst  map[string]map[string]bool // Track which docs each was compared against (across ALL rounds/trials)
+	callMode         RankMode                   // Mode of the calls being made (batch while pointwise mode blends in a listwise ranking)
+	criterion        *Criterion                 // Criterion being ranked (nil outside multi-criteria runs)
+	orderings        []BatchOrdering            // Every batch ordering (across ALL rounds/trials)
+	composeTrial     batchComposer              // Builds each trial's batches instead of shuffling (nil = shuffle)
 	allDocStats      map[string]*docStats       // Track all documents across rounds (for relevance collection)
+	duplicates       map[string][]Duplicate     // Documents merged into each document, by ID
+	sources          map[string]string          // File each document was loaded from, by ID
 	traceFile        *os.File                   // Keep file open across all rounds
 	screen           interface{}                // tcell.Screen for terminal visualization (interface{} to avoid import cycle)
+	eventMu          sync.Mutex                 // Delivers events one at a time
 
 	// Token and call tracking (accumulate across all rounds)
 	totalUsage   Usage
@@ -308,8 +661,30 @@ type Ranker struct {
 	totalTrials  int
 	totalRounds  int
 
-	// Model evaluation (optional, only set when CompareModels is used)
-	metricsCollector *eval.MetricsCollector
+	// Run metadata for RankResult (accumulate across all rounds)
+	roundStats        []RoundStats
+	convergenceReason ConvergenceReason // Why the current round converged ("" if not yet)
+	modelsUsed        map[string]bool
+
+	// Spend tracking for cost reporting and budgets (per call, unlike totalUsage
+	// which only counts completed trials)
+	usageByModel   map[string]Usage // Usage of every uncached call, by reported model
+	reservedUsage  Usage            // Projected usage of calls in flight
+	budgetExceeded bool             // Set once a budget stopped scheduling work
+
+	// Response cache lookups of the run's calls (only counted when CacheDir is used)
+	cacheHits   int
+	cacheMisses int
+
+	// Checkpointing of the run
+	finishedRounds []finishedRound // Rounds whose rankings are final, for the next checkpoint
+	fingerprint    string          // Hash of what the run's checkpoints depend on
+}
+
+// traceHeader is the first line of a trace file
+type traceHeader struct {
+	EventType string `json:"event_type"` // Always "header"
+	Seed      int64  `json:"seed"`
 }
 
 func NewRanker(config *Config) (*Ranker, error) {
@@ -317,6 +692,11 @@ func NewRanker(config *Config) (*Ranker, error) {
 		return nil, err
 	}
 
+	// Keep a copy, so the caller's Config is not changed and later changes to
+	// it do not reach the ranker
+	configCopy := *config
+	config = &configCopy
+
 	// Initialize default logger if not provided
 	if config.Logger == nil {
 		config.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
@@ -328,6 +708,29 @@ func NewRanker(config *Config) (*Ranker, error) {
 	// Create provider (default to OpenAI if none specified)
 	provider := config.LLMProvider
 	var metricsCollector *eval.MetricsCollector
+	cacheModel := config.CacheNamespace
+	var cacheEndpoint, cacheEffort string
+	pricingModels := []string{string(config.OpenAIModel)}
+	if config.ProviderConfig != nil {
+		pricingModels = []string{config.ProviderConfig.Model}
+	}
+
+	// Replay a recorded cassette instead of calling a provider
+	var replay *ReplayProvider
+	if provider == nil && config.ReplayPath != "" {
+		var err error
+		replay, err = NewReplayProvider(ReplayConfig{
+			Path:     config.ReplayPath,
+			Mode:     config.ReplayMode,
+			Encoding: config.Encoding,
+			Logger:   config.Logger,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load replay cassette: %w", err)
+		}
+		provider = replay
+		config.Logger.Info("replaying recorded responses", "cassette", config.ReplayPath, "calls", len(replay.calls))
+	}
 
 	if provider == nil {
 		// Check if CompareModels is set
@@ -339,41 +742,267 @@ func NewRanker(config *Config) (*Ranker, error) {
 				return nil, fmt.Errorf("failed to create eval provider: %w", err)
 			}
 			config.Logger.Info("model comparison enabled", "models", config.CompareModels)
+			cacheModel = config.CompareModels
+			pricingModels = compareModelNames(config.CompareModels)
 		} else {
-			// Create default OpenAI provider
+			// Create the configured provider (OpenAI unless told otherwise)
+			var providerCfg ProviderConfig
+			if config.ProviderConfig != nil {
+				providerCfg = *config.ProviderConfig
+			} else {
+				providerType := config.Provider
+				if providerType == "" {
+					providerType = ProviderTypeOpenAI
+				}
+				providerCfg = ProviderConfig{
+					Type:    providerType,
+					APIKey:  config.OpenAIKey,
+					Model:   string(config.OpenAIModel),
+					BaseURL: config.OpenAIAPIURL,
+					Effort:  config.Effort,
+				}
+			}
+			if providerCfg.Encoding == "" {
+				providerCfg.Encoding = config.Encoding
+			}
+			if providerCfg.Logger == nil {
+				providerCfg.Logger = config.Logger
+			}
+			cacheModel = string(providerCfg.Type) + ":" + providerCfg.Model
+			cacheEndpoint = providerCfg.BaseURL
+			cacheEffort = providerCfg.Effort
+
 			var err error
-			provider, err = NewProvider(ProviderConfig{
-				Type:     ProviderTypeOpenAI,
-				APIKey:   config.OpenAIKey,
-				Model:    string(config.OpenAIModel),
-				BaseURL:  config.OpenAIAPIURL,
-				Encoding: config.Encoding,
-				Effort:   config.Effort,
-				Logger:   config.Logger,
-			})
+			provider, err = NewProvider(providerCfg)
 			if err != nil {
 				return nil, fmt.Errorf("failed to create provider: %w", err)
 			}
 		}
 	}
 
-	// Create cryptographically secure seed for RNG
-	var seedBytes [8]byte
-	if _, err := crand.Read(seedBytes[:]); err != nil {
-		return nil, fmt.Errorf("failed to generate secure random seed: %w", err)
+	// Wrap provider with the response cache if requested
+	var cache *CachingProvider
+	if config.CacheDir != "" {
+		var err error
+		cache, err = NewCachingProvider(provider, CacheConfig{
+			Dir:      config.CacheDir,
+			Mode:     config.CacheMode,
+			TTL:      config.CacheTTL,
+			Model:    cacheModel,
+			Endpoint: cacheEndpoint,
+			Effort:   cacheEffort,
+			Logger:   config.Logger,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create response cache: %w", err)
+		}
+		provider = cache
+		config.Logger.Info("response cache enabled", "dir", config.CacheDir, "mode", cache.mode)
+	}
+
+	// Load the checkpoint to resume, whose seed the run must keep
+	var resume *checkpoint
+	if config.ResumeDir != "" {
+		var err error
+		if resume, err = loadCheckpoint(config.ResumeDir); err != nil {
+			return nil, err
+		}
+		if config.Seed != 0 && config.Seed != resume.Seed {
+			return nil, fmt.Errorf("seed %d does not match the checkpoint's seed %d", config.Seed, resume.Seed)
+		}
+		config.Logger.Info("resuming from checkpoint", "dir", config.ResumeDir, "finished_rounds", len(resume.Rounds))
+	}
+	checkpointDir := config.CheckpointDir
+	if checkpointDir == "" {
+		checkpointDir = config.ResumeDir
+	}
+	if checkpointDir != "" {
+		if err := os.MkdirAll(checkpointDir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+		}
+	}
+
+	// Use the configured seed, the resumed or replayed run's seed, the cache's
+	// fixed seed, or a cryptographically secure one
+	seed := config.Seed
+	if seed == 0 && resume != nil {
+		seed = resume.Seed
+	}
+	if seed == 0 && replay != nil {
+		seed = replay.Seed()
+	}
+	if seed == 0 && cache != nil {
+		seed = cacheSeed
+	}
+	if seed == 0 {
+		var seedBytes [8]byte
+		if _, err := crand.Read(seedBytes[:]); err != nil {
+			return nil, fmt.Errorf("failed to generate secure random seed: %w", err)
+		}
+		seed = int64(binary.BigEndian.Uint64(seedBytes[:])) // #nosec G115 - overflow is acceptable for RNG seed
+	}
+
+	// Record calls outermost so the cassette sees exactly what the ranker saw
+	var recorder *RecordingProvider
+	if config.RecordPath != "" {
+		var err error
+		recorder, err = NewRecordingProvider(provider, RecordConfig{Path: config.RecordPath, Seed: seed})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create recording: %w", err)
+		}
+		provider = recorder
+		config.Logger.Info("recording LLM calls", "cassette", config.RecordPath, "seed", seed)
+	}
+
+	// Resolve pricing for cost reporting and budgets
+	pricingTable := config.PricingTable
+	if pricingTable == nil {
+		pricingTable = DefaultPricing
+	}
+	pricing := config.Pricing
+	if pricing == nil {
+		pricing = fallbackPricing(pricingTable, pricingModels)
+	}
+	if config.MaxCostUSD > 0 && pricing == nil {
+		return nil, fmt.Errorf("cost budget requires pricing for %s (set a price or a pricing file)", strings.Join(pricingModels, ", "))
+	}
+
+	scorer := config.Scorer
+	if scorer == nil {
+		scoringModel := config.ScoringModel
+		if scoringModel == "" && (config.BatchSelection == BatchSelectionAdaptive || config.Mode == ModePairwise) {
+			scoringModel = ScoringPlackettLuce
+		}
+		var err error
+		if scorer, err = NewScorer(scoringModel); err != nil {
+			return nil, err
+		}
 	}
-	seed := int64(binary.BigEndian.Uint64(seedBytes[:])) // #nosec G115 - overflow is acceptable for RNG seed
 
 	return &Ranker{
 		cfg:              config,
 		provider:         provider,
+		scorer:           scorer,
+		semaphore:        make(chan struct{}, config.Concurrency),
 		metricsCollector: metricsCollector,
-		// #nosec G404 - Using math/rand seeded with crypto/rand for shuffling (not security-critical)
-		rng:       rand.New(rand.NewSource(seed)),
-		semaphore: make(chan struct{}, config.Concurrency),
+		cache:            cache,
+		recorder:         recorder,
+		pricing:          pricing,
+		pricingTable:     pricingTable,
+		checkpointDir:    checkpointDir,
+		resume:           resume,
+		seed:             seed,
 	}, nil
 }
 
+// cacheSeed is the seed of runs with a response cache and no Seed set. A
+// random seed would shuffle batches and assign IDs differently on every run,
+// so no prompt of a re-run would hit the cache.
+const cacheSeed int64 = 1
+
+// newRun returns a ranker for one ranking call. It shares r's configuration
+// (copied, since rounds shrink BatchSize), provider, caches, recorder and
+// concurrency limit, and starts its runState, including the random stream,
+// from scratch. Only the first run resumes a checkpoint.
+func (r *Ranker) newRun() *Ranker {
+	cfg := *r.cfg
+
+	r.mu.Lock()
+	resume := r.resume
+	r.resume = nil
+	r.mu.Unlock()
+
+	rngSource := newCountingSource(r.seed)
+	return &Ranker{
+		cfg:              &cfg,
+		provider:         r.provider,
+		scorer:           r.scorer,
+		semaphore:        r.semaphore,
+		metricsCollector: r.metricsCollector,
+		cache:            r.cache,
+		recorder:         r.recorder,
+		pricing:          r.pricing,
+		pricingTable:     r.pricingTable,
+		checkpointDir:    r.checkpointDir,
+		resume:           resume,
+		seed:             r.seed,
+		runState: runState{
+			rngSource: rngSource,
+			// #nosec G404 - Using math/rand seeded with crypto/rand for shuffling (not security-critical)
+			rng: rand.New(rngSource),
+		},
+	}
+}
+
+// Seed returns the seed used for the ranker's random number generator
+func (r *Ranker) Seed() int64 {
+	return r.seed
+}
+
+// Close releases resources held by the ranker, such as the record cassette.
+func (r *Ranker) Close() error {
+	if r.recorder != nil {
+		return r.recorder.Close()
+	}
+	return nil
+}
+
+// errBudgetExceeded marks work skipped because a budget was reached
+var errBudgetExceeded = errors.New("budget exceeded")
+
+// logBudgetEstimate logs the projected round 1 spend before any call is made
+func (r *Ranker) logBudgetEstimate(documents []document) {
+	batchSize := min(r.cfg.BatchSize, len(documents))
+	numBatches := len(documents) / batchSize
+
+	var trialUsage Usage
+	for i := 0; i < numBatches; i++ {
+		trialUsage.Add(r.projectBatchUsage(documents[i*batchSize : (i+1)*batchSize]))
+	}
+	round1Usage := scaleUsage(trialUsage, r.cfg.NumTrials)
+
+	logArgs := []any{
+		"calls_per_trial", numBatches,
+		"tokens_per_trial", trialUsage.TotalTokens(),
+		"max_round1_tokens", round1Usage.TotalTokens(),
+		"max_tokens", r.cfg.MaxTokens,
+	}
+	if r.pricing != nil {
+		logArgs = append(logArgs,
+			"cost_per_trial_usd", r.pricing.Cost(trialUsage),
+			"max_round1_cost_usd", r.pricing.Cost(round1Usage),
+			"max_cost_usd", r.cfg.MaxCostUSD)
+	}
+	r.cfg.Logger.Info("Budget estimate", logArgs...)
+}
+
+// compareModelNames extracts the model names from a CompareModels spec
+func compareModelNames(compareModels string) []string {
+	var models []string
+	for _, spec := range strings.Split(compareModels, ",") {
+		if parts := strings.SplitN(strings.TrimSpace(spec), ":", 2); len(parts) == 2 {
+			models = append(models, parts[1])
+		}
+	}
+	return models
+}
+
+// fallbackPricing returns the price of the most expensive configured model,
+// or nil if any of them is missing from the table
+func fallbackPricing(table PricingTable, models []string) *Pricing {
+	var fallback *Pricing
+	for _, model := range models {
+		pricing, ok := table.Lookup(model)
+		if !ok {
+			return nil
+		}
+		if fallback == nil || pricing.InputPerMillion+pricing.OutputPerMillion > fallback.InputPerMillion+fallback.OutputPerMillion {
+			fallback = &pricing
+		}
+	}
+	return fallback
+}
+
 // adjustBatchSize dynamically adjusts batch size to fit within token limits
 // by testing the worst case: the N largest documents
 func (ranker *Ranker) adjustBatchSize(documents []document) error {
@@ -436,6 +1065,8 @@ type document struct {
 	Value      string      `json:"value"`    // to be ranked
 	Document   interface{} `json:"document"` // if loading from json file
 	InputIndex int         // Index in original input (0-based)
+	fields     interface{} // What the item template was given, for Config.IDField and IDTemplate
+	source     string      // File the document came from (only if Config.SourceDir is set)
 }
 
 type rankedDocument struct {
@@ -470,25 +1101,116 @@ type RelevanceProsCons struct {
 	Cons string `json:"cons"` // Qualities making item LESS relevant
 }
 
+// ConvergenceReason explains why a round stopped running trials
+type ConvergenceReason string
+
+const (
+	ConvergenceElbowStable   ConvergenceReason = "elbow_stable"             // Elbow position stabilized
+	ConvergenceRankingStable ConvergenceReason = "ranking_stable"           // Ranking order stabilized
+	ConvergenceBothStable    ConvergenceReason = "elbow_and_ranking_stable" // Both criteria met on the same trial
+	ConvergenceMaxTrials     ConvergenceReason = "max_trials"               // Ran all trials without converging
+	ConvergenceDisabled      ConvergenceReason = "disabled"                 // Convergence detection turned off
+	ConvergenceCanceled      ConvergenceReason = "canceled"                 // Context ended mid-round
+	ConvergenceBudget        ConvergenceReason = "budget"                   // MaxTokens or MaxCostUSD reached
+	ConvergenceSettled       ConvergenceReason = "settled"                  // Adaptive batching found no uncertain documents
+)
+
+// RoundStats summarizes one round of shuffled batch ranking
+type RoundStats struct {
+	Round             int               `json:"round"`
+	Documents         int               `json:"documents"` // Documents ranked in this round
+	Trials            int               `json:"trials"`    // Trials fully completed
+	Batches           int               `json:"batches"`
+	Calls             int               `json:"calls"`
+	Usage             Usage             `json:"usage"`
+	ElbowPositions    []int             `json:"elbow_positions,omitempty"` // Elbow detected after each evaluated trial
+	ElbowCutoff       int               `json:"elbow_cutoff"`              // Refinement cutoff (-1 if none)
+	ConvergenceReason ConvergenceReason `json:"convergence_reason"`
+	Criterion         string            `json:"criterion,omitempty"` // Criterion ranked (multi-criteria runs only)
+}
+
+// RankResult is the full outcome of a ranking run: the ranked documents plus
+// usage totals and the metadata needed to understand or reproduce the run.
+type RankResult struct {
+	Documents  []*RankedDocument `json:"documents"`
+	Rounds     []RoundStats      `json:"rounds"`
+	Usage      Usage             `json:"usage"`
+	NumCalls   int               `json:"num_calls"`
+	NumBatches int               `json:"num_batches"`
+	NumTrials  int               `json:"num_trials"`
+	CostUSD    *float64          `json:"cost_usd,omitempty"` // Only if every call could be priced
+	Models     []string          `json:"models,omitempty"`   // Models reported by the provider(s)
+	Seed       int64             `json:"seed"`
+	StartedAt  time.Time         `json:"started_at"`
+	WallTimeMs int64             `json:"wall_time_ms"`
+
+	// BudgetExceeded is true when MaxTokens or MaxCostUSD stopped the run
+	// early. Documents then hold the best ranking reached within budget.
+	BudgetExceeded bool `json:"budget_exceeded,omitempty"`
+}
+
+// CanceledError is returned by the Context ranking methods when the context
+// is cancelled or its deadline passes before ranking completes. The results
+// returned alongside it are a partial ranking: documents not yet scored in
+// round 1 are omitted, and an interrupted refinement round keeps the previous
+// round's order if it had not scored every document.
+type CanceledError struct {
+	Round  int   // Round that was interrupted
+	Trials int   // Trials fully completed in that round
+	Err    error // context.Canceled or context.DeadlineExceeded
+}
+
+func (e *CanceledError) Error() string {
+	return fmt.Sprintf("ranking canceled in round %d after %d trials: %v", e.Round, e.Trials, e.Err)
+}
+
+func (e *CanceledError) Unwrap() error {
+	return e.Err
+}
+
 type RankedDocument struct {
 	Key        string             `json:"key"`
 	Value      string             `json:"value"`
 	Document   interface{}        `json:"document"`    // if loading from json file
 	Score      float64            `json:"score"`
+	Strength   float64            `json:"strength,omitempty"` // Latent strength (Plackett-Luce scoring only)
+	StdErr     float64            `json:"std_err,omitempty"`  // Standard error of log(strength)
+
+	AbsoluteScore float64 `json:"absolute_score,omitempty"` // Mean rubric score from 1 to 10 (pointwise mode only)
+
+	Criteria []CriterionRank `json:"criteria,omitempty"` // Rank under each criterion (multi-criteria runs only)
+
+	// Uncertainty, from the batch positions in the document's last round
+	ScoreVariance float64  `json:"score_variance"`      // Sample variance of its batch positions
+	Observations  int      `json:"observations"`        // Batch positions observed
+	RankCILow     int      `json:"rank_ci_low"`         // 95% bootstrap confidence interval for Rank
+	RankCIHigh    int      `json:"rank_ci_high"`
+	TiedWith      []string `json:"tied_with,omitempty"` // Keys whose rank intervals overlap this one
+
 	Exposure   float64            `json:"exposure"`    // percentage of dataset compared against (0.0-1.0)
 	Rank       int                `json:"rank"`
 	Rounds     int                `json:"rounds"`              // number of rounds participated in
 	Relevance  *RelevanceProsCons `json:"relevance,omitempty"` // Only if relevance enabled
 	InputIndex int                `json:"input_index"` // Index in original input (0-based)
+	Source     string             `json:"source,omitempty"`     // File it was loaded from, relative to Config.SourceDir
+	Duplicates []Duplicate        `json:"duplicates,omitempty"` // Documents merged into this one (merge duplicate policy only)
 }
 
-type traceDocument struct {
-	ID    string  `json:"id"`
-	Value string  `json:"value"`
-	Score float64 `json:"score"`
+// TrialDocument is a document's standing in the ranking so far, as written to
+// the trace file and passed in trial events
+type TrialDocument struct {
+	ID            string   `json:"id"`
+	Value         string   `json:"value"`
+	Score         float64  `json:"score"`
+	ScoreVariance float64  `json:"score_variance"`
+	Observations  int      `json:"observations"`
+	RankCILow     int      `json:"rank_ci_low"`
+	RankCIHigh    int      `json:"rank_ci_high"`
+	TiedWith      []string `json:"tied_with,omitempty"` // Set in the last snapshot of a round only
 }
 
 type traceLine struct {
+	Criterion         string          `json:"criterion,omitempty"` // only in multi-criteria runs
 	Round             int             `json:"round"`
 	Trial             int             `json:"trial"`
 	TrialsCompleted   int             `json:"trials_completed"`
@@ -497,7 +1219,7 @@ type traceLine struct {
 	TotalOutputTokens int             `json:"total_output_tokens"`
 	ElbowPosition     *int            `json:"elbow_position,omitempty"`      // nil if not detected
 	StableTrialsCount int             `json:"stable_trials_count,omitempty"` // only if convergence enabled
-	Rankings          []traceDocument `json:"rankings"`
+	Rankings          []TrialDocument `json:"rankings"`
 }
 
 // modelPerfEvent is written to trace.jsonl when model comparison is enabled
@@ -521,6 +1243,25 @@ type modelPerfDetail struct {
 	TotalTokens int     `json:"total_tokens"`
 }
 
+// batchRNG returns a random source for one attempt at ranking a batch.
+// It is derived from the run seed and the attempt's position rather than
+// drawn from the shared rng, so concurrent workers stay reproducible.
+func (r *Ranker) batchRNG(trialNumber, batchNumber, attempt int) *rand.Rand {
+	return r.derivedRNG(int64(r.round), int64(trialNumber), int64(batchNumber), int64(attempt))
+}
+
+// derivedRNG returns a random source derived from the run seed and parts
+func (r *Ranker) derivedRNG(parts ...int64) *rand.Rand {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, v := range append([]int64{r.seed}, parts...) {
+		binary.BigEndian.PutUint64(buf[:], uint64(v)) // #nosec G115 - bit pattern only
+		h.Write(buf[:])
+	}
+	// #nosec G404 - Deterministic math/rand for ID assignment (not security-critical)
+	return rand.New(rand.NewSource(int64(h.Sum64()))) // #nosec G115 - overflow is acceptable for RNG seed
+}
+
 // createIDMappings generates memorable temporary IDs for a batch of documents
 func createIDMappings(documents []document, rng *rand.Rand, logger *slog.Logger) (map[string]string, map[string]string, error) {
 	originalToTemp := make(map[string]string)
@@ -584,8 +1325,14 @@ func translateIDsInResponse(response *rankedDocumentResponse, tempToOriginal map
 	}
 }
 
-// getResponseSchema returns the appropriate schema based on whether relevance is enabled
+// getResponseSchema returns the appropriate schema based on the mode and whether relevance is enabled
 func (r *Ranker) getResponseSchema() interface{} {
+	switch r.callMode {
+	case ModePairwise:
+		return generateSchema[pairwiseResponse]()
+	case ModePointwise:
+		return generateSchema[pointwiseResponse]()
+	}
 	// Use relevance schema when relevance is enabled AND we're past round 1
 	if r.cfg.Relevance && r.round > 1 {
 		return generateSchema[rankedDocumentResponseWithRelevance]()
@@ -616,14 +1363,19 @@ func ShortDeterministicID(input string, length int) string {
 // RankFromFile ranks documents loaded from a file.
 //
 // Parameters:
-//   - filePath: Path to input file (text or JSON)
+//   - filePath: Path to input file (text, JSON, JSON Lines, CSV or TSV)
 //   - templateData: Go template for formatting each item. For text files,
 //     use {{.Data}} to reference each line. For JSON, use field names like
-//     {{.title}}. Prefix with @ to load template from file (e.g., "@template.txt").
+//     {{.title}}, and for CSV or TSV the column names of the header row.
+//     Prefix with @ to load template from file (e.g., "@template.txt").
 //   - forceJSON: If true, parse as JSON regardless of file extension.
 //
+// The format comes from Config.InputFormat, or else the file extension
+// (.json, .jsonl or .ndjson, .csv, .tsv, anything else is text).
 // For text files, each non-empty line becomes a document.
-// For JSON files, expects an array of objects.
+// For JSON files, expects an array of objects; for JSON Lines, one value per
+// line. CSV and TSV rows become maps keyed by the header row, kept as the
+// result's Document.
 //
 // The inputFD parameter is an optional open file descriptor from validateInputPath().
 // If provided, it is used to get the validated file path via Name(). The FD ownership
@@ -632,6 +1384,20 @@ func ShortDeterministicID(input string, length int) string {
 // Returns ranked documents sorted by score (lower = better), or error if
 // ranking fails (e.g., LLM auth error, invalid input).
 func (r *Ranker) RankFromFile(filePath string, inputFD *os.File, templateData string, forceJSON bool) ([]*RankedDocument, error) {
+	return r.RankFromFileContext(context.Background(), filePath, inputFD, templateData, forceJSON)
+}
+
+// RankFromFileContext is like RankFromFile but stops when ctx is cancelled or
+// its deadline passes. It then returns the partial ranking built so far
+// together with a *CanceledError.
+func (r *Ranker) RankFromFileContext(ctx context.Context, filePath string, inputFD *os.File, templateData string, forceJSON bool) ([]*RankedDocument, error) {
+	result, err := r.RankFromFileResult(ctx, filePath, inputFD, templateData, forceJSON)
+	return result.documents(), err
+}
+
+// RankFromFileResult is like RankFromFileContext but returns the full
+// RankResult with usage totals, per-round stats and run metadata.
+func (r *Ranker) RankFromFileResult(ctx context.Context, filePath string, inputFD *os.File, templateData string, forceJSON bool) (*RankResult, error) {
 	// If file descriptor provided, use its path (already validated)
 	actualPath := filePath
 	if inputFD != nil {
@@ -643,35 +1409,84 @@ func (r *Ranker) RankFromFile(filePath string, inputFD *os.File, templateData st
 		return nil, err
 	}
 
-	// Open trace file if specified (only makes sense for file-based operation)
-	if r.cfg.TracePath != "" {
-		traceFile, err := os.Create(r.cfg.TracePath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create trace file: %w", err)
+	// Open trace file if specified
+	run := r.newRun()
+	return r.withTrace(run, func() (*RankResult, error) {
+		return run.rankDocuments(ctx, documents)
+	})
+}
+
+// withTrace runs fn, which ranks with run, with run's trace file open if
+// Config.TracePath is set. Every run gets a file of its own (see
+// Config.TracePath), so concurrent calls never interleave their lines.
+func (r *Ranker) withTrace(run *Ranker, fn func() (*RankResult, error)) (*RankResult, error) {
+	if r.cfg.TracePath == "" {
+		return fn()
+	}
+
+	r.mu.Lock()
+	r.traceRuns++
+	tracePath := numberedTracePath(r.cfg.TracePath, r.traceRuns)
+	r.mu.Unlock()
+
+	if err := run.openTraceFile(tracePath); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := run.traceFile.Close(); err != nil {
+			run.cfg.Logger.Warn("Failed to close trace file", "error", err)
 		}
-		r.traceFile = traceFile
-		defer func() {
-			if err := r.traceFile.Close(); err != nil {
-				r.cfg.Logger.Warn("Failed to close trace file", "error", err)
-			}
-		}()
+	}()
+	return fn()
+}
+
+// numberedTracePath returns the trace file of a Ranker's nth traced run:
+// path itself for the first, path with n before its extension for later ones
+func numberedTracePath(path string, n int) string {
+	if n == 1 {
+		return path
 	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
 
-	return r.rankDocuments(documents)
+// openTraceFile creates the trace file at path and writes its header line
+func (r *Ranker) openTraceFile(path string) error {
+	traceFile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create trace file: %w", err)
+	}
+	r.traceFile = traceFile
+
+	data, err := json.Marshal(traceHeader{EventType: "header", Seed: r.seed})
+	if err != nil {
+		return fmt.Errorf("failed to marshal trace header: %w", err)
+	}
+	if _, err := r.traceFile.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write trace header: %w", err)
+	}
+	return nil
 }
 
 // RankFromFiles ranks documents loaded from multiple files
 // All documents are aggregated in memory before ranking
 func (r *Ranker) RankFromFiles(filePaths []string, templateData string, forceJSON bool) ([]*RankedDocument, error) {
-	var allDocuments []document
+	return r.RankFromFilesContext(context.Background(), filePaths, templateData, forceJSON)
+}
 
-	// Load documents from each file
-	for _, filePath := range filePaths {
-		docs, err := r.loadDocumentsFromFile(filePath, templateData, forceJSON)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load %s: %w", filePath, err)
-		}
-		allDocuments = append(allDocuments, docs...)
+// RankFromFilesContext is like RankFromFiles but honors ctx cancellation
+// (see RankFromFileContext)
+func (r *Ranker) RankFromFilesContext(ctx context.Context, filePaths []string, templateData string, forceJSON bool) ([]*RankedDocument, error) {
+	result, err := r.RankFromFilesResult(ctx, filePaths, templateData, forceJSON)
+	return result.documents(), err
+}
+
+// RankFromFilesResult is like RankFromFilesContext but returns the full
+// RankResult (see RankFromFileResult)
+func (r *Ranker) RankFromFilesResult(ctx context.Context, filePaths []string, templateData string, forceJSON bool) (*RankResult, error) {
+	allDocuments, err := r.loadDocumentsFromFiles(filePaths, templateData, forceJSON)
+	if err != nil {
+		return nil, err
 	}
 
 	// Check document count limit to prevent memory exhaustion
@@ -683,22 +1498,12 @@ func (r *Ranker) RankFromFiles(filePaths []string, templateData string, forceJSO
 		return nil, fmt.Errorf("no documents loaded from %d files", len(filePaths))
 	}
 
-	// Set up trace file if needed (only once for all files)
-	if r.cfg.TracePath != "" {
-		traceFile, err := os.Create(r.cfg.TracePath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create trace file: %w", err)
-		}
-		r.traceFile = traceFile
-		defer func() {
-			if err := r.traceFile.Close(); err != nil {
-				r.cfg.Logger.Warn("Failed to close trace file", "error", err)
-			}
-		}()
-	}
-
-	// Rank all documents as a single batch
-	return r.rankDocuments(allDocuments)
+	// Set up trace file if needed (only once for all files), and rank all
+	// documents as a single batch
+	run := r.newRun()
+	return r.withTrace(run, func() (*RankResult, error) {
+		return run.rankDocuments(ctx, allDocuments)
+	})
 }
 
 // RankFromReader ranks documents read from an io.Reader.
@@ -706,33 +1511,102 @@ func (r *Ranker) RankFromFiles(filePaths []string, templateData string, forceJSO
 // Parameters:
 //   - reader: Source of input data
 //   - templateData: Go template for formatting each item (see RankFromFile)
-//   - isJSON: If true, parse as JSON array; if false, parse as text lines.
+//   - isJSON: If true, parse as JSON array; if false, parse as text lines
+//     (Config.InputFormat, if set, takes precedence).
 //
 // Returns ranked documents sorted by score (lower = better), or error if
 // ranking fails.
 func (r *Ranker) RankFromReader(reader io.Reader, templateData string, isJSON bool) ([]*RankedDocument, error) {
-	documents, err := r.loadDocumentsFromReader(reader, templateData, isJSON)
+	return r.RankFromReaderContext(context.Background(), reader, templateData, isJSON)
+}
+
+// RankFromReaderContext is like RankFromReader but honors ctx cancellation
+// (see RankFromFileContext)
+func (r *Ranker) RankFromReaderContext(ctx context.Context, reader io.Reader, templateData string, isJSON bool) ([]*RankedDocument, error) {
+	result, err := r.RankFromReaderResult(ctx, reader, templateData, isJSON)
+	return result.documents(), err
+}
+
+// RankFromReaderResult is like RankFromReaderContext but returns the full
+// RankResult (see RankFromFileResult)
+func (r *Ranker) RankFromReaderResult(ctx context.Context, reader io.Reader, templateData string, isJSON bool) (*RankResult, error) {
+	documents, err := r.loadDocumentsFromReader(reader, templateData, r.inputFormat(isJSON, FormatText))
 	if err != nil {
 		return nil, err
 	}
 
-	return r.rankDocuments(documents)
+	run := r.newRun()
+	return r.withTrace(run, func() (*RankResult, error) {
+		return run.rankDocuments(ctx, documents)
+	})
 }
 
-// rankDocuments performs the core ranking logic on a set of documents.
-func (r *Ranker) rankDocuments(documents []document) ([]*RankedDocument, error) {
-	// check that no document is too large
-	for _, doc := range documents {
-		tokens := r.estimateTokens([]document{doc}, true)
-		if tokens > r.cfg.BatchTokens {
-			return nil, fmt.Errorf("document is too large with %d tokens:\n%s", tokens, doc.Value)
+// watchForQuit returns a context canceled when the user quits the
+// visualization (q, Esc or Ctrl+C, which the screen captures as keys) or the
+// process is interrupted, so the run stops with its partial results and a
+// *CanceledError. Calling the returned function releases the handlers.
+func watchForQuit(ctx context.Context, screen tcell.Screen) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	// Keyboard event handler
+	go func() {
+		for {
+			switch ev := screen.PollEvent().(type) {
+			case nil:
+				return // Screen finalized
+			case *tcell.EventKey:
+				if ev.Key() == tcell.KeyCtrlC || ev.Key() == tcell.KeyEscape || ev.Rune() == 'q' {
+					cancel()
+					return
+				}
+			case *tcell.EventResize:
+				screen.Sync()
+			}
 		}
+	}()
+
+	// Signal handler
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sigChan)
+		select {
+		case <-sigChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// rankDocuments performs the core ranking logic on a set of documents.
+// If ctx ends early, the partial results are returned with a *CanceledError.
+func (r *Ranker) rankDocuments(ctx context.Context, documents []document) (*RankResult, error) {
+	startTime := time.Now()
+
+	// Size batches for the longest criterion prompt so every criterion shares them
+	if len(r.cfg.Criteria) > 0 {
+		r.criterion = longestCriterion(r.cfg.Criteria)
+	}
+
+	documents, err := r.prepareDocuments(documents)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.checkDocumentSizes(documents); err != nil {
+		return nil, err
 	}
 
 	if err := r.adjustBatchSize(documents); err != nil {
 		return nil, err
 	}
 
+	if r.cfg.MaxTokens > 0 || r.cfg.MaxCostUSD > 0 {
+		r.logBudgetEstimate(documents)
+	}
+
 	// Initialize terminal visualization if enabled
 	if r.cfg.Watch {
 		screen, err := tcell.NewScreen()
@@ -745,6 +1619,9 @@ func (r *Ranker) rankDocuments(documents []document) ([]*RankedDocument, error)
 				r.cfg.Watch = false // Disable watch mode
 			} else {
 				r.screen = screen
+				var stopWatching context.CancelFunc
+				ctx, stopWatching = watchForQuit(ctx, screen)
+				defer stopWatching()
 				defer func() {
 					if r.screen != nil {
 						if s, ok := r.screen.(tcell.Screen); ok {
@@ -752,43 +1629,13 @@ func (r *Ranker) rankDocuments(documents []document) ([]*RankedDocument, error)
 						}
 					}
 				}()
-
-				// Setup signal and keyboard event handlers
-				sigChan := make(chan os.Signal, 1)
-				signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-				// Keyboard event handler
-				go func() {
-					for {
-						ev := screen.PollEvent()
-						switch ev := ev.(type) {
-						case *tcell.EventKey:
-							if ev.Key() == tcell.KeyCtrlC || ev.Key() == tcell.KeyEscape || ev.Rune() == 'q' {
-								if s, ok := r.screen.(tcell.Screen); ok {
-									s.Fini()
-								}
-								os.Exit(0)
-							}
-						case *tcell.EventResize:
-							screen.Sync()
-						}
-					}
-				}()
-
-				// Signal handler
-				go func() {
-					<-sigChan
-					if s, ok := r.screen.(tcell.Screen); ok {
-						s.Fini()
-					}
-					os.Exit(0)
-				}()
 			}
 		}
 	}
 
 	// Initialize global comparison tracking for exposure calculation
 	r.comparedAgainst = make(map[string]map[string]bool)
+	r.orderings = nil
 
 	// Initialize relevance tracking if enabled
 	if r.cfg.Relevance {
@@ -804,13 +1651,34 @@ func (r *Ranker) rankDocuments(documents []document) ([]*RankedDocument, error)
 		}
 	}
 
-	results, err := r.rank(documents, 1)
-	if err != nil {
+	// Checkpoints only fit a run over the same documents and settings
+	if r.checkpointDir != "" {
+		r.fingerprint = r.checkpointFingerprint(documents)
+		if err := r.restoreCheckpoint(); err != nil {
+			return nil, err
+		}
+	}
+
+	var results []*RankedDocument
+	switch {
+	case len(r.cfg.Criteria) > 0:
+		r.callMode = ModeBatch
+		results, err = r.rankCriteria(ctx, documents)
+	case r.cfg.Mode == ModePairwise:
+		results, err = r.rankPairwise(ctx, documents)
+	case r.cfg.Mode == ModePointwise:
+		results, err = r.rankPointwise(ctx, documents)
+	default:
+		r.callMode = ModeBatch
+		results, err = r.rank(ctx, documents, 1)
+	}
+	var canceledErr *CanceledError
+	if err != nil && !errors.As(err, &canceledErr) {
 		return nil, err
 	}
 
-	// Summarize relevance if enabled
-	if r.cfg.Relevance {
+	// Summarize relevance if enabled (skipped for partial results)
+	if r.cfg.Relevance && canceledErr == nil && !r.isBudgetExceeded() {
 		r.cfg.Logger.Info("Summarizing relevance for all documents", "count", len(results))
 
 		// Parallelize summarization using goroutines
@@ -844,7 +1712,16 @@ func (r *Ranker) rankDocuments(documents []document) ([]*RankedDocument, error)
 						"of", len(results),
 						"snippets", len(job.snippets),
 						"worker", workerID)
-					summary, usage, err := r.summarizeRelevance(job.key, job.value, job.snippets)
+					projected := Usage{
+						InputTokens:  r.countTokens(strings.Join(job.snippets, "\n")) + r.countTokens(job.value),
+						OutputTokens: estimatedSummaryOutputTokens,
+					}
+					if !r.reserveBudget(projected) {
+						resultsChan <- summaryResult{index: job.index, err: errBudgetExceeded}
+						continue
+					}
+					summary, usage, err := r.summarizeRelevance(ctx, job.key, job.value, job.snippets)
+					r.releaseBudget(projected)
 					resultsChan <- summaryResult{index: job.index, summary: summary, usage: usage, err: err}
 				}
 			}(w)
@@ -868,56 +1745,329 @@ func (r *Ranker) rankDocuments(documents []document) ([]*RankedDocument, error)
 		}
 		close(jobs)
 
-		// Wait for workers to complete and collect results
-		go func() {
-			wg.Wait()
-			close(resultsChan)
-		}()
+		// Wait for workers to complete and collect results
+		go func() {
+			wg.Wait()
+			close(resultsChan)
+		}()
+
+		// Collect results and track usage
+		for result := range resultsChan {
+			// Track usage (even on error, some tokens may have been used)
+			r.mu.Lock()
+			r.totalUsage.Add(result.usage)
+			if result.usage.InputTokens > 0 || result.usage.OutputTokens > 0 {
+				r.totalCalls++
+			}
+			r.mu.Unlock()
+
+			if errors.Is(result.err, errBudgetExceeded) {
+				results[result.index].Relevance = nil
+			} else if result.err != nil {
+				r.cfg.Logger.Warn("Failed to summarize relevance", "document", result.index, "error", result.err)
+				results[result.index].Relevance = nil
+				r.emitError(Event{Key: results[result.index].Key, Usage: result.usage}, result.err)
+			} else {
+				results[result.index].Relevance = result.summary
+				r.emit(Event{
+					Type:      EventRelevanceSummarized,
+					Key:       results[result.index].Key,
+					Usage:     result.usage,
+					Relevance: result.summary,
+				})
+			}
+		}
+	}
+
+	// Drop documents graded below the threshold (documents left unscored by a
+	// pointwise pass cut short stay)
+	if r.cfg.MinScore > 0 {
+		kept := results[:0]
+		for _, result := range results {
+			if result.AbsoluteScore == 0 || result.AbsoluteScore >= r.cfg.MinScore {
+				kept = append(kept, result)
+			}
+		}
+		if dropped := len(results) - len(kept); dropped > 0 {
+			r.cfg.Logger.Info("Dropped documents below minimum score", "count", dropped, "min_score", r.cfg.MinScore)
+		}
+		results = kept
+	}
+
+	markTies(results)
+
+	// Calculate final exposure percentages across all rounds/trials
+	for i := range results {
+		// Add rank
+		results[i].Rank = i + 1
+
+		// Calculate exposure as percentage of original dataset
+		uniqueComparisons := float64(len(r.comparedAgainst[results[i].Key]))
+		totalPossible := float64(r.originalDocCount - 1) // Exclude self
+		if totalPossible > 0 {
+			results[i].Exposure = uniqueComparisons / totalPossible
+		} else {
+			results[i].Exposure = 1.0 // Edge case: single document
+		}
+	}
+
+	// Log final totals
+	logArgs := []any{
+		"num_rounds", r.totalRounds,
+		"num_trials", r.totalTrials,
+		"num_batches", r.totalBatches,
+		"num_calls", r.totalCalls,
+		"input_tokens", r.totalUsage.InputTokens,
+		"output_tokens", r.totalUsage.OutputTokens,
+		"seed", r.seed,
+	}
+	r.mu.Lock()
+	if r.cache != nil {
+		logArgs = append(logArgs, "cache_hits", r.cacheHits, "cache_misses", r.cacheMisses)
+	}
+	if _, cost, ok := r.spentLocked(); ok {
+		logArgs = append(logArgs, "cost_usd", cost)
+	}
+	if r.budgetExceeded {
+		logArgs = append(logArgs, "budget_exceeded", true)
+	}
+	r.mu.Unlock()
+	result := r.buildResult(results, startTime)
+	if canceledErr != nil {
+		r.cfg.Logger.Warn("Ranking canceled, returning partial results", append(logArgs, "error", canceledErr.Err)...)
+		return result, canceledErr
+	}
+	r.cfg.Logger.Info("Ranking completed", logArgs...)
+
+	return result, nil
+}
+
+// markTies groups documents whose rank intervals overlap
+func markTies(results []*RankedDocument) {
+	keys := make([]string, len(results))
+	lows := make([]int, len(results))
+	highs := make([]int, len(results))
+	for i, result := range results {
+		keys[i], lows[i], highs[i] = result.Key, result.RankCILow, result.RankCIHigh
+	}
+	for i, tied := range tiedWith(keys, lows, highs) {
+		results[i].TiedWith = tied
+	}
+}
+
+// buildResult assembles the RankResult for a finished (or canceled) run
+func (r *Ranker) buildResult(results []*RankedDocument, startTime time.Time) *RankResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, doc := range results {
+		if merged, ok := r.duplicates[doc.Key]; ok {
+			doc.Duplicates = append(doc.Duplicates, merged...)
+		}
+		if source, ok := r.sources[doc.Key]; ok {
+			doc.Source = source
+		}
+	}
+
+	result := &RankResult{
+		Documents:  results,
+		Rounds:     r.roundStats,
+		Usage:      r.totalUsage,
+		NumCalls:   r.totalCalls,
+		NumBatches: r.totalBatches,
+		NumTrials:  r.totalTrials,
+		Seed:       r.seed,
+		StartedAt:  startTime,
+		WallTimeMs: time.Since(startTime).Milliseconds(),
+	}
+	if _, cost, ok := r.spentLocked(); ok {
+		result.CostUSD = &cost
+	}
+	result.BudgetExceeded = r.budgetExceeded
+	for model := range r.modelsUsed {
+		result.Models = append(result.Models, model)
+	}
+	sort.Strings(result.Models)
+
+	return result
+}
+
+// documents returns the ranked documents of a possibly nil result
+func (rr *RankResult) documents() []*RankedDocument {
+	if rr == nil {
+		return nil
+	}
+	return rr.Documents
+}
+
+// recordCall notes the model and spend of a completed call for RankResult
+// and budget checks, and whether the response cache served it. Cached
+// responses cost nothing and are not counted as spend.
+func (r *Ranker) recordCall(opts *CompletionOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cache != nil {
+		if opts.Cached {
+			r.cacheHits++
+		} else {
+			r.cacheMisses++
+		}
+	}
+
+	if opts.ModelUsed != "" {
+		if r.modelsUsed == nil {
+			r.modelsUsed = make(map[string]bool)
+		}
+		r.modelsUsed[opts.ModelUsed] = true
+	}
+
+	if !opts.Cached {
+		if r.usageByModel == nil {
+			r.usageByModel = make(map[string]Usage)
+		}
+		usage := r.usageByModel[opts.ModelUsed]
+		usage.Add(opts.Usage)
+		r.usageByModel[opts.ModelUsed] = usage
+	}
+}
+
+// spentLocked returns the usage and cost of every call so far. ok is false
+// if some usage could not be priced. Caller must hold r.mu.
+func (r *Ranker) spentLocked() (spent Usage, cost float64, ok bool) {
+	ok = true
+	for model, usage := range r.usageByModel {
+		spent.Add(usage)
+
+		pricing := r.cfg.Pricing
+		if pricing == nil {
+			if p, found := r.pricingTable.Lookup(model); found && model != "" {
+				pricing = &p
+			} else {
+				pricing = r.pricing
+			}
+		}
+		if pricing == nil {
+			ok = false
+			continue
+		}
+		cost += pricing.Cost(usage)
+	}
+	return spent, cost, ok
+}
+
+// reserveBudget reserves the projected usage of a call. It returns false, and
+// marks the run as budget-truncated, if the call would exceed MaxTokens or
+// MaxCostUSD; the caller must then skip the call.
+func (r *Ranker) reserveBudget(projected Usage) bool {
+	if !r.hasBudget() {
+		return true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.budgetExceeded {
+		return false
+	}
+
+	pending := r.reservedUsage
+	pending.Add(projected)
+	spent, cost, _ := r.spentLocked()
+
+	overTokens := r.cfg.MaxTokens > 0 && spent.TotalTokens()+pending.TotalTokens() > r.cfg.MaxTokens
+	overCost := r.cfg.MaxCostUSD > 0 && cost+r.pricing.Cost(pending) > r.cfg.MaxCostUSD
+	if overTokens || overCost {
+		r.budgetExceeded = true
+		r.cfg.Logger.Warn("Budget reached, no further LLM calls will be scheduled",
+			"round", r.round,
+			"tokens_used", spent.TotalTokens(),
+			"max_tokens", r.cfg.MaxTokens,
+			"cost_usd", cost,
+			"max_cost_usd", r.cfg.MaxCostUSD)
+		return false
+	}
+
+	r.reservedUsage = pending
+	return true
+}
+
+// releaseBudget drops a reservation made by reserveBudget once the call is done
+func (r *Ranker) releaseBudget(projected Usage) {
+	if !r.hasBudget() {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reservedUsage.InputTokens -= projected.InputTokens
+	r.reservedUsage.OutputTokens -= projected.OutputTokens
+	r.reservedUsage.ReasoningTokens -= projected.ReasoningTokens
+}
+
+// hasBudget reports whether MaxTokens or MaxCostUSD limits the run
+func (r *Ranker) hasBudget() bool {
+	return r.cfg.MaxTokens > 0 || r.cfg.MaxCostUSD > 0
+}
 
-		// Collect results and track usage
-		for result := range resultsChan {
-			// Track usage (even on error, some tokens may have been used)
-			r.mu.Lock()
-			r.totalUsage.Add(result.usage)
-			if result.usage.InputTokens > 0 || result.usage.OutputTokens > 0 {
-				r.totalCalls++
-			}
-			r.mu.Unlock()
+// isBudgetExceeded reports whether a budget stopped scheduling work
+func (r *Ranker) isBudgetExceeded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.budgetExceeded
+}
 
-			if result.err != nil {
-				r.cfg.Logger.Warn("Failed to summarize relevance", "document", result.index, "error", result.err)
-				results[result.index].Relevance = nil
-			} else {
-				results[result.index].Relevance = result.summary
-			}
-		}
+// projectBatchUsage estimates the usage of one ranking call for a batch
+func (r *Ranker) projectBatchUsage(batch []document) Usage {
+	return Usage{
+		InputTokens:  r.estimateTokens(batch, true),
+		OutputTokens: len(batch) * outputTokensPerDoc(r.cfg.Relevance, r.round),
 	}
+}
 
-	// Calculate final exposure percentages across all rounds/trials
-	for i := range results {
-		// Add rank
-		results[i].Rank = i + 1
+// projectCallUsage estimates the usage of a ranking call with the given
+// prompt, which includes any retry feedback, for a batch of numDocs
+func (r *Ranker) projectCallUsage(prompt string, numDocs int) Usage {
+	return Usage{
+		InputTokens:  r.countTokens(prompt),
+		OutputTokens: numDocs * outputTokensPerDoc(r.cfg.Relevance, r.round),
+	}
+}
 
-		// Calculate exposure as percentage of original dataset
-		uniqueComparisons := float64(len(r.comparedAgainst[results[i].Key]))
-		totalPossible := float64(r.originalDocCount - 1) // Exclude self
-		if totalPossible > 0 {
-			results[i].Exposure = uniqueComparisons / totalPossible
-		} else {
-			results[i].Exposure = 1.0 // Edge case: single document
-		}
+// outputTokensPerDoc is the projected response size per document in a round
+func outputTokensPerDoc(relevance bool, round int) int {
+	if relevance && round > 1 {
+		return estimatedOutputTokensPerDoc + estimatedRelevanceTokensPerDoc
 	}
+	return estimatedOutputTokensPerDoc
+}
 
-	// Log final totals
-	r.cfg.Logger.Info("Ranking completed",
-		"num_rounds", r.totalRounds,
-		"num_trials", r.totalTrials,
-		"num_batches", r.totalBatches,
-		"num_calls", r.totalCalls,
-		"input_tokens", r.totalUsage.InputTokens,
-		"output_tokens", r.totalUsage.OutputTokens)
+// checkDocumentSizes rejects any document too large to fit a batch on its own
+func (r *Ranker) checkDocumentSizes(documents []document) error {
+	for _, doc := range documents {
+		tokens := r.estimateTokens([]document{doc}, true)
+		if tokens > r.cfg.BatchTokens {
+			return fmt.Errorf("document is too large with %d tokens:\n%s", tokens, doc.Value)
+		}
+	}
+	return nil
+}
 
-	return results, nil
+// loadDocumentsFromFiles loads the documents of each file in turn. Input
+// indexes run on from one file to the next, so they are distinct across files.
+func (r *Ranker) loadDocumentsFromFiles(filePaths []string, templateData string, forceJSON bool) ([]document, error) {
+	var allDocuments []document
+	for _, filePath := range filePaths {
+		docs, err := r.loadDocumentsFromFile(filePath, templateData, forceJSON)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", filePath, err)
+		}
+		for i := range docs {
+			docs[i].InputIndex += len(allDocuments)
+		}
+		allDocuments = append(allDocuments, docs...)
+	}
+	return allDocuments, nil
 }
 
 func (r *Ranker) loadDocumentsFromFile(filePath string, templateData string, forceJSON bool) ([]document, error) {
@@ -933,31 +2083,87 @@ func (r *Ranker) loadDocumentsFromFile(filePath string, templateData string, for
 	}
 	defer file.Close()
 
-	ext := strings.ToLower(filepath.Ext(validPath))
-	isJSON := ext == ".json" || forceJSON
+	var documents []document
+	if r.cfg.WholeFile {
+		tmpl, err := parseItemTemplate(templateData)
+		if err != nil {
+			return nil, err
+		}
+		documents, err = r.loadWholeFileDocument(file, filePath, tmpl)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		documents, err = r.loadDocumentsFromReader(file, templateData, r.inputFormat(forceJSON, formatForPath(validPath)))
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	return r.loadDocumentsFromReader(file, templateData, isJSON)
+	if r.cfg.SourceDir != "" {
+		source := sourcePath(r.cfg.SourceDir, filePath)
+		for i := range documents {
+			documents[i].source = source
+		}
+	}
+	return documents, nil
 }
 
-func (r *Ranker) loadDocumentsFromReader(reader io.Reader, templateData string, isJSON bool) ([]document, error) {
-	// Template parsing
-	var tmpl *template.Template
-	if templateData != "" {
-		if templateData[0] == '@' {
-			content, err := os.ReadFile(templateData[1:])
-			if err != nil {
-				return nil, fmt.Errorf("failed to read template file %s: %w", templateData[1:], err)
-			}
-			templateData = string(content)
-		}
-		var err error
-		if tmpl, err = template.New("siftrank-item-template").Parse(templateData); err != nil {
-			return nil, fmt.Errorf("failed to parse template: %w", err)
+// sourcePath returns filePath relative to dir, with '/' separators, or as
+// given if it is not under dir
+func sourcePath(dir, filePath string) string {
+	absDir, dirErr := filepath.Abs(dir)
+	absPath, pathErr := filepath.Abs(filePath)
+	if dirErr != nil || pathErr != nil {
+		return filePath
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filePath
+	}
+	return filepath.ToSlash(rel)
+}
+
+// parseItemTemplate parses the per-document template, reading it from a file
+// if it starts with '@'. An empty template returns nil.
+func parseItemTemplate(templateData string) (*template.Template, error) {
+	if templateData == "" {
+		return nil, nil
+	}
+	if templateData[0] == '@' {
+		content, err := os.ReadFile(templateData[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template file %s: %w", templateData[1:], err)
 		}
+		templateData = string(content)
+	}
+	tmpl, err := template.New("siftrank-item-template").Parse(templateData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return tmpl, nil
+}
+
+func (r *Ranker) loadDocumentsFromReader(reader io.Reader, templateData string, format InputFormat) ([]document, error) {
+	tmpl, err := parseItemTemplate(templateData)
+	if err != nil {
+		return nil, err
+	}
+
+	if tmpl == nil && format != FormatText {
+		r.cfg.Logger.Warn("using structured input without a template, using each document as JSON")
 	}
 
-	if isJSON {
+	switch format {
+	case FormatJSON:
 		return r.loadJSONDocuments(reader, tmpl)
+	case FormatJSONL:
+		return r.loadJSONLDocuments(reader, tmpl)
+	case FormatCSV, FormatTSV:
+		return r.loadDelimitedDocuments(reader, tmpl, format)
+	}
+	if r.cfg.RecordSeparator != "" {
+		return r.loadRecordDocuments(reader, tmpl)
 	}
 	return r.loadTextDocuments(reader, tmpl)
 }
@@ -977,9 +2183,10 @@ func (r *Ranker) loadTextDocuments(reader io.Reader, tmpl *template.Template) ([
 			continue // Skip empty lines
 		}
 
+		fields := map[string]string{"Data": line}
 		if tmpl != nil {
 			var tmplData bytes.Buffer
-			if err := tmpl.Execute(&tmplData, map[string]string{"Data": line}); err != nil {
+			if err := tmpl.Execute(&tmplData, fields); err != nil {
 				return nil, fmt.Errorf("failed to execute template on line: %w", err)
 			}
 			line = tmplData.String()
@@ -991,6 +2198,7 @@ func (r *Ranker) loadTextDocuments(reader io.Reader, tmpl *template.Template) ([
 			Document:   nil,
 			Value:      line,
 			InputIndex: i,
+			fields:     fields,
 		})
 	}
 
@@ -1005,20 +2213,9 @@ func (r *Ranker) loadJSONDocuments(reader io.Reader, tmpl *template.Template) ([
 
 	var documents []document
 	for i, value := range data {
-		var valueStr string
-		if tmpl != nil {
-			var tmplData bytes.Buffer
-			if err := tmpl.Execute(&tmplData, value); err != nil {
-				return nil, fmt.Errorf("failed to execute template: %w", err)
-			}
-			valueStr = tmplData.String()
-		} else {
-			r.cfg.Logger.Warn("using json input without a template, using JSON document as-is")
-			jsonValue, err := json.Marshal(value)
-			if err != nil {
-				return nil, fmt.Errorf("failed to marshal JSON value: %w", err)
-			}
-			valueStr = string(jsonValue)
+		valueStr, err := structuredValue(value, tmpl)
+		if err != nil {
+			return nil, err
 		}
 
 		id := ShortDeterministicID(valueStr, idLen)
@@ -1027,6 +2224,7 @@ func (r *Ranker) loadJSONDocuments(reader io.Reader, tmpl *template.Template) ([
 			Document:   value,
 			Value:      valueStr,
 			InputIndex: i,
+			fields:     value,
 		})
 	}
 
@@ -1034,7 +2232,7 @@ func (r *Ranker) loadJSONDocuments(reader io.Reader, tmpl *template.Template) ([
 }
 
 // perform the ranking algorithm on the given documents
-func (r *Ranker) rank(documents []document, round int) ([]*RankedDocument, error) {
+func (r *Ranker) rank(ctx context.Context, documents []document, round int) ([]*RankedDocument, error) {
 	r.round = round
 
 	// Track original document count for exposure calculation
@@ -1043,6 +2241,7 @@ func (r *Ranker) rank(documents []document, round int) ([]*RankedDocument, error
 	}
 
 	r.cfg.Logger.Info("Ranking documents", "round", r.round, "count", len(documents))
+	r.emit(Event{Type: EventRoundStarted, Documents: len(documents)})
 
 	// If we've narrowed down to a single document, we're done.
 	if len(documents) == 1 {
@@ -1055,6 +2254,8 @@ func (r *Ranker) rank(documents []document, round int) ([]*RankedDocument, error
 				Exposure:   1.0, // 100% exposure (single document)
 				Rounds:     round,
 				InputIndex: documents[0].InputIndex,
+				RankCILow:  1,
+				RankCIHigh: 1,
 			},
 		}, nil
 	}
@@ -1067,12 +2268,27 @@ func (r *Ranker) rank(documents []document, round int) ([]*RankedDocument, error
 
 	r.numBatches = len(documents) / r.cfg.BatchSize
 
-	// Process the documents and get the sorted results.
-	results, err := r.shuffleBatchRank(documents)
+	// Process the documents and get the sorted results, unless a resumed
+	// checkpoint finished this round
+	var err error
+	results := r.resumedRound(round)
+	if results == nil {
+		results, err = r.shuffleBatchRank(ctx, documents)
+	}
 	if err != nil {
+		// Partial results from a canceled round are final, no refinement
+		var canceledErr *CanceledError
+		if errors.As(err, &canceledErr) {
+			return results, err
+		}
 		return nil, err
 	}
 
+	// Out of budget: this round's ranking is the best we can afford
+	if r.isBudgetExceeded() {
+		return results, nil
+	}
+
 	// Determine cutoff for refinement
 	var mid int
 
@@ -1129,11 +2345,18 @@ func (r *Ranker) rank(documents []document, round int) ([]*RankedDocument, error
 		topPortionDocs = append(topPortionDocs, document{ID: result.Key, Value: result.Value, Document: result.Document, InputIndex: result.InputIndex})
 	}
 
-	refinedTopPortion, err := r.rank(topPortionDocs, round+1)
-	if err != nil {
+	refinedTopPortion, err := r.rank(ctx, topPortionDocs, round+1)
+	var canceledErr *CanceledError
+	if err != nil && !errors.As(err, &canceledErr) {
 		return nil, err
 	}
 
+	// A refinement canceled or out of budget before scoring every document
+	// keeps this round's order for the top portion
+	if len(refinedTopPortion) < len(topPortion) {
+		return results, err
+	}
+
 	// Adjust scores by recursion depth; this serves as an inverted weight so
 	// that later rounds are guaranteed to sit higher in the final list.
 	for i := range refinedTopPortion {
@@ -1143,10 +2366,10 @@ func (r *Ranker) rank(documents []document, round int) ([]*RankedDocument, error
 	// Combine the refined top portion with the unrefined bottom portion.
 	finalResults := append(refinedTopPortion, bottomPortion...)
 
-	return finalResults, nil
+	return finalResults, err
 }
 
-func (r *Ranker) summarizeRelevance(docID string, docValue string, snippets []string) (*RelevanceProsCons, Usage, error) {
+func (r *Ranker) summarizeRelevance(ctx context.Context, docID string, docValue string, snippets []string) (*RelevanceProsCons, Usage, error) {
 	// Skip if no snippets or dry run mode
 	if len(snippets) == 0 || r.cfg.DryRun {
 		return nil, Usage{}, nil
@@ -1189,7 +2412,7 @@ Example: {"pros": "Strong connection to X. References Y explicitly.", "cons": "L
 	schema := generateSchema[RelevanceProsCons]()
 
 	// Call provider with options
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	opts := &CompletionOptions{
@@ -1197,6 +2420,7 @@ Example: {"pros": "Strong connection to X. References Y explicitly.", "cons": "L
 	}
 
 	rawResponse, err := r.provider.Complete(ctx, prompt, opts)
+	r.recordCall(opts)
 	if err != nil {
 		return nil, opts.Usage, fmt.Errorf("provider call failed: %w", err)
 	}
@@ -1275,14 +2499,19 @@ func (r *Ranker) recordModelPerformance(round int, trial int) error {
 	return nil
 }
 
-func (r *Ranker) recordTrialState(trialNum int, trialsCompleted int, scores map[string][]float64, documents []document) error {
-	// Early exit if neither feature is enabled
-	if r.traceFile == nil && !r.cfg.Watch {
-		return nil
+// recordTrialState emits a trial completed event with the ranking built from
+// the scores of the completed trials. Ties are only grouped in the last
+// snapshot of a round (lastTrial), since earlier ones are superseded by the
+// next trial.
+func (r *Ranker) recordTrialState(trialNum int, trialsCompleted int, scores map[string][]float64, documents []document, lastTrial bool) {
+	// Nobody to tell
+	if !r.hasSubscribers() {
+		return
 	}
 
 	// Calculate current rankings from accumulated scores
-	var rankings []traceDocument
+	uncertainty := scoreUncertainty(scores, r.bootstrapRNG(trialsCompleted))
+	var rankings []TrialDocument
 	for id, scoreList := range scores {
 		var sum float64
 		for _, score := range scoreList {
@@ -1299,70 +2528,59 @@ func (r *Ranker) recordTrialState(trialNum int, trialsCompleted int, scores map[
 			}
 		}
 
-		rankings = append(rankings, traceDocument{
-			ID:    id,
-			Value: value,
-			Score: avgScore,
+		rankings = append(rankings, TrialDocument{
+			ID:            id,
+			Value:         value,
+			Score:         avgScore,
+			ScoreVariance: uncertainty[id].variance,
+			Observations:  uncertainty[id].observations,
+			RankCILow:     uncertainty[id].rankLow,
+			RankCIHigh:    uncertainty[id].rankHigh,
 		})
 	}
 
-	// Sort by score (lower is better)
+	// Sort by score (lower is better), ties by ID for a stable order
 	sort.Slice(rankings, func(i, j int) bool {
-		return rankings[i].Score < rankings[j].Score
+		if rankings[i].Score != rankings[j].Score {
+			return rankings[i].Score < rankings[j].Score
+		}
+		return rankings[i].ID < rankings[j].ID
 	})
 
-	// Build trace line
-	trace := traceLine{
-		Round:             r.round,
-		Trial:             trialNum,
-		TrialsCompleted:   trialsCompleted,
-		TrialsRemaining:   r.cfg.NumTrials - trialsCompleted,
-		TotalInputTokens:  r.totalUsage.InputTokens,
-		TotalOutputTokens: r.totalUsage.OutputTokens,
-		Rankings:          rankings,
-	}
-
-	// Add convergence info if enabled
-	if r.cfg.EnableConvergence {
-		r.mu.Lock()
-		if len(r.elbowPositions) > 0 {
-			lastElbow := r.elbowPositions[len(r.elbowPositions)-1]
-			if lastElbow >= 0 {
-				trace.ElbowPosition = &lastElbow
-			}
-
-			// Calculate stability count using shared logic
-			stableCount, _ := r.countStableElbows(len(rankings))
-			if stableCount > 0 {
-				trace.StableTrialsCount = stableCount
-			}
+	if lastTrial {
+		keys := make([]string, len(rankings))
+		lows := make([]int, len(rankings))
+		highs := make([]int, len(rankings))
+		for i, doc := range rankings {
+			keys[i], lows[i], highs[i] = doc.ID, doc.RankCILow, doc.RankCIHigh
 		}
-		r.mu.Unlock()
-	}
-
-	// File writing - only if trace enabled
-	if r.traceFile != nil {
-		data, err := json.Marshal(trace)
-		if err != nil {
-			return fmt.Errorf("failed to marshal trace line: %w", err)
+		for i, tied := range tiedWith(keys, lows, highs) {
+			rankings[i].TiedWith = tied
 		}
+	}
 
-		if _, err := r.traceFile.Write(append(data, '\n')); err != nil {
-			return fmt.Errorf("failed to write trace line: %w", err)
-		}
+	r.mu.Lock()
+	event := Event{
+		Type:            EventTrialCompleted,
+		Trial:           trialNum,
+		TrialsCompleted: trialsCompleted,
+		Usage:           r.totalUsage,
+		Ranking:         rankings,
+	}
 
-		// Flush to disk immediately
-		if err := r.traceFile.Sync(); err != nil {
-			return fmt.Errorf("failed to sync trace file: %w", err)
+	// Add convergence info if enabled
+	if r.cfg.EnableConvergence && len(r.elbowPositions) > 0 {
+		lastElbow := r.elbowPositions[len(r.elbowPositions)-1]
+		if lastElbow >= 0 {
+			event.ElbowPosition = &lastElbow
 		}
-	}
 
-	// Visualization - only if watch enabled
-	if r.cfg.Watch && r.screen != nil {
-		r.renderVisualization(rankings, r.round, trialNum)
+		// Calculate stability count using shared logic
+		event.StableTrials, _ = r.countStableElbows(len(rankings))
 	}
+	r.mu.Unlock()
 
-	return nil
+	r.emit(event)
 }
 
 // writeString writes a string to the screen at the given position with the given style
@@ -1373,7 +2591,7 @@ func (r *Ranker) writeString(screen tcell.Screen, x, y int, s string, style tcel
 }
 
 // renderVisualization routes to the appropriate rendering function based on configuration
-func (r *Ranker) renderVisualization(rankings []traceDocument, round, trial int) {
+func (r *Ranker) renderVisualization(rankings []TrialDocument, round, trial int) {
 	if r.screen == nil {
 		return
 	}
@@ -1392,7 +2610,7 @@ func (r *Ranker) renderVisualization(rankings []traceDocument, round, trial int)
 }
 
 // renderFullWidth renders the visualization using the full terminal width
-func (r *Ranker) renderFullWidth(screen tcell.Screen, rankings []traceDocument, round, trial int) {
+func (r *Ranker) renderFullWidth(screen tcell.Screen, rankings []TrialDocument, round, trial int) {
 	screen.Clear()
 	width, height := screen.Size()
 
@@ -1403,7 +2621,7 @@ func (r *Ranker) renderFullWidth(screen tcell.Screen, rankings []traceDocument,
 }
 
 // renderWithMinimap renders a split-screen view with main display and minimap
-func (r *Ranker) renderWithMinimap(screen tcell.Screen, rankings []traceDocument, round, trial int) {
+func (r *Ranker) renderWithMinimap(screen tcell.Screen, rankings []TrialDocument, round, trial int) {
 	screen.Clear()
 	width, height := screen.Size()
 
@@ -1436,7 +2654,7 @@ func (r *Ranker) renderWithMinimap(screen tcell.Screen, rankings []traceDocument
 }
 
 // renderMinimap renders a condensed overview of all rankings
-func (r *Ranker) renderMinimap(screen tcell.Screen, rankings []traceDocument, round, startX, width, height int) {
+func (r *Ranker) renderMinimap(screen tcell.Screen, rankings []TrialDocument, round, startX, width, height int) {
 	if width < 5 {
 		return // Not enough space
 	}
@@ -1532,7 +2750,7 @@ func (r *Ranker) renderMinimap(screen tcell.Screen, rankings []traceDocument, ro
 }
 
 // renderMainDisplay renders the main detailed ranking display
-func (r *Ranker) renderMainDisplay(screen tcell.Screen, rankings []traceDocument, round, trial int, startX, maxWidth, maxHeight int) {
+func (r *Ranker) renderMainDisplay(screen tcell.Screen, rankings []TrialDocument, round, trial int, startX, maxWidth, maxHeight int) {
 	// Help text
 	help := "Press Ctrl+C, Esc, or 'q' to quit"
 	r.writeString(screen, startX, 0, help, tcell.StyleDefault.Foreground(tcell.ColorDarkGray))
@@ -1600,10 +2818,62 @@ func (r *Ranker) logFromApiCall(trialNum, batchNum int, message string, args ...
 	r.cfg.Logger.Debug(formattedMessage, "round", r.round, "trial", trialNum, "total_trials", r.cfg.NumTrials, "batch", batchNum, "total_batches", r.numBatches)
 }
 
-func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, error) {
+// trialStats totals the completed batches of one trial
+type trialStats struct {
+	NumBatches int   `json:"num_batches"`
+	NumCalls   int   `json:"num_calls"`
+	Usage      Usage `json:"usage"`
+}
+
+// batchOutcome is the result of one batch ranked by rankBatches
+type batchOutcome struct {
+	rankedDocs []rankedDocument
+	numCalls   int
+	usage      Usage
+	err        error
+}
+
+// rankBatches ranks the batches of one trial concurrently, within the global
+// concurrency limit. Batches that would exceed the budget fail with
+// errBudgetExceeded.
+func (r *Ranker) rankBatches(ctx context.Context, batches [][]document, trialNumber int) []batchOutcome {
+	outcomes := make([]batchOutcome, len(batches))
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			projected := r.projectBatchUsage(batch)
+			if !r.reserveBudget(projected) {
+				outcomes[i].err = errBudgetExceeded
+				return
+			}
+
+			r.semaphore <- struct{}{}
+			rankedDocs, numCalls, usage, err := r.rankDocs(ctx, batch, trialNumber, i+1)
+			<-r.semaphore
+			r.releaseBudget(projected)
+
+			outcomes[i] = batchOutcome{rankedDocs: rankedDocs, numCalls: numCalls, usage: usage, err: err}
+
+			event := Event{Type: EventBatchCompleted, Trial: trialNumber, Batch: i + 1, Calls: numCalls, Usage: usage}
+			if err != nil {
+				r.emitError(event, err)
+				return
+			}
+			r.emit(event)
+		}()
+	}
+	wg.Wait()
+	return outcomes
+}
+
+func (r *Ranker) shuffleBatchRank(parentCtx context.Context, documents []document) ([]*RankedDocument, error) {
 	// Reset convergence state for this recursion level (round)
 	r.mu.Lock()
 	r.converged = false
+	r.convergenceReason = ""
 	r.elbowPositions = nil // Also clear elbow history
 	r.rankingOrders = nil  // Clear ranking order history
 	r.elbowCutoff = -1     // Reset cutoff
@@ -1634,7 +2904,7 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 	}
 
 	// Create cancellable context for early stopping
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(parentCtx)
 	defer cancel() // Ensure cleanup
 
 	// Channel for work items (sized for all batches across all trials)
@@ -1645,8 +2915,54 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 
 	var firstTrialRemainderItems []document
 
+	// Track trial completion and stats
+	completedBatches := make(map[int]int)      // trialNum -> count of completed batches
+	completedTrials := make(map[int]bool)      // trialNum -> true if all batches completed
+	trialStatsMap := make(map[int]*trialStats) // trial number -> stats
+
+	// A resumed round starts from the trials its checkpoint completed
+	progress := r.resumedProgress(r.round)
+	if progress != nil {
+		for _, trialNum := range progress.Completed {
+			completedTrials[trialNum] = true
+			trialStatsMap[trialNum] = progress.TrialStats[trialNum]
+			trialScores[trialNum] = progress.TrialScores[trialNum]
+			for id, list := range progress.TrialScores[trialNum] {
+				scores[id] = append(scores[id], list...)
+			}
+		}
+		r.mu.Lock()
+		r.elbowPositions = progress.ElbowPositions
+		r.rankingOrders = progress.RankingOrders
+		r.converged = progress.Converged
+		r.convergenceReason = progress.ConvergenceReason
+		r.mu.Unlock()
+	}
+
+	// Adaptive batching queues only the warm-up trials here and builds each
+	// later trial from the results so far
+	adaptive := r.cfg.BatchSelection == BatchSelectionAdaptive && r.composeTrial == nil
+	upfrontTrials := r.cfg.NumTrials
+	if adaptive {
+		upfrontTrials = min(r.cfg.AdaptiveWarmupTrials, r.cfg.NumTrials)
+	}
+	trialBatches := make(map[int]int) // trial number -> batches queued
+
 	// Load work queue depth-first (all of trial 1, then all of trial 2, etc.)
-	for trialNum := 1; trialNum <= r.cfg.NumTrials; trialNum++ {
+	for trialNum := 1; trialNum <= upfrontTrials; trialNum++ {
+		// A batch composer builds constrained trials of its own
+		if r.composeTrial != nil {
+			batches := r.composeTrial(trialNum)
+			if completedTrials[trialNum] {
+				continue
+			}
+			for i, batch := range batches {
+				workQueue <- workItem{trialNum: trialNum, batchNum: i + 1, batch: batch}
+			}
+			trialBatches[trialNum] = len(batches)
+			continue
+		}
+
 		// Shuffle documents for this trial
 		shuffledDocs := make([]document, len(documents))
 		copy(shuffledDocs, documents)
@@ -1693,6 +3009,11 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 			}
 		}
 
+		// Trials completed before a resume keep their results
+		if completedTrials[trialNum] {
+			continue
+		}
+
 		// Queue all batches for this trial
 		for batchNum := 0; batchNum < r.numBatches; batchNum++ {
 			batch := shuffledDocs[batchNum*r.cfg.BatchSize : (batchNum+1)*r.cfg.BatchSize]
@@ -1702,8 +3023,37 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 				batch:    batch,
 			}
 		}
+		trialBatches[trialNum] = r.numBatches
+	}
+
+	// The queue closes once no more work will be added
+	var queueMu sync.Mutex
+	queueClosed := false
+	closeQueue := func() {
+		queueMu.Lock()
+		defer queueMu.Unlock()
+		if !queueClosed {
+			queueClosed = true
+			close(workQueue)
+		}
+	}
+	outstanding := 0 // Batches queued but not yet collected
+	for _, n := range trialBatches {
+		outstanding += n
+	}
+	nextTrial := upfrontTrials + 1
+	for trialNum := range completedTrials {
+		nextTrial = max(nextTrial, trialNum+1)
+	}
+	if adaptive {
+		// Release idle workers when the round stops early
+		go func() {
+			<-ctx.Done()
+			closeQueue()
+		}()
+	} else {
+		closeQueue()
 	}
-	close(workQueue) // No more work will be added
 
 	// Launch worker pool
 	var workersWg sync.WaitGroup
@@ -1732,6 +3082,12 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 				// Release semaphore
 				<-r.semaphore
 
+				// Stop scheduling work once the budget would be exceeded
+				if errors.Is(err, errBudgetExceeded) {
+					cancel()
+					continue
+				}
+
 				// Send result
 				resultsChan <- batchResult{
 					rankedDocs:  rankedBatch,
@@ -1751,33 +3107,78 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 		close(resultsChan)
 	}()
 
-	// Track trial completion and stats
-	completedBatches := make(map[int]int) // trialNum -> count of completed batches
-	completedTrials := make(map[int]bool) // trialNum -> true if all batches completed
+	// Track fatal errors that should propagate to callers
+	var fatalErr error
+
+	// queueAdaptiveTrial builds the next adaptive trial once every queued
+	// batch has been collected, or closes the queue when the round is done
+	queueAdaptiveTrial := func() {
+		if !adaptive || outstanding > 0 || ctx.Err() != nil {
+			return
+		}
+		if fatalErr != nil || nextTrial > r.cfg.NumTrials {
+			closeQueue()
+			return
+		}
+
+		batches := r.adaptiveBatches(documents, scores, nextTrial)
+		if len(batches) == 0 {
+			r.mu.Lock()
+			settled := r.convergenceReason == ""
+			if settled {
+				r.convergenceReason = ConvergenceSettled
+			}
+			r.mu.Unlock()
+			r.cfg.Logger.Info("Adaptive batching: no uncertain documents left",
+				"round", r.round,
+				"trials", nextTrial-1)
+			if settled {
+				r.emit(Event{Type: EventConverged, Trial: nextTrial - 1, ConvergenceReason: ConvergenceSettled})
+			}
+			closeQueue()
+			return
+		}
 
-	// Track per-trial stats
-	type trialStats struct {
-		numBatches int
-		numCalls   int
-		usage      Usage
+		// The queue is empty here and holds at least two trials' worth of
+		// batches, so these sends never block
+		queueMu.Lock()
+		defer queueMu.Unlock()
+		if queueClosed {
+			return
+		}
+		for i, batch := range batches {
+			workQueue <- workItem{trialNum: nextTrial, batchNum: i + 1, batch: batch}
+		}
+		r.cfg.Logger.Debug("Adaptive trial queued",
+			"round", r.round,
+			"trial", nextTrial,
+			"num_batches", len(batches))
+		trialBatches[nextTrial] = len(batches)
+		outstanding += len(batches)
+		nextTrial++
 	}
-	trialStatsMap := make(map[int]*trialStats) // trial number -> stats
 
-	// Track fatal errors that should propagate to callers
-	var fatalErr error
+	// A resumed round may have converged, or finished its upfront trials
+	if progress != nil && progress.Converged {
+		cancel()
+	}
+	queueAdaptiveTrial()
 
 	// Collect results
 	for result := range resultsChan {
+		outstanding--
 		if result.err != nil {
-			// Skip logging if context was cancelled (intentional due to convergence)
-			if errors.Is(result.err, context.Canceled) {
+			// Skip logging if context was cancelled (convergence or caller cancellation)
+			if ctx.Err() != nil && (errors.Is(result.err, context.Canceled) || errors.Is(result.err, context.DeadlineExceeded)) {
 				continue
 			}
 			r.cfg.Logger.Error("Error in batch processing", "error", result.err)
+			r.emitError(Event{Trial: result.trialNumber, Batch: result.batchNumber, Calls: result.numCalls, Usage: result.usage}, result.err)
 			// Store the first fatal error to return to caller
 			if fatalErr == nil {
 				fatalErr = result.err
 			}
+			queueAdaptiveTrial()
 			continue
 		}
 
@@ -1801,8 +3202,14 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 		}
 		trialScoresMutex.Unlock()
 
-		// Track comparisons globally (across all rounds/trials)
+		// Keep the batch ordering for the scorer, and track comparisons
+		// globally (across all rounds/trials)
+		ordering := BatchOrdering{Round: r.round, Trial: result.trialNumber, IDs: make([]string, len(result.rankedDocs))}
+		for i, rankedDoc := range result.rankedDocs {
+			ordering.IDs[i] = rankedDoc.Document.ID
+		}
 		r.mu.Lock()
+		r.orderings = append(r.orderings, ordering)
 		for _, rankedDoc := range result.rankedDocs {
 			// Track which documents this was compared against
 			if r.comparedAgainst[rankedDoc.Document.ID] == nil {
@@ -1825,21 +3232,28 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 			"num_calls", result.numCalls,
 			"input_tokens", result.usage.InputTokens,
 			"output_tokens", result.usage.OutputTokens)
+		r.emit(Event{
+			Type:  EventBatchCompleted,
+			Trial: result.trialNumber,
+			Batch: result.batchNumber,
+			Calls: result.numCalls,
+			Usage: result.usage,
+		})
 
 		// Track stats per trial
 		if trialStatsMap[result.trialNumber] == nil {
 			trialStatsMap[result.trialNumber] = &trialStats{}
 		}
 		stats := trialStatsMap[result.trialNumber]
-		stats.numBatches++
-		stats.numCalls += result.numCalls
-		stats.usage.Add(result.usage)
+		stats.NumBatches++
+		stats.NumCalls += result.numCalls
+		stats.Usage.Add(result.usage)
 
 		// Track trial completion
 		completedBatches[result.trialNumber]++
 
 		// Check if this trial just completed
-		if completedBatches[result.trialNumber] == r.numBatches {
+		if completedBatches[result.trialNumber] == trialBatches[result.trialNumber] {
 			// Mark this trial as fully completed
 			completedTrials[result.trialNumber] = true
 			completedTrialsCount := len(completedTrials)
@@ -1847,16 +3261,16 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 			r.cfg.Logger.Info("Trial completed",
 				"round", r.round,
 				"trial", completedTrialsCount,
-				"num_batches", stats.numBatches,
-				"num_calls", stats.numCalls,
-				"input_tokens", stats.usage.InputTokens,
-				"output_tokens", stats.usage.OutputTokens)
+				"num_batches", stats.NumBatches,
+				"num_calls", stats.NumCalls,
+				"input_tokens", stats.Usage.InputTokens,
+				"output_tokens", stats.Usage.OutputTokens)
 
 			// Update running totals immediately after trial completion
 			r.mu.Lock()
-			r.totalUsage.Add(stats.usage)
-			r.totalCalls += stats.numCalls
-			r.totalBatches += stats.numBatches
+			r.totalUsage.Add(stats.Usage)
+			r.totalCalls += stats.NumCalls
+			r.totalBatches += stats.NumBatches
 			r.mu.Unlock()
 
 			// Check for convergence (this adds the current trial's elbow to the array)
@@ -1877,21 +3291,36 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 			trialScoresMutex.Unlock()
 
 			// Record trial state with cumulative scores from trials 1..N only
-			if err := r.recordTrialState(completedTrialsCount, completedTrialsCount, cumulativeScores, documents); err != nil {
-				r.cfg.Logger.Error("Failed to record trial state", "error", err)
-			}
+			lastTrial := converged || completedTrialsCount == r.cfg.NumTrials
+			r.recordTrialState(completedTrialsCount, completedTrialsCount, cumulativeScores, documents, lastTrial)
 
 			// Record model performance metrics if comparison is enabled
 			if err := r.recordModelPerformance(r.round, completedTrialsCount); err != nil {
 				r.cfg.Logger.Error("Failed to record model performance", "error", err)
 			}
 
+			// Save the trial so a resumed run need not repeat it
+			if r.checkpointDir != "" {
+				completed := make(map[int]*trialStats, len(completedTrials))
+				for trialNum := range completedTrials {
+					completed[trialNum] = trialStatsMap[trialNum]
+				}
+				trialScoresMutex.Lock()
+				err := r.saveProgress(completed, trialScores)
+				trialScoresMutex.Unlock()
+				if err != nil {
+					r.cfg.Logger.Error("Failed to write checkpoint", "error", err)
+				}
+			}
+
 			// Signal workers to stop if converged
 			if converged {
 				// No need to log here - hasConverged() already logged if it's the first detection
 				cancel() // Signal all workers to stop processing new work
 			}
 		}
+
+		queueAdaptiveTrial()
 	}
 
 	// Accumulate round totals from all trials
@@ -1901,9 +3330,9 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 	completedTrialsCount := len(completedTrials) // Only trials that actually completed all batches
 
 	for _, stats := range trialStatsMap {
-		roundUsage.Add(stats.usage)
-		roundCalls += stats.numCalls
-		roundBatches += stats.numBatches
+		roundUsage.Add(stats.Usage)
+		roundCalls += stats.NumCalls
+		roundBatches += stats.NumBatches
 	}
 
 	r.cfg.Logger.Info("Round completed",
@@ -1920,16 +3349,9 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 	r.totalRounds++ // Increment on each round
 	r.mu.Unlock()
 
-	// Calculate average scores
-	finalScores := make(map[string]float64)
-
-	for id, scoreList := range scores {
-		var sum float64
-		for _, score := range scoreList {
-			sum += score
-		}
-		finalScores[id] = sum / float64(len(scoreList))
-	}
+	// Score documents from the batch orderings (mean position by default)
+	finalScores := r.scorer.Score(r.orderings, r.round)
+	uncertainty := fittedIntervals(finalScores, scores, r.bootstrapRNG(completedTrialsCount))
 
 	var results []*RankedDocument
 	for id, score := range finalScores {
@@ -1939,28 +3361,81 @@ func (r *Ranker) shuffleBatchRank(documents []document) ([]*RankedDocument, erro
 					Key:        id,
 					Value:      doc.Value,
 					Document:   doc.Document,
-					Score:      score,
+					Score:      score.Score,
+					Strength:   score.Strength,
+					StdErr:     score.StdErr,
 					Exposure:   0.0, // Will be calculated at the end in RankFromFile
 					Rounds:     r.round,
 					InputIndex: doc.InputIndex,
+
+					ScoreVariance: uncertainty[id].variance,
+					Observations:  uncertainty[id].observations,
+					RankCILow:     uncertainty[id].rankLow,
+					RankCIHigh:    uncertainty[id].rankHigh,
 				})
 				break
 			}
 		}
 	}
 
+	// Break ties by input order so seeded runs are reproducible
 	sort.Slice(results, func(i, j int) bool {
-		return results[i].Score < results[j].Score
+		if results[i].Score != results[j].Score {
+			return results[i].Score < results[j].Score
+		}
+		return results[i].InputIndex < results[j].InputIndex
 	})
 
 	// Set elbow cutoff for refinement
 	r.setElbowCutoff(len(results))
 
+	// Record round stats for the run result
+	r.mu.Lock()
+	reason := r.convergenceReason
+	if reason == "" {
+		switch {
+		case parentCtx.Err() != nil:
+			reason = ConvergenceCanceled
+		case r.budgetExceeded:
+			reason = ConvergenceBudget
+		case !r.cfg.EnableConvergence:
+			reason = ConvergenceDisabled
+		default:
+			reason = ConvergenceMaxTrials
+		}
+	}
+	r.roundStats = append(r.roundStats, RoundStats{
+		Round:             r.round,
+		Documents:         len(documents),
+		Trials:            completedTrialsCount,
+		Batches:           roundBatches,
+		Calls:             roundCalls,
+		Usage:             roundUsage,
+		ElbowPositions:    append([]int(nil), r.elbowPositions...),
+		ElbowCutoff:       r.elbowCutoff,
+		ConvergenceReason: reason,
+		Criterion:         r.criterionName(),
+	})
+	r.mu.Unlock()
+
 	// Return fatal error if any batch failed with unrecoverable error
 	if fatalErr != nil {
 		return nil, fatalErr
 	}
 
+	// A round cut short keeps its last trial checkpoint, so that a resumed
+	// run completes it
+	if r.checkpointDir != "" && reason != ConvergenceCanceled && reason != ConvergenceBudget {
+		if err := r.saveFinishedRound(results); err != nil {
+			r.cfg.Logger.Error("Failed to write checkpoint", "error", err)
+		}
+	}
+
+	// Caller cancelled: results only cover documents scored so far
+	if parentCtx.Err() != nil {
+		return results, &CanceledError{Round: r.round, Trials: completedTrialsCount, Err: parentCtx.Err()}
+	}
+
 	return results, nil
 }
 
@@ -2285,9 +3760,12 @@ func (r *Ranker) hasConverged(scores map[string][]float64, completedTrialNum int
 		})
 	}
 
-	// Sort by score (lower is better)
+	// Sort by score (lower is better), ties by ID for a stable order
 	sort.Slice(currentRankings, func(i, j int) bool {
-		return currentRankings[i].Score < currentRankings[j].Score
+		if currentRankings[i].Score != currentRankings[j].Score {
+			return currentRankings[i].Score < currentRankings[j].Score
+		}
+		return currentRankings[i].Key < currentRankings[j].Key
 	})
 
 	// Store the ranking order for this trial
@@ -2338,7 +3816,8 @@ func (r *Ranker) hasConverged(scores map[string][]float64, completedTrialNum int
 		// Acquire lock to set convergence flag
 		r.mu.Lock()
 		// Double-check we haven't converged in the meantime (race condition)
-		if !r.converged {
+		detected := !r.converged
+		if detected {
 			r.converged = true
 
 			// Use len(r.rankingOrders) for all convergence types
@@ -2347,18 +3826,21 @@ func (r *Ranker) hasConverged(scores map[string][]float64, completedTrialNum int
 
 			// Log which criterion triggered
 			if elbowStable && rankingStable {
+				r.convergenceReason = ConvergenceBothStable
 				r.cfg.Logger.Info("Convergence: elbow and ranking both stabilized",
 					"round", r.round,
 					"trials_evaluated", trialsEvaluated,
 					"recent_elbow_positions", r.elbowPositions[len(r.elbowPositions)-r.cfg.StableTrials:],
 					"elbow_tolerance", actualTolerance)
 			} else if elbowStable {
+				r.convergenceReason = ConvergenceElbowStable
 				r.cfg.Logger.Info("Convergence: elbow position stabilized",
 					"round", r.round,
 					"trials_evaluated", trialsEvaluated,
 					"recent_positions", r.elbowPositions[len(r.elbowPositions)-r.cfg.StableTrials:],
 					"tolerance", actualTolerance)
 			} else {
+				r.convergenceReason = ConvergenceRankingStable
 				r.cfg.Logger.Info("Convergence: ranking order stabilized",
 					"round", r.round,
 					"trials_evaluated", trialsEvaluated,
@@ -2366,7 +3848,12 @@ func (r *Ranker) hasConverged(scores map[string][]float64, completedTrialNum int
 					"total_docs", len(currentRankings))
 			}
 		}
+		reason := r.convergenceReason
 		r.mu.Unlock()
+
+		if detected {
+			r.emit(Event{Type: EventConverged, Trial: completedTrialNum, ConvergenceReason: reason})
+		}
 	}
 
 	return stable
@@ -2460,6 +3947,17 @@ var promptDisclaimer = "\n\nREMEMBER to:\n" +
 	"- Respond in JSON format, with the following schema:\n  {\"docs\": [\"<ID1>\", \"<ID2>\", ...]}\n\n" +
 	"Here are the documents to be ranked:\n\n"
 
+// disclaimer returns the instructions that follow the prompt in a mode's calls
+func (r *Ranker) disclaimer(mode RankMode) string {
+	switch mode {
+	case ModePairwise:
+		return pairwisePromptDisclaimer
+	case ModePointwise:
+		return "\n\nRUBRIC:\n" + r.cfg.Rubric + pointwisePromptDisclaimer
+	}
+	return promptDisclaimer
+}
+
 const missingIDsStr = "Your last response was missing the following IDs: [%s]. " +
 	"Try again—and make ABSOLUTELY SURE to remember to:\n" +
 	"- ALWAYS return the IDs and NOT THE VALUES! " +
@@ -2473,12 +3971,17 @@ const invalidJSONStr = "Your last response was not valid JSON. Try again!"
 func (r *Ranker) estimateTokens(group []document, includePrompt bool) int {
 	text := ""
 	if includePrompt {
-		text += r.cfg.InitialPrompt + promptDisclaimer
+		text += r.prompt() + r.disclaimer(r.callMode)
 	}
 	for _, doc := range group {
 		text += fmt.Sprintf(promptFmt, doc.ID, doc.Value)
 	}
 
+	return r.countTokens(text)
+}
+
+// countTokens estimates the token count of text with the provider's tokenizer
+func (r *Ranker) countTokens(text string) int {
 	// Check if provider supports token estimation
 	if estimator, ok := r.provider.(TokenEstimator); ok {
 		return estimator.EstimateTokens(text)
@@ -2544,6 +4047,8 @@ func (r *Ranker) rankDocs(ctx context.Context, group []document, trialNumber int
 
 	// Get schema once
 	schema := r.getResponseSchema()
+	pairwise := r.callMode == ModePairwise
+	pointwise := r.callMode == ModePointwise
 
 	// Track previous attempt for feedback
 	type previousAttempt struct {
@@ -2560,14 +4065,15 @@ func (r *Ranker) rankDocs(ctx context.Context, group []document, trialNumber int
 		}
 
 		// Try to create memorable ID mappings for each attempt
-		originalToTemp, tempToOriginal, err := createIDMappings(group, r.rng, r.cfg.Logger)
+		originalToTemp, tempToOriginal, err := createIDMappings(group, r.batchRNG(trialNumber, batchNumber, attempt), r.cfg.Logger)
 		useMemorableIDs := err == nil && originalToTemp != nil && tempToOriginal != nil
 
 		// Build prompt (business logic)
-		prompt := r.cfg.InitialPrompt + promptDisclaimer
+		prompt := r.prompt() + r.disclaimer(r.callMode)
 
-		// Track input IDs for validation
+		// Track input IDs for validation, in prompt order
 		inputIDs := make(map[string]bool)
+		var shownIDs []string
 
 		if useMemorableIDs {
 			// Use memorable IDs in the prompt
@@ -2575,12 +4081,14 @@ func (r *Ranker) rankDocs(ctx context.Context, group []document, trialNumber int
 				tempID := originalToTemp[doc.ID]
 				prompt += fmt.Sprintf(promptFmt, tempID, doc.Value)
 				inputIDs[tempID] = true
+				shownIDs = append(shownIDs, tempID)
 			}
 		} else {
 			// Fall back to original IDs
 			for _, doc := range group {
 				prompt += fmt.Sprintf(promptFmt, doc.ID, doc.Value)
 				inputIDs[doc.ID] = true
+				shownIDs = append(shownIDs, doc.ID)
 			}
 		}
 
@@ -2610,16 +4118,27 @@ func (r *Ranker) rankDocs(ctx context.Context, group []document, trialNumber int
 			prompt += "--- END PREVIOUS ATTEMPT ---\n"
 		}
 
+		// Reserve budget for every attempt, since retry prompts grow with feedback
+		var projected Usage
+		if r.hasBudget() {
+			projected = r.projectCallUsage(prompt, len(group))
+			if !r.reserveBudget(projected) {
+				return nil, numCalls, totalUsage, errBudgetExceeded
+			}
+		}
+
 		// Call provider with options
 		opts := &CompletionOptions{
 			Schema: schema,
 		}
 
 		rawResponse, err := r.provider.Complete(ctx, prompt, opts)
+		r.releaseBudget(projected)
 
 		// Accumulate usage from opts
 		numCalls++
 		totalUsage.Add(opts.Usage)
+		r.recordCall(opts)
 
 		// Log the call
 		r.cfg.Logger.Debug("LLM call completed",
@@ -2631,7 +4150,8 @@ func (r *Ranker) rankDocs(ctx context.Context, group []document, trialNumber int
 			"output_tokens", opts.Usage.OutputTokens,
 			"reasoning_tokens", opts.Usage.ReasoningTokens,
 			"model", opts.ModelUsed,
-			"finish_reason", opts.FinishReason)
+			"finish_reason", opts.FinishReason,
+			"cached", opts.Cached)
 
 		if err != nil {
 			if attempt == maxRetries-1 {
@@ -2662,7 +4182,40 @@ func (r *Ranker) rankDocs(ctx context.Context, group []document, trialNumber int
 
 		// Parse JSON (business logic)
 		var rankedResponse rankedDocumentResponse
-		if err := json.Unmarshal([]byte(jsonResponse), &rankedResponse); err != nil {
+		var grades []float64 // Absolute scores in pointwise mode, parallel to rankedResponse.Documents
+		if pointwise {
+			var problem string
+			if rankedResponse, grades, problem = parsePointwiseResponse(jsonResponse); problem != "" {
+				lastAttempt = &previousAttempt{
+					response: jsonResponse,
+					problem:  problem,
+				}
+
+				if attempt == maxRetries-1 {
+					return nil, numCalls, totalUsage, fmt.Errorf("invalid scores after %d attempts: %s", maxRetries, problem)
+				}
+
+				r.logFromApiCall(trialNumber, batchNumber,
+					"Invalid scores, retrying (attempt %d): %s", attempt+1, problem)
+				continue
+			}
+		} else if pairwise {
+			var problem string
+			if rankedResponse, problem = parsePairwiseResponse(jsonResponse, shownIDs); problem != "" {
+				lastAttempt = &previousAttempt{
+					response: jsonResponse,
+					problem:  problem,
+				}
+
+				if attempt == maxRetries-1 {
+					return nil, numCalls, totalUsage, fmt.Errorf("invalid pairwise answer after %d attempts: %s", maxRetries, problem)
+				}
+
+				r.logFromApiCall(trialNumber, batchNumber,
+					"Invalid pairwise answer, retrying (attempt %d): %s", attempt+1, problem)
+				continue
+			}
+		} else if err := json.Unmarshal([]byte(jsonResponse), &rankedResponse); err != nil {
 			lastAttempt = &previousAttempt{
 				response: jsonResponse,
 				problem:  fmt.Sprintf("Your JSON had a syntax error: %v", err),
@@ -2706,9 +4259,13 @@ func (r *Ranker) rankDocs(ctx context.Context, group []document, trialNumber int
 		for i, id := range rankedResponse.Documents {
 			for _, doc := range group {
 				if doc.ID == id {
+					score := float64(i + 1) // Score based on position (1 for first, 2 for second, etc.)
+					if pointwise {
+						score = grades[i]
+					}
 					rankedDocs = append(rankedDocs, rankedDocument{
 						Document: doc,
-						Score:    float64(i + 1), // Score based on position (1 for first, 2 for second, etc.)
+						Score:    score,
 					})
 					break
 				}
@@ -2721,6 +4278,7 @@ func (r *Ranker) rankDocs(ctx context.Context, group []document, trialNumber int
 			for _, docRelevance := range rankedResponse.Relevance {
 				if stats, exists := r.allDocStats[docRelevance.ID]; exists {
 					stats.relevanceSnippets = append(stats.relevanceSnippets, docRelevance.Text)
+					stats.snippetTrials = append(stats.snippetTrials, trialRef{Round: r.round, Trial: trialNumber})
 				}
 			}
 			r.mu.Unlock()
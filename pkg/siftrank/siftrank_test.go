@@ -1,14 +1,23 @@
 package siftrank
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/gdamore/tcell/v2"
 	"github.com/openai/openai-go"
 )
 
@@ -73,6 +82,51 @@ func TestNewRanker(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "unknown provider",
+			config: &Config{
+				InitialPrompt: "test",
+				BatchSize:     5,
+				NumTrials:     2,
+				Concurrency:   20,
+				BatchTokens:   1000,
+				Provider:      "bedrock",
+				OpenAIKey:     "test-key",
+				Encoding:      "o200k_base",
+			},
+			wantErr: true,
+		},
+		{
+			name: "provider config without OpenAI key",
+			config: &Config{
+				InitialPrompt: "test",
+				BatchSize:     5,
+				NumTrials:     2,
+				Concurrency:   20,
+				BatchTokens:   1000,
+				ProviderConfig: &ProviderConfig{
+					Type:    ProviderTypeOllama,
+					Model:   "llama3.3",
+					BaseURL: "http://localhost:11434",
+				},
+				Encoding: "o200k_base",
+			},
+			wantErr: false,
+		},
+		{
+			name: "non-OpenAI provider missing API key",
+			config: &Config{
+				InitialPrompt: "test",
+				BatchSize:     5,
+				NumTrials:     2,
+				Concurrency:   20,
+				BatchTokens:   1000,
+				Provider:      ProviderTypeAnthropic,
+				OpenAIModel:   "claude-sonnet-4-20250514",
+				Encoding:      "o200k_base",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -532,3 +586,579 @@ func TestRankFromFiles_AtDocumentLimit(t *testing.T) {
 		t.Errorf("Expected 10000 documents, got %d", len(results))
 	}
 }
+
+func TestBatchRNG_Deterministic(t *testing.T) {
+	docs := []document{{ID: "a"}, {ID: "b"}, {ID: "c"}, {ID: "d"}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	mappings := func(seed int64, trial, batch, attempt int) map[string]string {
+		ranker := &Ranker{seed: seed, runState: runState{round: 1}}
+		originalToTemp, _, err := createIDMappings(docs, ranker.batchRNG(trial, batch, attempt), logger)
+		if err != nil {
+			t.Fatalf("createIDMappings failed: %v", err)
+		}
+		return originalToTemp
+	}
+
+	first := mappings(42, 1, 1, 0)
+	if !reflect.DeepEqual(first, mappings(42, 1, 1, 0)) {
+		t.Error("expected identical IDs for the same seed and batch position")
+	}
+	if reflect.DeepEqual(first, mappings(42, 1, 2, 0)) {
+		t.Error("expected different IDs for a different batch")
+	}
+	if reflect.DeepEqual(first, mappings(43, 1, 1, 0)) {
+		t.Error("expected different IDs for a different seed")
+	}
+}
+
+// promptLogProvider records every prompt it ranks
+type promptLogProvider struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (p *promptLogProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	p.mu.Lock()
+	p.prompts = append(p.prompts, prompt)
+	p.mu.Unlock()
+	return echoRankProvider{}.Complete(ctx, prompt, opts)
+}
+
+func TestRanker_SeedReproducible(t *testing.T) {
+	var lines []string
+	for i := 0; i < 23; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+	input := strings.Join(lines, "\n")
+
+	run := func(seed int64) []string {
+		provider := &promptLogProvider{}
+		config := NewConfig()
+		config.InitialPrompt = "rank"
+		config.BatchSize = 5
+		config.NumTrials = 4
+		config.Concurrency = 8
+		config.EnableConvergence = false
+		config.LLMProvider = provider
+		config.Seed = seed
+		config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+		ranker, err := NewRanker(config)
+		if err != nil {
+			t.Fatalf("NewRanker failed: %v", err)
+		}
+		if ranker.Seed() != seed {
+			t.Errorf("expected seed %d, got %d", seed, ranker.Seed())
+		}
+		if _, err := ranker.RankFromReader(strings.NewReader(input), "{{.Data}}", false); err != nil {
+			t.Fatalf("RankFromReader failed: %v", err)
+		}
+
+		// Workers finish in any order; the set of prompts must still match
+		sort.Strings(provider.prompts)
+		return provider.prompts
+	}
+
+	first := run(7)
+	if !reflect.DeepEqual(first, run(7)) {
+		t.Error("expected identical prompts for runs with the same seed")
+	}
+	if reflect.DeepEqual(first, run(8)) {
+		t.Error("expected different prompts for runs with different seeds")
+	}
+}
+
+func TestRanker_ConcurrentCalls(t *testing.T) {
+	newConfig := func() *Config {
+		config := testConfig(&oracleProvider{})
+		config.BatchSize = 10
+		config.NumTrials = 4
+		config.Concurrency = 4
+		return config
+	}
+
+	// Inputs smaller than the batch size shrink it for their run only
+	var inputs []string
+	for n := 3; n <= 80; n += 7 {
+		inputs = append(inputs, itemsInput(n))
+	}
+
+	config := newConfig()
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	rankings := make([][]*RankedDocument, len(inputs))
+	errs := make([]error, len(inputs))
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rankings[i], errs[i] = ranker.RankFromReader(strings.NewReader(input), "{{.Data}}", false)
+		}()
+	}
+	wg.Wait()
+
+	for i, input := range inputs {
+		if errs[i] != nil {
+			t.Fatalf("input %d: RankFromReader failed: %v", i, errs[i])
+		}
+
+		// Same as a ranker of its own
+		alone, err := NewRanker(newConfig())
+		if err != nil {
+			t.Fatalf("NewRanker failed: %v", err)
+		}
+		want, err := alone.RankFromReader(strings.NewReader(input), "{{.Data}}", false)
+		if err != nil {
+			t.Fatalf("input %d: RankFromReader failed: %v", i, err)
+		}
+		if len(rankings[i]) != len(want) {
+			t.Fatalf("input %d: expected %d documents, got %d", i, len(want), len(rankings[i]))
+		}
+		for j := range want {
+			if rankings[i][j].Key != want[j].Key {
+				t.Errorf("input %d: expected %s at rank %d, got %s", i, want[j].Value, j+1, rankings[i][j].Value)
+				break
+			}
+		}
+	}
+
+	if config.BatchSize != 10 || ranker.cfg.BatchSize != 10 {
+		t.Errorf("expected the batch size to stay 10, got %d (config) and %d (ranker)", config.BatchSize, ranker.cfg.BatchSize)
+	}
+}
+
+func TestNewRanker_CopiesConfig(t *testing.T) {
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.LLMProvider = echoRankProvider{}
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	if config.Logger != nil {
+		t.Error("expected the caller's config to be left unchanged")
+	}
+
+	config.InitialPrompt = "changed"
+	if ranker.cfg.InitialPrompt != "rank" {
+		t.Errorf("expected later config changes not to reach the ranker, got prompt %q", ranker.cfg.InitialPrompt)
+	}
+}
+
+func TestRankFromFile_TraceHeader(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("apple\nbanana\ncherry"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	tracePath := filepath.Join(tmpDir, "trace.jsonl")
+
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.BatchSize = 3
+	config.NumTrials = 1
+	config.LLMProvider = echoRankProvider{}
+	config.TracePath = tracePath
+	config.Seed = 99
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	if _, err := ranker.RankFromFile(testFile, nil, "{{.Data}}", false); err != nil {
+		t.Fatalf("RankFromFile failed: %v", err)
+	}
+
+	file, err := os.Open(tracePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		t.Fatal("trace file is empty")
+	}
+	var header traceHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatalf("invalid trace header: %v", err)
+	}
+	if header.EventType != "header" || header.Seed != 99 {
+		t.Errorf("expected header with seed 99, got %+v", header)
+	}
+}
+
+func TestRankFromFile_ConcurrentTraces(t *testing.T) {
+	tmpDir := t.TempDir()
+	tracePath := filepath.Join(tmpDir, "trace.jsonl")
+
+	config := testConfig(&oracleProvider{})
+	config.BatchSize = 10
+	config.NumTrials = 3
+	config.Concurrency = 4
+	config.TracePath = tracePath
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	const calls = 4
+	errs := make([]error, calls)
+	var wg sync.WaitGroup
+	for i := 0; i < calls; i++ {
+		inputFile := filepath.Join(tmpDir, fmt.Sprintf("input%d.txt", i))
+		if err := os.WriteFile(inputFile, []byte(itemsInput(20+10*i)), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = ranker.RankFromFile(inputFile, nil, "{{.Data}}", false)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("call %d: RankFromFile failed: %v", i, err)
+		}
+	}
+
+	// One file per call, each a header followed by that call's trials
+	paths := []string{tracePath}
+	for n := 2; n <= calls; n++ {
+		paths = append(paths, filepath.Join(tmpDir, fmt.Sprintf("trace.%d.jsonl", n)))
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("expected a trace file per call: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		headers := 0
+		for _, line := range lines {
+			var event map[string]any
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				t.Fatalf("%s: invalid trace line %q: %v", path, line, err)
+			}
+			if event["event_type"] == "header" {
+				headers++
+			}
+		}
+		if headers != 1 || len(lines) < 1+config.NumTrials {
+			t.Errorf("%s: expected one header and %d trials, got %d headers in %d lines", path, config.NumTrials, headers, len(lines))
+		}
+	}
+}
+
+func TestRankFromReader_Trace(t *testing.T) {
+	tracePath := filepath.Join(t.TempDir(), "trace.jsonl")
+
+	config := testConfig(echoRankProvider{})
+	config.BatchSize = 3
+	config.NumTrials = 2
+	config.TracePath = tracePath
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	if _, err := ranker.RankFromReader(strings.NewReader("apple\nbanana\ncherry"), "{{.Data}}", false); err != nil {
+		t.Fatalf("RankFromReader failed: %v", err)
+	}
+
+	data, err := os.ReadFile(tracePath)
+	if err != nil {
+		t.Fatalf("expected a trace file for reader input: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines < 3 {
+		t.Errorf("expected a header and a line per trial, got %d lines", lines)
+	}
+}
+
+// cancelAfterProvider ranks like echoRankProvider and cancels the run after a number of calls
+type cancelAfterProvider struct {
+	mu     sync.Mutex
+	calls  int
+	after  int
+	cancel context.CancelFunc
+}
+
+func (p *cancelAfterProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	p.mu.Lock()
+	p.calls++
+	if p.calls == p.after {
+		p.cancel()
+	}
+	p.mu.Unlock()
+	return echoRankProvider{}.Complete(ctx, prompt, opts)
+}
+
+func TestRankFromReaderContext_Canceled(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 4 batches per trial: trial 1 completes, trial 2 is interrupted
+	provider := &cancelAfterProvider{after: 6, cancel: cancel}
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.BatchSize = 5
+	config.NumTrials = 10
+	config.Concurrency = 1
+	config.EnableConvergence = false
+	config.LLMProvider = provider
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	results, err := ranker.RankFromReaderContext(ctx, strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	var canceledErr *CanceledError
+	if !errors.As(err, &canceledErr) {
+		t.Fatalf("expected *CanceledError, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected error to wrap context.Canceled, got %v", err)
+	}
+	if canceledErr.Round != 1 || canceledErr.Trials != 1 {
+		t.Errorf("expected cancellation in round 1 after 1 trial, got round %d after %d trials", canceledErr.Round, canceledErr.Trials)
+	}
+	if provider.calls >= 4*config.NumTrials {
+		t.Errorf("expected ranking to stop early, made %d calls", provider.calls)
+	}
+
+	// Every document was scored in trial 1, so the partial ranking is complete
+	if len(results) != len(lines) {
+		t.Fatalf("expected %d partial results, got %d", len(lines), len(results))
+	}
+	for i, result := range results {
+		if result.Rank != i+1 {
+			t.Errorf("result %d expected rank %d, got %d", i, i+1, result.Rank)
+		}
+	}
+}
+
+func TestRankFromReaderResult(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.BatchSize = 5
+	config.NumTrials = 2
+	config.EnableConvergence = false
+	config.RefinementRatio = 0.5
+	config.LLMProvider = echoRankProvider{}
+	config.Seed = 5
+	config.Pricing = &Pricing{InputPerMillion: 1, OutputPerMillion: 2}
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+
+	if len(result.Documents) != len(lines) {
+		t.Errorf("expected %d documents, got %d", len(lines), len(result.Documents))
+	}
+	if len(result.Rounds) < 2 {
+		t.Fatalf("expected a refinement round, got %d rounds", len(result.Rounds))
+	}
+	first := result.Rounds[0]
+	if first.Round != 1 || first.Documents != 20 || first.Trials != 2 || first.Batches != 8 {
+		t.Errorf("unexpected first round stats: %+v", first)
+	}
+	if first.ConvergenceReason != ConvergenceDisabled {
+		t.Errorf("expected convergence reason %q, got %q", ConvergenceDisabled, first.ConvergenceReason)
+	}
+
+	var roundCalls int
+	var roundUsage Usage
+	for _, round := range result.Rounds {
+		roundCalls += round.Calls
+		roundUsage.Add(round.Usage)
+	}
+	if result.NumCalls != roundCalls || result.Usage != roundUsage {
+		t.Errorf("expected totals to match round sums, got %d calls %+v vs %d calls %+v",
+			result.NumCalls, result.Usage, roundCalls, roundUsage)
+	}
+
+	if result.CostUSD == nil || *result.CostUSD != config.Pricing.Cost(result.Usage) {
+		t.Errorf("expected cost %v, got %v", config.Pricing.Cost(result.Usage), result.CostUSD)
+	}
+	if !reflect.DeepEqual(result.Models, []string{"echo"}) {
+		t.Errorf("expected models [echo], got %v", result.Models)
+	}
+	if result.Seed != 5 {
+		t.Errorf("expected seed 5, got %d", result.Seed)
+	}
+	if result.StartedAt.IsZero() {
+		t.Error("expected start time to be set")
+	}
+}
+
+func TestRankFromReaderResult_TokenBudget(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+
+	provider := &promptLogProvider{}
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.BatchSize = 5
+	config.NumTrials = 10
+	config.Concurrency = 1
+	config.EnableConvergence = false
+	config.LLMProvider = provider
+	config.MaxTokens = 2000
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+
+	if !result.BudgetExceeded {
+		t.Error("expected result to be flagged as budget-truncated")
+	}
+	if len(provider.prompts) == 0 || len(provider.prompts) >= 4*config.NumTrials {
+		t.Errorf("expected the budget to stop the run early, made %d calls", len(provider.prompts))
+	}
+	if len(result.Rounds) != 1 || result.Rounds[0].ConvergenceReason != ConvergenceBudget {
+		t.Errorf("expected a single round stopped by the budget, got %+v", result.Rounds)
+	}
+	if len(result.Documents) == 0 {
+		t.Error("expected the best ranking so far")
+	}
+
+	var spent int
+	for _, usage := range ranker.usageByModel {
+		spent += usage.TotalTokens()
+	}
+	if spent > config.MaxTokens {
+		t.Errorf("expected at most %d tokens spent, got %d", config.MaxTokens, spent)
+	}
+}
+
+// badJSONProvider never returns valid JSON, so every batch retries
+type badJSONProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *badJSONProvider) Complete(ctx context.Context, prompt string, opts *CompletionOptions) (string, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+	if opts != nil {
+		opts.Usage = Usage{InputTokens: len(prompt) / 4, OutputTokens: 10}
+	}
+	return "this is not JSON", nil
+}
+
+func TestRankFromReaderResult_TokenBudgetCoversRetries(t *testing.T) {
+	var lines []string
+	for i := 0; i < 10; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+
+	provider := &badJSONProvider{}
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.BatchSize = 5
+	config.NumTrials = 1
+	config.Concurrency = 1
+	config.EnableConvergence = false
+	config.LLMProvider = provider
+	config.MaxTokens = 2000
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+
+	result, err := ranker.RankFromReaderResult(context.Background(), strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReaderResult failed: %v", err)
+	}
+	if !result.BudgetExceeded {
+		t.Error("expected result to be flagged as budget-truncated")
+	}
+	if provider.calls == 0 || provider.calls >= 10 {
+		t.Errorf("expected the budget to stop the retries, made %d calls", provider.calls)
+	}
+
+	var spent int
+	for _, usage := range ranker.usageByModel {
+		spent += usage.TotalTokens()
+	}
+	if spent > config.MaxTokens {
+		t.Errorf("expected at most %d tokens spent across retries, got %d", config.MaxTokens, spent)
+	}
+}
+
+func TestNewRanker_CostBudgetRequiresPricing(t *testing.T) {
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.LLMProvider = echoRankProvider{}
+	config.MaxCostUSD = 1
+
+	if _, err := NewRanker(config); err == nil {
+		t.Error("expected error for a cost budget without pricing")
+	}
+
+	config.Pricing = &Pricing{InputPerMillion: 1, OutputPerMillion: 1}
+	if _, err := NewRanker(config); err != nil {
+		t.Errorf("expected explicit pricing to satisfy the cost budget, got %v", err)
+	}
+}
+
+func TestWatchForQuit(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer screen.Fini()
+
+	ctx, stop := watchForQuit(context.Background(), screen)
+	defer stop()
+
+	// Other keys leave the run alone
+	screen.InjectKey(tcell.KeyRune, 'x', tcell.ModNone)
+	screen.InjectKey(tcell.KeyRune, 'q', tcell.ModNone)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected q to cancel the run")
+	}
+	if !errors.Is(ctx.Err(), context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", ctx.Err())
+	}
+}
@@ -0,0 +1,130 @@
+package siftrank
+
+import (
+	"math/rand"
+	"sort"
+)
+
+const (
+	// bootstrapResamples is the number of resampled rankings behind each
+	// rank confidence interval
+	bootstrapResamples = 200
+
+	// rankCIAlpha leaves this much probability outside the rank interval (95% CI)
+	rankCIAlpha = 0.05
+
+	// maxTiedRanks is how many ranks on each side of a document tiedWith
+	// looks for overlapping intervals
+	maxTiedRanks = 5
+
+	// rngDomainBootstrap separates bootstrap random sources from batch ones
+	rngDomainBootstrap = -1
+)
+
+// scoreStats describes the uncertainty of one document's score
+type scoreStats struct {
+	variance     float64 // Sample variance of the score list
+	observations int     // Length of the score list
+	rankLow      int     // Bootstrap rank confidence interval (1-based)
+	rankHigh     int
+}
+
+// scoreUncertainty computes each document's score variance and a bootstrap
+// confidence interval for its rank. Every resample redraws each document's
+// score list with replacement and re-ranks the documents by mean score.
+func scoreUncertainty(scores map[string][]float64, rng *rand.Rand) map[string]scoreStats {
+	// Sorted IDs keep the resampling reproducible for a given rng
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	stats := make(map[string]scoreStats, len(ids))
+	for _, id := range ids {
+		stats[id] = scoreStats{
+			variance:     sampleVariance(scores[id]),
+			observations: len(scores[id]),
+		}
+	}
+
+	// ranks[i][b] is document i's rank in resample b
+	ranks := make([][]int, len(ids))
+	for i := range ranks {
+		ranks[i] = make([]int, bootstrapResamples)
+	}
+	means := make([]float64, len(ids))
+	order := make([]int, len(ids))
+	for b := 0; b < bootstrapResamples; b++ {
+		for i, id := range ids {
+			list := scores[id]
+			var sum float64
+			for range list {
+				sum += list[rng.Intn(len(list))]
+			}
+			means[i] = sum / float64(len(list))
+			order[i] = i
+		}
+		sort.Slice(order, func(x, y int) bool {
+			if means[order[x]] != means[order[y]] {
+				return means[order[x]] < means[order[y]]
+			}
+			return order[x] < order[y]
+		})
+		for rank, i := range order {
+			ranks[i][b] = rank + 1
+		}
+	}
+
+	lowIdx := int(rankCIAlpha / 2 * bootstrapResamples)
+	highIdx := bootstrapResamples - 1 - lowIdx
+	for i, id := range ids {
+		sort.Ints(ranks[i])
+		s := stats[id]
+		s.rankLow = ranks[i][lowIdx]
+		s.rankHigh = ranks[i][highIdx]
+		stats[id] = s
+	}
+	return stats
+}
+
+// sampleVariance returns the unbiased variance of values (0 for fewer than two)
+func sampleVariance(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	var mean float64
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	var ss float64
+	for _, v := range values {
+		ss += (v - mean) * (v - mean)
+	}
+	return ss / float64(len(values)-1)
+}
+
+// tiedWith lists, for each document, the keys of the other documents whose
+// rank confidence intervals overlap its own: their relative order is not
+// settled by the data. Keys must be in rank order; only documents within
+// maxTiedRanks positions are compared, which bounds the work and the length
+// of each list when early, wide intervals would tie everything.
+func tiedWith(keys []string, lows, highs []int) [][]string {
+	tied := make([][]string, len(keys))
+	for i := range keys {
+		for j := max(0, i-maxTiedRanks); j <= min(len(keys)-1, i+maxTiedRanks); j++ {
+			if i != j && lows[i] <= highs[j] && lows[j] <= highs[i] {
+				tied[i] = append(tied[i], keys[j])
+			}
+		}
+	}
+	return tied
+}
+
+// bootstrapRNG returns the random source for the rank intervals computed
+// after a number of completed trials in the current round
+func (r *Ranker) bootstrapRNG(trialsCompleted int) *rand.Rand {
+	return r.derivedRNG(rngDomainBootstrap, int64(r.round), int64(trialsCompleted))
+}
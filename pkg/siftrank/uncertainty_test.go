@@ -0,0 +1,129 @@
+package siftrank
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSampleVariance(t *testing.T) {
+	if v := sampleVariance([]float64{1, 2, 3, 4}); v != 5.0/3.0 {
+		t.Errorf("expected variance 5/3, got %v", v)
+	}
+	if v := sampleVariance([]float64{3}); v != 0 {
+		t.Errorf("expected 0 for a single value, got %v", v)
+	}
+}
+
+func TestScoreUncertainty(t *testing.T) {
+	scores := map[string][]float64{
+		"a": {1, 1, 1, 1, 1},
+		"b": {2, 2, 3, 2, 3},
+		"c": {3, 2, 2, 3, 2},
+		"d": {4, 4, 4, 4, 4},
+	}
+
+	stats := scoreUncertainty(scores, rand.New(rand.NewSource(1)))
+
+	if s := stats["a"]; s.rankLow != 1 || s.rankHigh != 1 || s.variance != 0 || s.observations != 5 {
+		t.Errorf("expected a pinned at rank 1, got %+v", s)
+	}
+	if s := stats["d"]; s.rankLow != 4 || s.rankHigh != 4 {
+		t.Errorf("expected d pinned at rank 4, got %+v", s)
+	}
+
+	// b and c swap places across resamples
+	for _, id := range []string{"b", "c"} {
+		if s := stats[id]; s.rankLow != 2 || s.rankHigh != 3 || s.variance == 0 {
+			t.Errorf("expected %s to span ranks 2-3, got %+v", id, s)
+		}
+	}
+
+	// Same seed, same intervals
+	again := scoreUncertainty(scores, rand.New(rand.NewSource(1)))
+	if !reflect.DeepEqual(stats, again) {
+		t.Errorf("expected reproducible intervals, got %+v and %+v", stats, again)
+	}
+}
+
+func TestTiedWith(t *testing.T) {
+	keys := []string{"a", "b", "c", "d"}
+	lows := []int{1, 2, 2, 4}
+	highs := []int{1, 3, 3, 4}
+
+	tied := tiedWith(keys, lows, highs)
+	want := [][]string{nil, {"c"}, {"b"}, nil}
+	if !reflect.DeepEqual(tied, want) {
+		t.Errorf("expected %v, got %v", want, tied)
+	}
+}
+
+func TestTiedWith_NearbyRanks(t *testing.T) {
+	// Every interval spans all ranks, as after a first trial
+	n := 40
+	keys := make([]string, n)
+	lows := make([]int, n)
+	highs := make([]int, n)
+	for i := range keys {
+		keys[i], lows[i], highs[i] = fmt.Sprintf("doc%02d", i), 1, n
+	}
+
+	tied := tiedWith(keys, lows, highs)
+	if len(tied[0]) != maxTiedRanks || len(tied[n/2]) != 2*maxTiedRanks {
+		t.Errorf("expected %d and %d ties, got %d and %d", maxTiedRanks, 2*maxTiedRanks, len(tied[0]), len(tied[n/2]))
+	}
+	want := []string{"doc01", "doc02", "doc03", "doc04", "doc05"}
+	if !reflect.DeepEqual(tied[0], want) {
+		t.Errorf("expected the nearest ranks %v, got %v", want, tied[0])
+	}
+}
+
+func TestRanker_RankUncertainty(t *testing.T) {
+	var lines []string
+	for i := 0; i < 12; i++ {
+		lines = append(lines, fmt.Sprintf("item %d", i))
+	}
+
+	config := NewConfig()
+	config.InitialPrompt = "rank"
+	config.BatchSize = 4
+	config.NumTrials = 5
+	config.RefinementRatio = 0
+	config.EnableConvergence = false
+	config.LLMProvider = echoRankProvider{}
+	config.Seed = 11
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ranker, err := NewRanker(config)
+	if err != nil {
+		t.Fatalf("NewRanker failed: %v", err)
+	}
+	results, err := ranker.RankFromReader(strings.NewReader(strings.Join(lines, "\n")), "{{.Data}}", false)
+	if err != nil {
+		t.Fatalf("RankFromReader failed: %v", err)
+	}
+
+	byKey := make(map[string]*RankedDocument)
+	for _, doc := range results {
+		byKey[doc.Key] = doc
+	}
+	for _, doc := range results {
+		if doc.Observations != config.NumTrials {
+			t.Errorf("expected %d observations for %s, got %d", config.NumTrials, doc.Key, doc.Observations)
+		}
+		if doc.RankCILow < 1 || doc.RankCILow > doc.RankCIHigh || doc.RankCIHigh > len(results) {
+			t.Errorf("invalid rank interval [%d, %d] for %s", doc.RankCILow, doc.RankCIHigh, doc.Key)
+		}
+		for _, key := range doc.TiedWith {
+			other := byKey[key]
+			if other == nil || !slices.Contains(other.TiedWith, doc.Key) {
+				t.Errorf("expected %s and %s to be tied with each other", doc.Key, key)
+			}
+		}
+	}
+}